@@ -0,0 +1,308 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/dns-forwarder/pkg/admin"
+	"github.com/dns-forwarder/pkg/domainlist"
+	"github.com/dns-forwarder/pkg/logging"
+)
+
+// startedAt زمان شروع برنامه برای گزارش uptime
+var startedAt = time.Now()
+
+// startAdminListener راه‌اندازی API مدیریتی روی آدرس محلی
+func startAdminListener() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", admin.Method(http.MethodGet, adminStatus))
+	mux.HandleFunc("/servers", admin.Method(http.MethodGet, adminServers))
+	mux.HandleFunc("/reconnect", admin.Method(http.MethodPost, adminReconnect))
+	mux.HandleFunc("/cache", admin.Method(http.MethodGet, adminCacheList))
+	mux.HandleFunc("/cache/flush", admin.Method(http.MethodPost, adminCacheFlush))
+	mux.HandleFunc("/stats", admin.Method(http.MethodGet, adminStats))
+	mux.HandleFunc("/blocklist", admin.Method(http.MethodGet, adminBlocklist))
+	mux.HandleFunc("/reload", admin.Method(http.MethodPost, adminReload))
+
+	go statsHistoryLoop()
+
+	mainLog.Info("API مدیریتی فعال", "listen", config.Admin.Listen)
+	go func() {
+		if err := http.ListenAndServe(config.Admin.Listen, admin.Protect(config.Admin.Token, mux, nil)); err != nil {
+			logging.Fatal(mainLog, "خطا در راه‌اندازی API مدیریتی", "error", err)
+		}
+	}()
+}
+
+// tunnelStatus وضعیت تانل در پاسخ /status
+type tunnelStatus struct {
+	Connected       bool       `json:"connected"`
+	Server          string     `json:"server,omitempty"`
+	Transport       string     `json:"transport,omitempty"`
+	ConnectedSince  *time.Time `json:"connected_since,omitempty"`
+	RTTMillis       float64    `json:"rtt_ms,omitempty"`
+	Pending         int        `json:"pending"`
+	OldestPendingMs float64    `json:"oldest_pending_ms,omitempty"`
+	OpenStreams     int        `json:"open_streams"`
+	CacheEntries    int        `json:"cache_entries"`
+	Uptime          string     `json:"uptime"`
+}
+
+// adminStatus وضعیت تانل، سرور فعلی، RTT و درخواست‌های در انتظار
+func adminStatus(w http.ResponseWriter, r *http.Request) {
+	status := tunnelStatus{
+		Uptime: time.Since(startedAt).Round(time.Second).String(),
+	}
+
+	if server := activeServer.Load(); server != nil && atomic.LoadInt32(&connected) == 1 {
+		status.Connected = true
+		status.Server = server.URL
+		status.Transport = server.Transport
+		since := time.Unix(0, atomic.LoadInt64(&connectedSince))
+		status.ConnectedSince = &since
+		if rtt := atomic.LoadInt64(&tunnelRTT); rtt > 0 {
+			status.RTTMillis = float64(rtt) / float64(time.Millisecond)
+		}
+	}
+
+	now := time.Now()
+	pendingMutex.RLock()
+	status.Pending = len(pendingRequests)
+	for _, req := range pendingRequests {
+		if age := float64(now.Sub(req.CreatedAt)) / float64(time.Millisecond); age > status.OldestPendingMs {
+			status.OldestPendingMs = age
+		}
+	}
+	pendingMutex.RUnlock()
+
+	if m := streams.Load(); m != nil {
+		status.OpenStreams = m.Len()
+	}
+	if dnsCache != nil {
+		dnsCache.RLock()
+		status.CacheEntries = len(dnsCache.entries)
+		dnsCache.RUnlock()
+	}
+
+	admin.JSON(w, http.StatusOK, status)
+}
+
+// serverInfo یک سرور تنظیم‌شده در پاسخ /servers
+type serverInfo struct {
+	Index     int    `json:"index"`
+	URL       string `json:"url"`
+	Transport string `json:"transport"`
+	Active    bool   `json:"active"`
+}
+
+// adminServers فهرست سرورهای تنظیم‌شده
+func adminServers(w http.ResponseWriter, r *http.Request) {
+	active := activeServer.Load()
+	list := make([]serverInfo, len(config.Servers))
+	for i, server := range config.Servers {
+		list[i] = serverInfo{
+			Index:     i,
+			URL:       server.URL,
+			Transport: server.Transport,
+			Active:    active != nil && active.URL == server.URL,
+		}
+	}
+	admin.JSON(w, http.StatusOK, list)
+}
+
+// adminReconnect اتصال مجدد به سرور فعلی یا تعویض سرور
+//
+// پارامتر server (شماره یا آدرس) سرور مقصد را تعیین می‌کند.
+func adminReconnect(w http.ResponseWriter, r *http.Request) {
+	index := -1
+	if value := r.URL.Query().Get("server"); value != "" {
+		index = findServer(value)
+		if index < 0 {
+			admin.Error(w, http.StatusNotFound, "unknown server")
+			return
+		}
+	}
+
+	target := "current"
+	if index >= 0 {
+		target = config.Servers[index].URL
+	}
+	tunnelLog.Info("اتصال مجدد به درخواست API مدیریتی", "server", target)
+	requestReconnect(index)
+
+	admin.JSON(w, http.StatusAccepted, map[string]string{"reconnect": target})
+}
+
+// findServer یافتن سرور با شماره یا آدرس؛ -1 اگر پیدا نشود
+func findServer(value string) int {
+	if i, err := strconv.Atoi(value); err == nil {
+		if i >= 0 && i < len(config.Servers) {
+			return i
+		}
+		return -1
+	}
+	for i, server := range config.Servers {
+		if server.URL == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// cacheEntryInfo یک ورودی کش در پاسخ /cache
+type cacheEntryInfo struct {
+	Name      string  `json:"name"`
+	Size      int     `json:"size"`
+	ExpiresIn float64 `json:"expires_in"`
+}
+
+// adminCacheList فهرست ورودی‌های معتبر کش، با فیلتر اختیاری name یا suffix
+func adminCacheList(w http.ResponseWriter, r *http.Request) {
+	match, ok := cacheFilter(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	entries := []cacheEntryInfo{}
+	dnsCache.RLock()
+	for name, entry := range dnsCache.entries {
+		if now.After(entry.ExpiresAt) || !match(name) {
+			continue
+		}
+		entries = append(entries, cacheEntryInfo{
+			Name:      name,
+			Size:      len(entry.Data),
+			ExpiresIn: entry.ExpiresAt.Sub(now).Seconds(),
+		})
+	}
+	dnsCache.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	admin.JSON(w, http.StatusOK, entries)
+}
+
+// adminCacheFlush حذف همه ورودی‌های کش یا ورودی‌های منطبق با name یا suffix
+func adminCacheFlush(w http.ResponseWriter, r *http.Request) {
+	match, ok := cacheFilter(w, r)
+	if !ok {
+		return
+	}
+
+	flushed := 0
+	dnsCache.Lock()
+	for name := range dnsCache.entries {
+		if match(name) {
+			delete(dnsCache.entries, name)
+			flushed++
+		}
+	}
+	dnsCache.Unlock()
+
+	dnsLog.Info("پاکسازی کش از API مدیریتی", "flushed", flushed)
+	admin.JSON(w, http.StatusOK, map[string]int{"flushed": flushed})
+}
+
+// cacheFilter ساخت تابع تطبیق از پارامترهای name (دقیق) یا suffix (دامنه و زیردامنه‌ها)
+//
+// در صورت خطا پاسخ نوشته شده و ok برابر false است.
+func cacheFilter(w http.ResponseWriter, r *http.Request) (match func(string) bool, ok bool) {
+	if dnsCache == nil {
+		admin.Error(w, http.StatusConflict, "cache is disabled")
+		return nil, false
+	}
+
+	name, suffix := r.URL.Query().Get("name"), r.URL.Query().Get("suffix")
+	var entry string
+	switch {
+	case name != "" && suffix != "":
+		admin.Error(w, http.StatusBadRequest, "name and suffix are mutually exclusive")
+		return nil, false
+	case name != "":
+		entry = "full:" + name
+	case suffix != "":
+		entry = "domain:" + suffix
+	default:
+		return func(string) bool { return true }, true
+	}
+
+	list, err := domainlist.New(entry)
+	if err != nil {
+		admin.Error(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return list.Match, true
+}
+
+// adminStats شمارنده‌های کل و پنجره‌های متحرک
+func adminStats(w http.ResponseWriter, r *http.Request) {
+	admin.JSON(w, http.StatusOK, map[string]any{
+		"total":   stats.snapshot(),
+		"windows": rollingStats(),
+	})
+}
+
+// adminBlocklist آمار فهرست‌های مسدودسازی
+func adminBlocklist(w http.ResponseWriter, r *http.Request) {
+	filter := blocker.Load()
+	if filter == nil {
+		admin.Error(w, http.StatusNotFound, "blocklist disabled")
+		return
+	}
+	admin.JSON(w, http.StatusOK, filter.Status())
+}
+
+// adminReload بارگذاری مجدد تنظیمات؛ خطای اعتبارسنجی با 400 برگردانده می‌شود
+func adminReload(w http.ResponseWriter, r *http.Request) {
+	result, err := reloadConfig()
+	if err != nil {
+		admin.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	admin.JSON(w, http.StatusOK, result)
+}
+
+// reconnectRequests درخواست اتصال مجدد برای connectLoop؛ شماره سرور، -1 برای
+// سرور فعلی یا reconnectNext برای سرور بعدی
+var reconnectRequests = make(chan int, 1)
+
+// reconnectNext درخواست رفتن به سرور بعدی فهرست (پس از GoAway)
+const reconnectNext = -2
+
+// reconnectTarget شماره سروری که پس از درخواست اتصال مجدد استفاده می‌شود
+func reconnectTarget(current, request int) int {
+	switch {
+	case request >= 0:
+		return request
+	case request == reconnectNext:
+		return (current + 1) % len(config.Servers)
+	}
+	return current
+}
+
+// requestReconnect ثبت درخواست اتصال مجدد و بستن اتصال فعلی
+//
+// اگر تانل قطع باشد، connectLoop بدون انتظار reconnect_delay دوباره تلاش می‌کند.
+func requestReconnect(index int) {
+	select {
+	case <-reconnectRequests:
+	default:
+	}
+	select {
+	case reconnectRequests <- index:
+	default:
+	}
+
+	if atomic.LoadInt32(&connected) == 0 {
+		return
+	}
+	connMutex.RLock()
+	conn := tunnelConn
+	connMutex.RUnlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dns-forwarder/pkg/blocklist"
+)
+
+// blocker فهرست‌های مسدودسازی فعلی؛ Load برابر nil یعنی غیرفعال
+var blocker = blocklist.NewHolder(dnsLog)
+
+// blocklistHits شمارنده تطبیق هر فهرست
+func blocklistHits() string {
+	var out string
+	for _, l := range blocker.Load().Stats() {
+		if out != "" {
+			out += " "
+		}
+		out += fmt.Sprintf("%s=%d", l.Name, l.Hits)
+	}
+	return out
+}
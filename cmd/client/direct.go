@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/dns-forwarder/pkg/dnstap"
+	"github.com/dns-forwarder/pkg/tracing"
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var directClient *dns.Client
+
+// exchangeUpstreams ارسال درخواست به اولین resolver پاسخ‌دهنده از فهرست
+//
+// resolver پاسخ‌دهنده هم برگردانده می‌شود.
+func exchangeUpstreams(ctx context.Context, client *dns.Client, resolvers []string, r *dns.Msg) (*dns.Msg, string, error) {
+	var err error
+
+	for _, resolver := range resolvers {
+		var response *dns.Msg
+		var rtt time.Duration
+		ctx, span := tracer.Start(ctx, "upstream.exchange",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("dns.upstream", resolver)))
+
+		qtime := time.Now()
+		tap.LogForwarder(dnstap.ForwarderQuery, resolver, qtime, r, nil)
+		response, rtt, err = client.ExchangeContext(ctx, r, resolver)
+		tracing.End(span, err)
+		if err == nil {
+			metricUpstreamDuration.WithLabelValues(resolver).Observe(rtt.Seconds())
+			tap.LogForwarder(dnstap.ForwarderResponse, resolver, qtime, r, response)
+			return response, resolver, nil
+		}
+		dnsLog.Warn("خطا از resolver", "upstream", resolver, "error", err)
+	}
+
+	return nil, "", err
+}
+
+// resolveDirect ارسال درخواست به resolver مستقیم (بدون تانل)
+func resolveDirect(ctx context.Context, r *dns.Msg, queryName string) (*dns.Msg, string, error) {
+	response, upstream, err := exchangeUpstreams(ctx, directClient, live.Load().DirectResolvers, r)
+	if err != nil {
+		dnsLog.Warn("resolver مستقیم ناموفق", "qname", queryName, "error", err)
+		return nil, "", err
+	}
+
+	atomic.AddUint64(&stats.Direct, 1)
+	return response, upstream, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+)
+
+var fallbackClient *dns.Client
+
+// setupFallback آماده‌سازی resolver جایگزین
+func setupFallback() error {
+	fallbackClient = &dns.Client{
+		Net:     "udp",
+		Timeout: config.Fallback.Timeout,
+	}
+
+	lc := live.Load()
+	routingLog.Info("fallback فعال", "resolvers", lc.FallbackResolvers,
+		"allow", lc.FallbackAllow.Len(), "deny", lc.FallbackDeny.Len())
+
+	return nil
+}
+
+// canFallback بررسی اینکه درخواست اجازه خروج از تانل را دارد یا نه
+func canFallback(queryName string, err error) bool {
+	if !config.Fallback.Enabled {
+		return false
+	}
+
+	if errors.Is(err, errTimeout) && !config.Fallback.OnTimeout {
+		return false
+	}
+	// درخواست رهاشده با سیاست سرور نباید از مسیر دیگری حل شود
+	if errors.Is(err, errDropped) {
+		return false
+	}
+
+	lc := live.Load()
+	if lc.FallbackDeny.Match(queryName) {
+		return false
+	}
+
+	if lc.FallbackAllow.Len() > 0 && !lc.FallbackAllow.Match(queryName) {
+		return false
+	}
+
+	return true
+}
+
+// resolveFallback ارسال درخواست به resolver جایگزین خارج از تانل
+func resolveFallback(ctx context.Context, r *dns.Msg, queryName string, reason error) (*dns.Msg, string, error) {
+	response, upstream, err := exchangeUpstreams(ctx, fallbackClient, live.Load().FallbackResolvers, r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	atomic.AddUint64(&stats.Fallback, 1)
+	routingLog.Info("fallback از طریق resolver جایگزین", "qname", queryName, "reason", reason, "upstream", upstream)
+
+	return response, upstream, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+
+	"github.com/dns-forwarder/pkg/ipset"
+	"github.com/miekg/dns"
+)
+
+var (
+	geoipSet    atomic.Pointer[ipset.Set]
+	geoipDirect uint64
+	geoipTunnel uint64
+)
+
+type resolveResult struct {
+	response *dns.Msg
+	upstream string
+	err      error
+}
+
+// buildGeoIP ساخت بازه‌های IP داخلی از تنظیمات و فایل‌ها
+func buildGeoIP(cfg *Config) (*ipset.Set, error) {
+	set, err := ipset.New(cfg.Routing.GeoIP.CIDRs...)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range cfg.Routing.GeoIP.CIDRFiles {
+		if err := set.LoadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	set.Compact()
+	return set, nil
+}
+
+// storeGeoIP جایگزینی اتمیک بازه‌های IP داخلی
+func storeGeoIP(set *ipset.Set) {
+	geoipSet.Store(set)
+	routingLog.Info("بازه‌های IP داخلی بارگذاری شد", "count", set.Len())
+}
+
+// resolveGeoIP ارسال همزمان به تانل و resolver مستقیم و انتخاب پاسخ بر اساس IP
+//
+// اگر همه IPهای پاسخ مستقیم در بازه‌های داخلی باشند، همان پاسخ استفاده می‌شود؛
+// در غیر این صورت پاسخ تانل برگردانده می‌شود.
+func resolveGeoIP(ctx context.Context, r *dns.Msg, queryName string) (*dns.Msg, string, error) {
+	directChan := make(chan resolveResult, 1)
+	tunnelChan := make(chan resolveResult, 1)
+
+	go func() {
+		response, upstream, err := exchangeUpstreams(ctx, directClient, live.Load().DirectResolvers, r)
+		directChan <- resolveResult{response, upstream, err}
+	}()
+	go func() {
+		response, upstream, err := resolveViaTunnel(ctx, r, queryName)
+		tunnelChan <- resolveResult{response, upstream, err}
+	}()
+
+	direct := <-directChan
+	if direct.err == nil && isDomesticAnswer(direct.response) {
+		atomic.AddUint64(&geoipDirect, 1)
+		routingLog.Debug("geoip: پاسخ داخلی، استفاده از resolver مستقیم", "qname", queryName)
+		return direct.response, direct.upstream, nil
+	}
+
+	tunnel := <-tunnelChan
+	if tunnel.err == nil {
+		atomic.AddUint64(&geoipTunnel, 1)
+	}
+	return tunnel.response, tunnel.upstream, tunnel.err
+}
+
+// isDomesticAnswer بررسی اینکه پاسخ شامل IP است و همه IPها داخلی‌اند
+func isDomesticAnswer(response *dns.Msg) bool {
+	if response == nil || response.Rcode != dns.RcodeSuccess {
+		return false
+	}
+
+	set := geoipSet.Load()
+	found := false
+	for _, ans := range response.Answer {
+		var ip net.IP
+		switch rr := ans.(type) {
+		case *dns.A:
+			ip = rr.A
+		case *dns.AAAA:
+			ip = rr.AAAA
+		default:
+			continue
+		}
+		if !set.Contains(ip) {
+			return false
+		}
+		found = true
+	}
+
+	return found
+}
+
+// geoipHits آمار تصمیم‌های geoip
+func geoipHits() string {
+	return fmt.Sprintf("مستقیم=%d تانل=%d",
+		atomic.LoadUint64(&geoipDirect), atomic.LoadUint64(&geoipTunnel))
+}
+
+// geoipLookup بررسی آفلاین IPها در یک فایل بازه
+//
+// استفاده: dns-client geoip-lookup <file> <ip>...
+func geoipLookup(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "استفاده: geoip-lookup <file> <ip>...")
+		os.Exit(2)
+	}
+
+	set, err := ipset.New()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "خطا: %v\n", err)
+		os.Exit(1)
+	}
+	if err := set.LoadFile(args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "خطا در خواندن فایل: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("بازه‌ها: %d\n", set.Len())
+	for _, arg := range args[1:] {
+		ip := net.ParseIP(arg)
+		if ip == nil {
+			fmt.Printf("%s: IP نامعتبر\n", arg)
+			continue
+		}
+		fmt.Printf("%s: %v\n", arg, set.Contains(ip))
+	}
+}
+
+func init() {
+	// بررسی آفلاین فایل بازه‌های IP
+	if len(os.Args) > 1 && os.Args[1] == "geoip-lookup" {
+		geoipLookup(os.Args[2:])
+		os.Exit(0)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+
+	"github.com/dns-forwarder/pkg/doh"
+	"github.com/dns-forwarder/pkg/logging"
+	"github.com/miekg/dns"
+)
+
+// startSecureListeners راه‌اندازی شنونده‌های DoT و DoH محلی
+func startSecureListeners() {
+	if config.Listeners.DoT.Enabled {
+		cert, err := tls.LoadX509KeyPair(config.Listeners.DoT.TLSCert, config.Listeners.DoT.TLSKey)
+		if err != nil {
+			logging.Fatal(mainLog, "خطا در خواندن گواهی DoT", "error", err)
+		}
+
+		server := &dns.Server{
+			Addr: config.Listeners.DoT.Listen,
+			Net:  "tcp-tls",
+			TLSConfig: &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				MinVersion:   tls.VersionTLS12,
+			},
+			Handler: dns.HandlerFunc(handleDNSRequest),
+		}
+		dnsServers = append(dnsServers, server)
+
+		go func() {
+			mainLog.Info("DNS-over-TLS محلی فعال", "listen", config.Listeners.DoT.Listen)
+			if err := server.ListenAndServe(); err != nil && !shuttingDown() {
+				logging.Fatal(mainLog, "خطا در راه‌اندازی DoT", "error", err)
+			}
+		}()
+	}
+
+	if config.Listeners.DoH.Enabled {
+		mux := http.NewServeMux()
+		mux.Handle(config.Listeners.DoH.Path, &doh.Handler{DNS: dns.HandlerFunc(handleDNSRequest)})
+
+		server := &http.Server{
+			Addr:    config.Listeners.DoH.Listen,
+			Handler: mux,
+			TLSConfig: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+			},
+		}
+		dohServer = server
+
+		go func() {
+			mainLog.Info("DNS-over-HTTPS محلی فعال", "listen", config.Listeners.DoH.Listen, "path", config.Listeners.DoH.Path)
+			if err := server.ListenAndServeTLS(config.Listeners.DoH.TLSCert, config.Listeners.DoH.TLSKey); !errors.Is(err, http.ErrServerClosed) {
+				logging.Fatal(mainLog, "خطا در راه‌اندازی DoH", "error", err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/dns-forwarder/pkg/dnstap"
+	"github.com/dns-forwarder/pkg/localzone"
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// localZones داده‌های zone های محلی و hosts فعلی؛ nil یعنی غیرفعال
+var localZones atomic.Pointer[localzone.Store]
+
+// setupLocalZones بارگذاری zone های محلی و راه‌اندازی بررسی تغییر فایل‌ها
+func setupLocalZones() error {
+	// اثر انگشت پیش از خواندن گرفته می‌شود تا تغییر هم‌زمان از دست نرود
+	snapshot := localzone.Snapshot(config.LocalZones.Config)
+	s, err := localzone.Load(config.LocalZones.Config)
+	if err != nil {
+		return err
+	}
+	storeLocalZones(s)
+	go localZonesWatchLoop(snapshot)
+	return nil
+}
+
+// storeLocalZones جایگزینی داده‌های ساخته‌شده و ثبت zone ها
+func storeLocalZones(s *localzone.Store) {
+	localZones.Store(s)
+	for _, z := range s.Zones() {
+		dnsLog.Info("zone محلی بارگذاری شد", "zone", z.Origin, "serial", z.Serial, "records", z.Records)
+	}
+	if n := s.HostsEntries(); n > 0 {
+		dnsLog.Info("فایل‌های hosts بارگذاری شدند", "names", n)
+	}
+}
+
+// localZonesWatchLoop بارگذاری دوباره با تغییر اندازه یا زمان تغییر فایل‌ها
+func localZonesWatchLoop(last string) {
+	ticker := time.NewTicker(config.LocalZones.WatchInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		cfg := localZones.Load().Config()
+		snapshot := localzone.Snapshot(cfg)
+		if snapshot == last {
+			continue
+		}
+		last = snapshot
+
+		s, err := localzone.Load(cfg)
+		if err != nil {
+			dnsLog.Error("خطا در بارگذاری مجدد zone های محلی", "error", err)
+			continue
+		}
+		dnsLog.Info("تغییر فایل‌های zone محلی شناسایی شد")
+		storeLocalZones(s)
+	}
+}
+
+// answerLocal پاسخ از zone های محلی و hosts؛ false اگر نام محلی نباشد
+//
+// CNAME به نامی بیرون از داده‌های محلی از تانل دنبال می‌شود. پاسخ‌های محلی
+// در کش ذخیره نمی‌شوند تا تغییر فایل‌ها فوراً دیده شود.
+func answerLocal(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, client string, start time.Time) bool {
+	response, source, chase := localZones.Load().Answer(r)
+	if response == nil {
+		return false
+	}
+
+	upstream := ""
+	if chase != "" {
+		q := new(dns.Msg)
+		q.SetQuestion(chase, r.Question[0].Qtype)
+		q.RecursionDesired = true
+		chased, server, err := resolveViaTunnel(ctx, q, chase)
+		if errors.Is(err, errDropped) {
+			recordQuery(ctx, client, "local", "", server, r, nil, start)
+			return true
+		}
+		if err != nil {
+			response.Rcode = dns.RcodeServerFailure
+		} else {
+			response.Answer = append(response.Answer, chased.Answer...)
+			response.Ns = chased.Ns
+			response.Rcode = chased.Rcode
+			upstream = server
+		}
+	}
+
+	metricLocalAnswers.WithLabelValues(source).Inc()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("dns.local_zone", source))
+	dnsLog.Debug("پاسخ از zone محلی", "qname", r.Question[0].Name, "zone", source, "chase", chase)
+	recordQuery(ctx, client, "local", "", upstream, r, response, start)
+	tap.LogClient(dnstap.ClientResponse, w, start, r, response)
+	w.WriteMsg(response)
+	return true
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/dns-forwarder/pkg/logging"
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// لاگ‌گرهای بخش‌های کلاینت
+var (
+	mainLog    = logging.Component("main")
+	tunnelLog  = logging.Component("tunnel")
+	dnsLog     = logging.Component("dns")
+	routingLog = logging.Component("routing")
+	socksLog   = logging.Component("socks")
+	statsLog   = logging.Component("stats")
+)
+
+// queryLog لاگ جداگانه درخواست‌ها؛ nil یعنی غیرفعال
+var queryLog *logging.QueryLog
+
+// setupLogging تنظیم لاگ تشخیصی و لاگ درخواست‌ها
+func setupLogging() (err error) {
+	if err = logging.Setup(config.Log); err != nil {
+		return err
+	}
+	queryLog, err = logging.OpenQueryLog(config.QueryLog)
+	return err
+}
+
+// recordQuery ثبت متریک و لاگ یک درخواست پاسخ‌داده‌شده
+func recordQuery(ctx context.Context, client, route, cache, upstream string, r, response *dns.Msg, start time.Time) {
+	observeQuery(route, r, response)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("dns.route", route),
+		attribute.String("dns.rcode", rcodeName(response)),
+		attribute.String("dns.upstream", upstream),
+	)
+	if queryLog == nil {
+		return
+	}
+
+	entry := logging.NewQuery(r)
+	entry.Client = client
+	entry.RCode = rcodeName(response)
+	entry.Cache = cache
+	entry.Route = route
+	entry.Upstream = upstream
+	entry.Latency = time.Since(start)
+	queryLog.Log(entry)
+}
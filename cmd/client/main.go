@@ -1,10 +1,10 @@
 package main
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/hex"
+	"errors"
 	"flag"
-	"log"
 	"net"
 	"net/url"
 	"os"
@@ -12,34 +12,140 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/dns-forwarder/pkg/admin"
+	"github.com/dns-forwarder/pkg/blocklist"
 	"github.com/dns-forwarder/pkg/crypto"
+	"github.com/dns-forwarder/pkg/dnstap"
+	"github.com/dns-forwarder/pkg/localzone"
+	"github.com/dns-forwarder/pkg/logging"
+	"github.com/dns-forwarder/pkg/mux"
 	"github.com/dns-forwarder/pkg/protocol"
-	"github.com/gorilla/websocket"
+	"github.com/dns-forwarder/pkg/rpz"
+	"github.com/dns-forwarder/pkg/tracing"
+	"github.com/dns-forwarder/pkg/transport"
 	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/yaml.v3"
 )
 
 // Config تنظیمات کلاینت
 type Config struct {
 	Client struct {
-		DNSListen       string `yaml:"dns_listen"`
-		ServerURL       string `yaml:"server_url"`
-		Password        string `yaml:"password"`
-		Salt            string `yaml:"salt"`
-		InsecureSkipTLS bool   `yaml:"insecure_skip_tls"`
-		ReconnectDelay  time.Duration `yaml:"reconnect_delay"`
+		DNSListen       string            `yaml:"dns_listen"`
+		ServerURL       string            `yaml:"server_url"`
+		Password        string            `yaml:"password"`
+		Salt            string            `yaml:"salt"`
+		Transport       string            `yaml:"transport"`
+		PollURL         string            `yaml:"poll_url"`
+		LongPoll        time.Duration     `yaml:"long_poll"`
+		InsecureSkipTLS bool              `yaml:"insecure_skip_tls"`
+		Headers         map[string]string `yaml:"headers"`
+		ReconnectDelay  time.Duration     `yaml:"reconnect_delay"`
+		QueryTimeout    time.Duration     `yaml:"query_timeout"`
+		StatsInterval   time.Duration     `yaml:"stats_interval"`
+		ShutdownTimeout time.Duration     `yaml:"shutdown_timeout"`
 	} `yaml:"client"`
-	Cache struct {
+	Servers []ServerConfig `yaml:"servers"`
+	Cache   struct {
 		Enabled bool          `yaml:"enabled"`
 		TTL     time.Duration `yaml:"ttl"`
 		MaxSize int           `yaml:"max_size"`
 	} `yaml:"cache"`
+	Fallback struct {
+		Enabled   bool          `yaml:"enabled"`
+		Resolvers []string      `yaml:"resolvers"`
+		OnTimeout bool          `yaml:"on_timeout"`
+		Timeout   time.Duration `yaml:"timeout"`
+		Allow     []string      `yaml:"allow"`
+		Deny      []string      `yaml:"deny"`
+	} `yaml:"fallback"`
+	Routing struct {
+		Enabled         bool          `yaml:"enabled"`
+		DirectResolvers []string      `yaml:"direct_resolvers"`
+		Timeout         time.Duration `yaml:"timeout"`
+		ReloadInterval  time.Duration `yaml:"reload_interval"`
+		Rules           []RoutingRule `yaml:"rules"`
+		GeoIP           struct {
+			Enabled   bool     `yaml:"enabled"`
+			CIDRs     []string `yaml:"cidrs"`
+			CIDRFiles []string `yaml:"cidr_files"`
+		} `yaml:"geoip"`
+	} `yaml:"routing"`
+	Listeners struct {
+		DoT struct {
+			Enabled bool   `yaml:"enabled"`
+			Listen  string `yaml:"listen"`
+			TLSCert string `yaml:"tls_cert"`
+			TLSKey  string `yaml:"tls_key"`
+		} `yaml:"dot"`
+		DoH struct {
+			Enabled bool   `yaml:"enabled"`
+			Listen  string `yaml:"listen"`
+			Path    string `yaml:"path"`
+			TLSCert string `yaml:"tls_cert"`
+			TLSKey  string `yaml:"tls_key"`
+		} `yaml:"doh"`
+	} `yaml:"listeners"`
+	Batching struct {
+		Enabled  bool          `yaml:"enabled"`
+		Delay    time.Duration `yaml:"delay"`
+		MaxBytes int           `yaml:"max_bytes"`
+	} `yaml:"batching"`
+	Compression struct {
+		Enabled         bool `yaml:"enabled"`
+		OnlyWithPadding bool `yaml:"only_with_padding"`
+	} `yaml:"compression"`
+	Socks struct {
+		Enabled     bool          `yaml:"enabled"`
+		Listen      string        `yaml:"listen"`
+		Username    string        `yaml:"username"`
+		Password    string        `yaml:"password"`
+		OpenTimeout time.Duration `yaml:"open_timeout"`
+		Window      uint32        `yaml:"window"`
+	} `yaml:"socks"`
+	Metrics struct {
+		Enabled     bool          `yaml:"enabled"`
+		Listen      string        `yaml:"listen"`
+		Path        string        `yaml:"path"`
+		RTTInterval time.Duration `yaml:"rtt_interval"`
+	} `yaml:"metrics"`
+	Admin struct {
+		Enabled bool   `yaml:"enabled"`
+		Listen  string `yaml:"listen"`
+		Token   string `yaml:"token"`
+	} `yaml:"admin"`
+	Log       logging.Config         `yaml:"log"`
+	QueryLog  logging.QueryLogConfig `yaml:"query_log"`
+	Tracing   tracing.Config         `yaml:"tracing"`
+	Dnstap    dnstap.Config          `yaml:"dnstap"`
+	Blocklist struct {
+		Enabled          bool `yaml:"enabled"`
+		blocklist.Config `yaml:",inline"`
+	} `yaml:"blocklist"`
+	RPZ struct {
+		Enabled    bool `yaml:"enabled"`
+		rpz.Config `yaml:",inline"`
+	} `yaml:"rpz"`
+	LocalZones struct {
+		Enabled          bool `yaml:"enabled"`
+		localzone.Config `yaml:",inline"`
+	} `yaml:"local_zones"`
+	Obfuscation struct {
+		Padding       string        `yaml:"padding"`
+		PaddingSize   uint16        `yaml:"padding_size"`
+		Jitter        time.Duration `yaml:"jitter"`
+		CoverInterval time.Duration `yaml:"cover_interval"`
+	} `yaml:"obfuscation"`
 }
 
 // PendingRequest درخواست در انتظار
 type PendingRequest struct {
 	ResponseChan chan *protocol.Message
 	CreatedAt    time.Time
+	// Query پیام ارسال‌شده برای ارسال دوباره پس از اتصال به سرور دیگر
+	Query *protocol.Message
 }
 
 // DNSCache کش DNS
@@ -47,6 +153,7 @@ type DNSCache struct {
 	sync.RWMutex
 	entries map[string]*CacheEntry
 	maxSize int
+	ttl     time.Duration
 }
 
 // CacheEntry ورودی کش
@@ -56,17 +163,27 @@ type CacheEntry struct {
 }
 
 var (
-	configFile     = flag.String("config", "configs/client.yaml", "مسیر فایل تنظیمات")
-	config         Config
-	encryptor      *crypto.Encryptor
-	wsConn         *websocket.Conn
-	wsConnMutex    sync.RWMutex
-	writeMutex     sync.Mutex
-	pendingMutex   sync.RWMutex
+	configFile      = flag.String("config", "configs/client.yaml", "مسیر فایل تنظیمات")
+	config          Config
+	encryptor       *crypto.Encryptor
+	tunnelConn      transport.Conn
+	connMutex       sync.RWMutex
+	pendingMutex    sync.RWMutex
 	pendingRequests = make(map[uint32]*PendingRequest)
 	requestCounter  uint32
-	dnsCache       *DNSCache
-	connected      int32
+	dnsCache        *DNSCache
+	connected       int32
+	// activeServer سرور اتصال فعلی؛ nil هنگام قطع بودن تانل
+	activeServer atomic.Pointer[ServerConfig]
+	// connectedSince زمان برقراری اتصال فعلی (UnixNano)
+	connectedSince int64
+)
+
+var (
+	errNotConnected = errors.New("not connected to server")
+	errTimeout      = errors.New("tunnel query timeout")
+	// errDropped سرور درخواست را با قاعده DROP رها کرد؛ نباید پاسخ یا fallback داده شود
+	errDropped = errors.New("query dropped by server policy")
 )
 
 func main() {
@@ -74,18 +191,30 @@ func main() {
 
 	// خواندن تنظیمات
 	if err := loadConfig(*configFile); err != nil {
-		log.Fatalf("خطا در خواندن تنظیمات: %v", err)
+		logging.Fatal(mainLog, "خطا در خواندن تنظیمات", "error", err)
+	}
+	if err := setupLogging(); err != nil {
+		logging.Fatal(mainLog, "خطا در تنظیم لاگ", "error", err)
+	}
+	if err := setupDnstap(); err != nil {
+		logging.Fatal(mainLog, "خطا در راه‌اندازی dnstap", "error", err)
+	}
+	if err := setupTracing(); err != nil {
+		logging.Fatal(mainLog, "خطا در راه‌اندازی tracing", "error", err)
+	}
+	if err := setupReload(); err != nil {
+		logging.Fatal(mainLog, "خطا در تنظیمات", "error", err)
 	}
 
 	// ایجاد رمزنگار
 	salt, err := hex.DecodeString(config.Client.Salt)
 	if err != nil {
-		log.Fatalf("خطا در خواندن salt: %v", err)
+		logging.Fatal(mainLog, "خطا در خواندن salt", "error", err)
 	}
 
 	encryptor, err = crypto.NewEncryptor(config.Client.Password, salt)
 	if err != nil {
-		log.Fatalf("خطا در ایجاد رمزنگار: %v", err)
+		logging.Fatal(mainLog, "خطا در ایجاد رمزنگار", "error", err)
 	}
 
 	// ایجاد کش
@@ -93,118 +222,378 @@ func main() {
 		dnsCache = &DNSCache{
 			entries: make(map[string]*CacheEntry),
 			maxSize: config.Cache.MaxSize,
+			ttl:     config.Cache.TTL,
 		}
 		go cleanupCache()
 	}
 
+	// آماده‌سازی resolver جایگزین
+	if config.Fallback.Enabled {
+		if err := setupFallback(); err != nil {
+			logging.Fatal(mainLog, "خطا در تنظیمات fallback", "error", err)
+		}
+	}
+
+	// بارگذاری فهرست‌های مسدودسازی
+	if config.Blocklist.Enabled {
+		if err := blocker.Start(config.Blocklist.Config); err != nil {
+			logging.Fatal(mainLog, "خطا در فهرست‌های مسدودسازی", "error", err)
+		}
+	}
+
+	// بارگذاری zone های RPZ
+	if config.RPZ.Enabled {
+		if err := policy.Start(config.RPZ.Config); err != nil {
+			logging.Fatal(mainLog, "خطا در zone های RPZ", "error", err)
+		}
+	}
+
+	// بارگذاری zone های محلی و فایل‌های hosts
+	if config.LocalZones.Enabled {
+		if err := setupLocalZones(); err != nil {
+			logging.Fatal(mainLog, "خطا در zone های محلی", "error", err)
+		}
+	}
+
+	// بارگذاری قواعد مسیریابی
+	if config.Routing.Enabled {
+		if err := setupRouting(); err != nil {
+			logging.Fatal(mainLog, "خطا در قواعد مسیریابی", "error", err)
+		}
+	}
+
+	go statsLoop()
+
+	if config.Obfuscation.CoverInterval > 0 {
+		go coverLoop()
+	}
+
 	// اتصال به سرور
 	go connectLoop()
 
+	if config.Socks.Enabled {
+		startSocksListener()
+	}
+	if config.Metrics.Enabled {
+		startMetricsListener()
+	}
+	if config.Admin.Enabled {
+		startAdminListener()
+	}
+	if config.Metrics.Enabled || config.Admin.Enabled {
+		go heartbeatLoop()
+	}
+
 	// راه‌اندازی DNS server محلی
+	startSecureListeners()
 	startDNSServer()
+
+	waitShutdown()
 }
 
 func loadConfig(path string) error {
-	data, err := os.ReadFile(path)
+	cfg, err := parseConfig(path)
 	if err != nil {
 		return err
 	}
+	config = cfg
+	return nil
+}
+
+// parseConfig خواندن و اعتبارسنجی تنظیمات با مقادیر پیش‌فرض
+func parseConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
 
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return err
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, err
 	}
 
 	// مقادیر پیش‌فرض
-	if config.Client.DNSListen == "" {
-		config.Client.DNSListen = "127.0.0.1:53"
+	if cfg.Client.DNSListen == "" {
+		cfg.Client.DNSListen = "127.0.0.1:53"
+	}
+	if cfg.Client.Transport == "" {
+		cfg.Client.Transport = "websocket"
+	}
+	if cfg.Client.LongPoll == 0 {
+		cfg.Client.LongPoll = 25 * time.Second
+	}
+	if len(cfg.Servers) == 0 && cfg.Client.ServerURL != "" {
+		cfg.Servers = []ServerConfig{{
+			URL:       cfg.Client.ServerURL,
+			Transport: cfg.Client.Transport,
+			PollURL:   cfg.Client.PollURL,
+		}}
+	}
+	if len(cfg.Servers) == 0 {
+		return cfg, errors.New("no server configured")
+	}
+	for i := range cfg.Servers {
+		server := &cfg.Servers[i]
+		if server.Transport == "" {
+			server.Transport = cfg.Client.Transport
+		}
+		if server.PollURL == "" {
+			server.PollURL = derivePollURL(server.URL)
+		}
+	}
+	if cfg.Client.ReconnectDelay == 0 {
+		cfg.Client.ReconnectDelay = 5 * time.Second
+	}
+	if cfg.Client.QueryTimeout == 0 {
+		cfg.Client.QueryTimeout = 10 * time.Second
+	}
+	if cfg.Client.ShutdownTimeout == 0 {
+		cfg.Client.ShutdownTimeout = 10 * time.Second
+	}
+	if cfg.Client.StatsInterval == 0 {
+		cfg.Client.StatsInterval = 5 * time.Minute
+	}
+	if cfg.Cache.TTL == 0 {
+		cfg.Cache.TTL = 5 * time.Minute
+	}
+	if cfg.Cache.MaxSize == 0 {
+		cfg.Cache.MaxSize = 10000
+	}
+	if cfg.Fallback.Timeout == 0 {
+		cfg.Fallback.Timeout = 3 * time.Second
+	}
+	if cfg.Fallback.Enabled && len(cfg.Fallback.Resolvers) == 0 {
+		return cfg, errors.New("fallback enabled without resolvers")
 	}
-	if config.Client.ReconnectDelay == 0 {
-		config.Client.ReconnectDelay = 5 * time.Second
+	if cfg.Routing.Timeout == 0 {
+		cfg.Routing.Timeout = 3 * time.Second
 	}
-	if config.Cache.TTL == 0 {
-		config.Cache.TTL = 5 * time.Minute
+	if cfg.Routing.Enabled && len(cfg.Routing.DirectResolvers) == 0 {
+		return cfg, errors.New("routing enabled without direct_resolvers")
 	}
-	if config.Cache.MaxSize == 0 {
-		config.Cache.MaxSize = 10000
+	if _, err := protocol.ParsePaddingMode(cfg.Obfuscation.Padding); err != nil {
+		return cfg, err
+	}
+	if cfg.Batching.Delay == 0 {
+		cfg.Batching.Delay = 2 * time.Millisecond
+	}
+	if cfg.Batching.MaxBytes == 0 {
+		cfg.Batching.MaxBytes = 16 * 1024
+	}
+	if cfg.Metrics.Listen == "" {
+		cfg.Metrics.Listen = "127.0.0.1:9153"
+	}
+	if cfg.Metrics.Path == "" {
+		cfg.Metrics.Path = "/metrics"
+	}
+	if cfg.Metrics.RTTInterval == 0 {
+		cfg.Metrics.RTTInterval = 30 * time.Second
+	}
+	if cfg.Admin.Listen == "" {
+		cfg.Admin.Listen = "127.0.0.1:9154"
+	}
+	if cfg.Admin.Enabled {
+		if cfg.Admin.Token == "" {
+			return cfg, errors.New("admin enabled without token")
+		}
+		if err := admin.CheckListen(cfg.Admin.Listen); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.Socks.Listen == "" {
+		cfg.Socks.Listen = "127.0.0.1:1080"
+	}
+	if cfg.Socks.OpenTimeout == 0 {
+		cfg.Socks.OpenTimeout = 10 * time.Second
+	}
+	if cfg.Obfuscation.PaddingSize == 0 {
+		cfg.Obfuscation.PaddingSize = 256
+	}
+	if cfg.QueryLog.Output == "" {
+		cfg.QueryLog.Output = "stdout"
+	}
+	if cfg.Tracing.Endpoint == "" {
+		cfg.Tracing.Endpoint = "127.0.0.1:4318"
+	}
+	if cfg.Tracing.SampleRatio == 0 {
+		cfg.Tracing.SampleRatio = 1
+	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "dns-forwarder-client"
+	}
+	if cfg.Dnstap.Enabled && cfg.Dnstap.Output == "" {
+		return cfg, errors.New("dnstap enabled without output")
+	}
+	if cfg.Listeners.DoT.Listen == "" {
+		cfg.Listeners.DoT.Listen = ":853"
+	}
+	if cfg.Listeners.DoH.Listen == "" {
+		cfg.Listeners.DoH.Listen = ":443"
+	}
+	if cfg.Listeners.DoH.Path == "" {
+		cfg.Listeners.DoH.Path = "/dns-query"
 	}
 
-	return nil
+	if cfg.Blocklist.TTL == 0 {
+		cfg.Blocklist.TTL = 5 * time.Minute
+	}
+	if _, err := blocklist.ParseAction(cfg.Blocklist.Action); err != nil {
+		return cfg, err
+	}
+	if cfg.RPZ.Enabled && len(cfg.RPZ.Zones) == 0 {
+		return cfg, errors.New("rpz enabled without zones")
+	}
+	if cfg.LocalZones.WatchInterval == 0 {
+		cfg.LocalZones.WatchInterval = 5 * time.Second
+	}
+	if cfg.LocalZones.HostsTTL == 0 {
+		cfg.LocalZones.HostsTTL = time.Minute
+	}
+	if cfg.LocalZones.Enabled && len(cfg.LocalZones.Zones) == 0 && len(cfg.LocalZones.Hosts) == 0 {
+		return cfg, errors.New("local_zones enabled without zones or hosts")
+	}
+
+	if _, err := logging.ParseLevel(cfg.Log.Level); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
 }
 
 func connectLoop() {
+	i := 0
 	for {
-		err := connectToServer()
+		err := connectToServer(config.Servers[i])
+		atomic.StoreInt32(&connected, 0)
+		activeServer.Store(nil)
+		atomic.StoreInt64(&tunnelRTT, 0)
+		if closing() {
+			return
+		}
+		metricReconnects.Inc()
+
+		// اتصال به درخواست API مدیریتی یا پیام GoAway سرور بسته شده است
+		select {
+		case next := <-reconnectRequests:
+			i = reconnectTarget(i, next)
+			continue
+		default:
+		}
+
 		if err != nil {
-			log.Printf("⚠️ خطا در اتصال: %v", err)
+			tunnelLog.Warn("خطا در اتصال", "server", config.Servers[i].URL, "error", err)
+		}
+		i = (i + 1) % len(config.Servers)
+		tunnelLog.Info("تلاش مجدد برای اتصال", "delay", config.Client.ReconnectDelay)
+		select {
+		case next := <-reconnectRequests:
+			i = reconnectTarget(i, next)
+		case <-time.After(config.Client.ReconnectDelay):
 		}
-		atomic.StoreInt32(&connected, 0)
-		log.Printf("🔄 تلاش مجدد برای اتصال در %v...", config.Client.ReconnectDelay)
-		time.Sleep(config.Client.ReconnectDelay)
 	}
 }
 
-func connectToServer() error {
-	u, err := url.Parse(config.Client.ServerURL)
-	if err != nil {
+func connectToServer(server ServerConfig) error {
+	if _, err := url.Parse(server.URL); err != nil {
 		return err
 	}
 
-	dialer := websocket.Dialer{
-		HandshakeTimeout: 10 * time.Second,
-	}
+	tunnelLog.Info("در حال اتصال", "server", server.URL, "transport", server.Transport)
 
-	if config.Client.InsecureSkipTLS {
-		dialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	}
-
-	log.Printf("🔌 در حال اتصال به %s...", config.Client.ServerURL)
-
-	conn, _, err := dialer.Dial(u.String(), nil)
+	conn, err := dialServer(server)
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
 
-	wsConnMutex.Lock()
-	wsConn = conn
-	wsConnMutex.Unlock()
+	connMutex.Lock()
+	tunnelConn = conn
+	connMutex.Unlock()
 
+	activeServer.Store(&server)
+	atomic.StoreInt64(&connectedSince, time.Now().UnixNano())
 	atomic.StoreInt32(&connected, 1)
-	log.Printf("✅ متصل به سرور: %s", config.Client.ServerURL)
+	tunnelLog.Info("متصل به سرور", "server", server.URL)
+
+	sendHello()
+	resendPending()
+
+	streams.Store(mux.New(sendMessage, config.Socks.Window, nil))
+	defer func() {
+		streams.Swap(nil).Close()
+	}()
 
 	// شروع خواندن پیام‌ها
 	return readMessages(conn)
 }
 
-func readMessages(conn *websocket.Conn) error {
+func readMessages(conn transport.Conn) error {
+	var frames protocol.Reassembler
 	for {
-		messageType, encryptedData, err := conn.ReadMessage()
+		encryptedData, err := conn.ReadFrame()
 		if err != nil {
 			return err
 		}
 
-		if messageType != websocket.BinaryMessage {
-			continue
-		}
-
 		// رمزگشایی
-		data, err := encryptor.Decrypt(encryptedData)
+		metricTunnelBytes.WithLabelValues("in").Add(float64(len(encryptedData)))
+
+		frame, err := encryptor.Decrypt(encryptedData)
 		if err != nil {
-			log.Printf("⚠️ خطا در رمزگشایی: %v", err)
+			metricDecryptFailures.Inc()
+			tunnelLog.Warn("خطا در رمزگشایی", "error", err)
 			continue
 		}
 
 		// پردازش پیام
+		data, err := frames.Unwrap(frame)
+		if err != nil {
+			tunnelLog.Warn("خطا در پردازش پیام", "error", err)
+			continue
+		}
+		if data == nil {
+			// قطعه پیامی که هنوز کامل نشده است
+			continue
+		}
 		msg, err := protocol.Decode(data)
 		if err != nil {
-			log.Printf("⚠️ خطا در پردازش پیام: %v", err)
+			tunnelLog.Warn("خطا در پردازش پیام", "error", err)
 			continue
 		}
 
-		switch msg.Type {
-		case protocol.TypeDNSResponse:
-			handleDNSResponse(msg)
-		case protocol.TypeHeartbeatAck:
-			// heartbeat تایید شد
+		dispatchMessage(msg)
+	}
+}
+
+// dispatchMessage پردازش یک پیام دریافتی؛ پیام‌های دسته‌ای باز می‌شوند
+func dispatchMessage(msg *protocol.Message) {
+	switch msg.Type {
+	case protocol.TypeDNSResponse, protocol.TypeDNSDrop:
+		handleDNSResponse(msg)
+	case protocol.TypeHeartbeatAck:
+		handleHeartbeatAck()
+	case protocol.TypeHelloAck:
+		handleHelloAck(msg)
+	case protocol.TypeCover:
+		// ترافیک پوششی
+	case protocol.TypeGoAway:
+		handleGoAway(msg)
+	case protocol.TypeStreamData, protocol.TypeStreamWindow, protocol.TypeStreamClose:
+		if m := streams.Load(); m != nil {
+			m.Handle(msg)
+		}
+	case protocol.TypeDatagram:
+		handleDatagram(msg)
+	case protocol.TypeDatagramClose:
+		handleDatagramClose(msg)
+	case protocol.TypeBatch:
+		msgs, err := protocol.DecodeBatch(msg.Payload)
+		if err != nil {
+			tunnelLog.Warn("خطا در باز کردن پیام دسته‌ای", "error", err)
+			return
+		}
+		for _, inner := range msgs {
+			dispatchMessage(inner)
 		}
 	}
 }
@@ -224,63 +613,230 @@ func handleDNSResponse(msg *protocol.Message) {
 	}
 }
 
+// handleGoAway رفتن فوری به سرور بعدی هنگام خاموش شدن سرور فعلی
+//
+// درخواست‌های بی‌پاسخ پس از اتصال جدید دوباره فرستاده می‌شوند.
+func handleGoAway(msg *protocol.Message) {
+	server := activeServer.Load()
+	if server == nil {
+		return
+	}
+	tunnelLog.Info("سرور در حال خاموش شدن است؛ رفتن به سرور بعدی", "server", server.URL, "reason", string(msg.Payload))
+	requestReconnect(reconnectNext)
+}
+
+// resendPending ارسال دوباره درخواست‌های در انتظار روی اتصال جدید
+func resendPending() {
+	pendingMutex.RLock()
+	queries := make([]*protocol.Message, 0, len(pendingRequests))
+	for _, pending := range pendingRequests {
+		if pending.Query != nil {
+			queries = append(queries, pending.Query)
+		}
+	}
+	pendingMutex.RUnlock()
+
+	if len(queries) == 0 {
+		return
+	}
+	for _, msg := range queries {
+		if err := sendMessage(msg); err != nil {
+			tunnelLog.Warn("خطا در ارسال دوباره درخواست", "id", msg.RequestID, "error", err)
+		}
+	}
+	tunnelLog.Info("درخواست‌های در انتظار دوباره ارسال شدند", "count", len(queries))
+}
+
 func startDNSServer() {
 	server := &dns.Server{
 		Addr: config.Client.DNSListen,
 		Net:  "udp",
 	}
+	dnsServers = append(dnsServers, server)
 
 	dns.HandleFunc(".", handleDNSRequest)
 
-	log.Printf("🚀 سرور DNS محلی در حال اجرا روی %s", config.Client.DNSListen)
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("خطا در راه‌اندازی DNS server: %v", err)
-	}
+	mainLog.Info("سرور DNS محلی در حال اجرا", "listen", config.Client.DNSListen)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !shuttingDown() {
+			logging.Fatal(mainLog, "خطا در راه‌اندازی DNS server", "error", err)
+		}
+	}()
 }
 
 func handleDNSRequest(w dns.ResponseWriter, r *dns.Msg) {
+	// پس از شروع خاموش شدن درخواست جدید پذیرفته نمی‌شود
+	if !inflight.Enter() {
+		refused := new(dns.Msg)
+		refused.SetRcode(r, dns.RcodeRefused)
+		w.WriteMsg(refused)
+		return
+	}
+	defer inflight.Leave()
+
 	var queryName string
 	if len(r.Question) > 0 {
 		queryName = r.Question[0].Name
 	}
 
+	atomic.AddUint64(&stats.Queries, 1)
+	client := w.RemoteAddr().String()
+	start := time.Now()
+	tap.LogClient(dnstap.ClientQuery, w, start, r, nil)
+
+	ctx, span := tracer.Start(context.Background(), "dns.request",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(tracing.QueryAttributes(r)...))
+	defer span.End()
+
+	// فهرست‌های مسدودسازی پیش از کش و مسیریابی
+	filter := blocker.Load()
+	if list := filter.Check(queryName); list != "" {
+		response := filter.Block(r)
+		atomic.AddUint64(&stats.Blocked, 1)
+		metricBlocked.WithLabelValues(list).Inc()
+		span.SetAttributes(attribute.String("dns.blocklist", list))
+		dnsLog.Debug("درخواست مسدود شد", "qname", queryName, "list", list)
+		recordQuery(ctx, client, "blocked", "", "", r, response, start)
+		tap.LogClient(dnstap.ClientResponse, w, start, r, response)
+		w.WriteMsg(response)
+		return
+	}
+
+	// قواعد RPZ نام درخواست و آدرس کلاینت
+	handled, passthru := checkQueryPolicy(ctx, w, r, client, start)
+	if handled {
+		return
+	}
+
+	// zone های محلی و hosts بدون استفاده از کش و تانل
+	if answerLocal(ctx, w, r, client, start) {
+		return
+	}
+
 	// بررسی کش
+	cache := ""
 	if config.Cache.Enabled {
-		if cached := getCached(queryName); cached != nil {
+		_, cacheSpan := tracer.Start(ctx, "cache.lookup")
+		cached := getCached(queryName)
+		cacheSpan.SetAttributes(attribute.Bool("cache.hit", cached != nil))
+		cacheSpan.End()
+
+		if cached != nil {
 			response := new(dns.Msg)
 			if err := response.Unpack(cached); err == nil {
 				response.Id = r.Id
+				if !passthru && checkResponsePolicy(ctx, w, r, response, client, start) {
+					return
+				}
+				tap.LogClient(dnstap.ClientResponse, w, start, r, response)
 				w.WriteMsg(response)
-				log.Printf("📦 کش: %s", queryName)
+				atomic.AddUint64(&stats.CacheHits, 1)
+				metricCacheLookups.WithLabelValues("hit").Inc()
+				recordQuery(ctx, client, "cache", "hit", "", r, response, start)
 				return
 			}
 		}
+		metricCacheLookups.WithLabelValues("miss").Inc()
+		cache = "miss"
 	}
 
-	// بررسی اتصال
-	if atomic.LoadInt32(&connected) == 0 {
-		log.Printf("❌ عدم اتصال به سرور برای: %s", queryName)
-		response := new(dns.Msg)
+	route := RouteTunnel
+	if config.Routing.Enabled {
+		var rule string
+		route, rule = router.Load().Route(queryName)
+		if rule == "" && config.Routing.GeoIP.Enabled {
+			route = RouteGeoIP
+		}
+	}
+
+	var response *dns.Msg
+	var upstream string
+	var err error
+	switch route {
+	case RouteDirect:
+		response, upstream, err = resolveDirect(ctx, r, queryName)
+	case RouteGeoIP:
+		response, upstream, err = resolveGeoIP(ctx, r, queryName)
+		if err != nil && canFallback(queryName, err) {
+			response, upstream, err = resolveFallback(ctx, r, queryName, err)
+			route = RouteFallback
+		}
+	default:
+		response, upstream, err = resolveViaTunnel(ctx, r, queryName)
+		if err != nil && canFallback(queryName, err) {
+			response, upstream, err = resolveFallback(ctx, r, queryName, err)
+			route = RouteFallback
+		}
+	}
+
+	metricResolveDuration.WithLabelValues(route.String()).Observe(time.Since(start).Seconds())
+
+	if errors.Is(err, errDropped) {
+		recordQuery(ctx, client, route.String(), cache, upstream, r, nil, start)
+		return
+	}
+	if err != nil {
+		atomic.AddUint64(&stats.Failures, 1)
+		response = new(dns.Msg)
 		response.SetReply(r)
 		response.Rcode = dns.RcodeServerFailure
+		span.SetStatus(codes.Error, err.Error())
+		recordQuery(ctx, client, route.String(), cache, upstream, r, response, start)
+		tap.LogClient(dnstap.ClientResponse, w, start, r, response)
 		w.WriteMsg(response)
 		return
 	}
+	// پاسخ جایگزین RPZ در کش ذخیره نمی‌شود
+	if !passthru && checkResponsePolicy(ctx, w, r, response, client, start) {
+		return
+	}
+	recordQuery(ctx, client, route.String(), cache, upstream, r, response, start)
+
+	// ذخیره در کش؛ پاسخ resolver جایگزین کش نمی‌شود تا پس از برگشت تانل دیده نشود
+	if config.Cache.Enabled && route != RouteFallback && response.Rcode == dns.RcodeSuccess {
+		if data, err := response.Pack(); err == nil {
+			setCache(queryName, data)
+		}
+	}
+
+	response.Id = r.Id
+	tap.LogClient(dnstap.ClientResponse, w, start, r, response)
+	w.WriteMsg(response)
+}
+
+// resolveViaTunnel ارسال درخواست از طریق تانل و انتظار برای پاسخ
+//
+// upstream برگردانده‌شده آدرس سرور تانل است. زمینه trace همراه پیام ارسال
+// می‌شود تا span های سرور زیر همین درخواست قرار بگیرند.
+func resolveViaTunnel(ctx context.Context, r *dns.Msg, queryName string) (_ *dns.Msg, _ string, err error) {
+	ctx, span := tracer.Start(ctx, "tunnel.exchange", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { tracing.End(span, err) }()
+
+	// بررسی اتصال
+	server := activeServer.Load()
+	if atomic.LoadInt32(&connected) == 0 || server == nil {
+		dnsLog.Warn("عدم اتصال به سرور", "qname", queryName)
+		return nil, "", errNotConnected
+	}
 
 	// ایجاد درخواست
 	requestID := atomic.AddUint32(&requestCounter, 1)
 	dnsData, err := r.Pack()
 	if err != nil {
-		log.Printf("⚠️ خطا در pack درخواست: %v", err)
-		return
+		dnsLog.Warn("خطا در pack درخواست", "qname", queryName, "error", err)
+		return nil, "", err
 	}
 
 	msg := protocol.NewDNSQuery(requestID, dnsData)
+	msg.Trace = tracing.Inject(ctx)
+	span.SetAttributes(attribute.String("tunnel.server", server.URL), attribute.Int64("tunnel.request_id", int64(requestID)))
 
 	// ثبت درخواست در انتظار
 	pending := &PendingRequest{
 		ResponseChan: make(chan *protocol.Message, 1),
 		CreatedAt:    time.Now(),
+		Query:        msg,
 	}
 
 	pendingMutex.Lock()
@@ -294,73 +850,67 @@ func handleDNSRequest(w dns.ResponseWriter, r *dns.Msg) {
 	}()
 
 	// ارسال درخواست
-	if err := sendMessage(msg); err != nil {
-		log.Printf("⚠️ خطا در ارسال درخواست: %v", err)
-		response := new(dns.Msg)
-		response.SetReply(r)
-		response.Rcode = dns.RcodeServerFailure
-		w.WriteMsg(response)
-		return
+	sendJitter()
+	if err := sendQuery(msg); err != nil {
+		dnsLog.Warn("خطا در ارسال درخواست", "qname", queryName, "error", err)
+		return nil, "", err
 	}
 
-	log.Printf("🔍 درخواست: %s (ID: %d)", queryName, requestID)
+	dnsLog.Debug("درخواست از طریق تانل", "qname", queryName, "id", requestID)
 
 	// انتظار برای پاسخ
 	select {
 	case responseMsg := <-pending.ResponseChan:
+		if responseMsg.Type == protocol.TypeDNSDrop {
+			dnsLog.Debug("درخواست با سیاست سرور رها شد", "qname", queryName)
+			return nil, server.URL, errDropped
+		}
 		response := new(dns.Msg)
 		if err := response.Unpack(responseMsg.Payload); err != nil {
-			log.Printf("⚠️ خطا در unpack پاسخ: %v", err)
-			return
-		}
-
-		// ذخیره در کش
-		if config.Cache.Enabled && response.Rcode == dns.RcodeSuccess {
-			setCache(queryName, responseMsg.Payload)
+			dnsLog.Warn("خطا در unpack پاسخ", "qname", queryName, "error", err)
+			return nil, server.URL, err
 		}
+		atomic.AddUint64(&stats.Tunnel, 1)
+		return response, server.URL, nil
 
-		// لاگ پاسخ
-		if len(response.Answer) > 0 {
-			for _, ans := range response.Answer {
-				if a, ok := ans.(*dns.A); ok {
-					log.Printf("✅ پاسخ: %s -> %s", queryName, a.A.String())
-				}
-			}
-		}
-
-		response.Id = r.Id
-		w.WriteMsg(response)
-
-	case <-time.After(10 * time.Second):
-		log.Printf("⏱️ تایم‌اوت برای: %s", queryName)
-		response := new(dns.Msg)
-		response.SetReply(r)
-		response.Rcode = dns.RcodeServerFailure
-		w.WriteMsg(response)
+	case <-time.After(config.Client.QueryTimeout):
+		dnsLog.Warn("تایم‌اوت درخواست", "qname", queryName)
+		return nil, server.URL, errTimeout
 	}
 }
 
 func sendMessage(msg *protocol.Message) error {
-	data := msg.Encode()
-
-	encryptedData, err := encryptor.Encrypt(data)
-	if err != nil {
-		return err
+	if len(msg.Trace) > 0 {
+		_, span := tracer.Start(tracing.Extract(context.Background(), msg.Trace), "tunnel.send",
+			trace.WithAttributes(attribute.Int64("tunnel.request_id", int64(msg.RequestID))))
+		defer span.End()
 	}
 
-	wsConnMutex.RLock()
-	conn := wsConn
-	wsConnMutex.RUnlock()
+	encoded := msg.Encode()
+	frames := codec.Load().Wrap(encoded)
+
+	connMutex.RLock()
+	conn := tunnelConn
+	connMutex.RUnlock()
 
 	if conn == nil {
 		return nil
 	}
 
-	writeMutex.Lock()
-	err = conn.WriteMessage(websocket.BinaryMessage, encryptedData)
-	writeMutex.Unlock()
-
-	return err
+	atomic.StoreInt64(&lastSend, time.Now().UnixNano())
+	atomic.AddUint64(&stats.PayloadBytes, uint64(len(encoded)))
+	for _, data := range frames {
+		encryptedData, err := encryptor.Encrypt(data)
+		if err != nil {
+			return err
+		}
+		atomic.AddUint64(&stats.FrameBytes, uint64(len(data)))
+		metricTunnelBytes.WithLabelValues("out").Add(float64(len(encryptedData)))
+		if err := conn.WriteFrame(encryptedData); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func getCached(key string) []byte {
@@ -394,7 +944,21 @@ func setCache(key string, data []byte) {
 
 	dnsCache.entries[key] = &CacheEntry{
 		Data:      data,
-		ExpiresAt: time.Now().Add(config.Cache.TTL),
+		ExpiresAt: time.Now().Add(dnsCache.ttl),
+	}
+}
+
+// resize تغییر محدودیت‌های کش؛ ورودی‌های اضافه حذف می‌شوند و TTL جدید برای ورودی‌های بعدی است
+func (c *DNSCache) resize(maxSize int, ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.maxSize, c.ttl = maxSize, ttl
+	for key := range c.entries {
+		if len(c.entries) <= maxSize {
+			break
+		}
+		delete(c.entries, key)
 	}
 }
 
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/dns-forwarder/pkg/logging"
+	"github.com/dns-forwarder/pkg/protocol"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "dnsforwarder_client"
+
+var (
+	metricQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "queries_total",
+		Help:      "DNS queries answered, by route, query type and response code.",
+	}, []string{"route", "qtype", "rcode"})
+
+	metricCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_lookups_total",
+		Help:      "Local cache lookups by result (hit or miss).",
+	}, []string{"result"})
+
+	metricResolveDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "resolve_duration_seconds",
+		Help:      "Time to resolve a query, by route.",
+		Buckets:   prometheus.ExponentialBuckets(0.002, 2, 12),
+	}, []string{"route"})
+
+	metricBlocked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "blocked_total",
+		Help:      "Queries answered from a blocklist, by list.",
+	}, []string{"list"})
+
+	metricRPZHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rpz_hits_total",
+		Help:      "Response policy zone rules fired, by zone, trigger and action.",
+	}, []string{"zone", "trigger", "action"})
+
+	metricLocalAnswers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "local_answers_total",
+		Help:      "Queries answered from local zones or hosts files, by zone.",
+	}, []string{"zone"})
+
+	metricUpstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_duration_seconds",
+		Help:      "Round trip time of direct and fallback resolvers.",
+		Buckets:   prometheus.ExponentialBuckets(0.002, 2, 12),
+	}, []string{"upstream"})
+
+	metricTunnelRTT = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "tunnel_rtt_seconds",
+		Help:      "Heartbeat round trip time through the tunnel.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	})
+
+	metricReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconnects_total",
+		Help:      "Tunnel connection attempts after a disconnect or failure.",
+	})
+
+	metricDecryptFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "decrypt_failures_total",
+		Help:      "Frames from the server that failed to decrypt.",
+	})
+
+	metricTunnelBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tunnel_bytes_total",
+		Help:      "Encrypted bytes sent and received on the tunnel.",
+	}, []string{"direction"})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "pending_requests",
+		Help:      "Tunnel queries waiting for a response.",
+	}, func() float64 {
+		pendingMutex.RLock()
+		defer pendingMutex.RUnlock()
+		return float64(len(pendingRequests))
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "connected",
+		Help:      "Whether the tunnel is currently connected (1) or not (0).",
+	}, func() float64 {
+		return float64(atomic.LoadInt32(&connected))
+	})
+
+	_ = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dnstap_dropped_total",
+		Help:      "dnstap messages dropped because the output queue was full or failed.",
+	}, func() float64 {
+		return float64(tap.Dropped())
+	})
+)
+
+var (
+	// lastHeartbeat زمان ارسال آخرین heartbeat برای محاسبه RTT
+	lastHeartbeat int64
+	// tunnelRTT آخرین RTT اندازه‌گیری‌شده تانل (نانوثانیه)؛ صفر یعنی نامعلوم
+	tunnelRTT int64
+)
+
+// startMetricsListener راه‌اندازی شنونده HTTP برای /metrics
+func startMetricsListener() {
+	mux := http.NewServeMux()
+	mux.Handle(config.Metrics.Path, promhttp.Handler())
+
+	mainLog.Info("metrics فعال", "listen", config.Metrics.Listen, "path", config.Metrics.Path)
+	go func() {
+		if err := http.ListenAndServe(config.Metrics.Listen, mux); err != nil {
+			logging.Fatal(mainLog, "خطا در راه‌اندازی metrics", "error", err)
+		}
+	}()
+}
+
+// heartbeatLoop ارسال دوره‌ای heartbeat برای اندازه‌گیری RTT تانل
+func heartbeatLoop() {
+	ticker := time.NewTicker(config.Metrics.RTTInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if atomic.LoadInt32(&connected) == 0 {
+			continue
+		}
+		atomic.StoreInt64(&lastHeartbeat, time.Now().UnixNano())
+		sendMessage(protocol.NewHeartbeat())
+	}
+}
+
+// handleHeartbeatAck ثبت RTT تانل
+func handleHeartbeatAck() {
+	if sent := atomic.SwapInt64(&lastHeartbeat, 0); sent > 0 {
+		rtt := time.Since(time.Unix(0, sent))
+		atomic.StoreInt64(&tunnelRTT, int64(rtt))
+		metricTunnelRTT.Observe(rtt.Seconds())
+	}
+}
+
+// observeQuery ثبت یک درخواست پاسخ‌داده‌شده
+func observeQuery(route string, r, response *dns.Msg) {
+	qtype := ""
+	if len(r.Question) > 0 {
+		qtype = dns.TypeToString[r.Question[0].Qtype]
+	}
+	metricQueries.WithLabelValues(route, qtype, rcodeName(response)).Inc()
+}
+
+// rcodeName نام rcode پاسخ؛ DROP برای درخواستی که با RPZ رها شد
+func rcodeName(response *dns.Msg) string {
+	if response == nil {
+		return "DROP"
+	}
+	return dns.RcodeToString[response.Rcode]
+}
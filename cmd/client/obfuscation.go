@@ -0,0 +1,112 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/dns-forwarder/pkg/protocol"
+)
+
+var (
+	// codec گزینه‌های مذاکره‌شده اتصال فعلی (nil تا پیش از دریافت HelloAck)
+	codec atomic.Pointer[protocol.Codec]
+	// batcher صف پیام‌های دسته‌ای اتصال فعلی (nil اگر مذاکره نشده باشد)
+	batcher atomic.Pointer[protocol.Batcher]
+	// lastSend زمان آخرین ارسال برای تشخیص بیکاری
+	lastSend int64
+)
+
+// requestedOptions گزینه‌های پیشنهادی کلاینت از تنظیمات
+func requestedOptions() protocol.Options {
+	mode, _ := protocol.ParsePaddingMode(config.Obfuscation.Padding)
+	opts := protocol.Options{
+		Padding:     mode,
+		PaddingSize: config.Obfuscation.PaddingSize,
+		Cover:       config.Obfuscation.CoverInterval > 0,
+		Batch:       config.Batching.Enabled,
+	}
+
+	// فشرده‌سازی بدون padding طول واقعی داده را نشت می‌دهد
+	if config.Compression.Enabled {
+		if !config.Compression.OnlyWithPadding || mode == protocol.PaddingBucket || mode == protocol.PaddingFixed {
+			opts.Compression = protocol.CompressionDeflate
+		}
+	}
+
+	return opts
+}
+
+// sendHello پیشنهاد گزینه‌های نشست پس از اتصال
+func sendHello() {
+	codec.Store(nil)
+	batcher.Store(nil)
+
+	opts := requestedOptions()
+	if opts.Empty() {
+		return
+	}
+
+	if err := sendMessage(protocol.NewHello(opts)); err != nil {
+		tunnelLog.Warn("خطا در ارسال گزینه‌های نشست", "error", err)
+	}
+}
+
+// handleHelloAck فعال‌سازی گزینه‌های پذیرفته‌شده توسط سرور
+func handleHelloAck(msg *protocol.Message) {
+	opts, err := protocol.DecodeOptions(msg.Payload)
+	if err != nil {
+		tunnelLog.Warn("خطا در خواندن گزینه‌های نشست", "error", err)
+		return
+	}
+
+	codec.Store(protocol.NewCodec(opts))
+	if opts.Batch {
+		batcher.Store(protocol.NewBatcher(config.Batching.Delay, config.Batching.MaxBytes, func(msg *protocol.Message) {
+			if err := sendMessage(msg); err != nil {
+				tunnelLog.Warn("خطا در ارسال پیام دسته‌ای", "error", err)
+			}
+		}))
+	}
+	tunnelLog.Info("گزینه‌های نشست", "padding", opts.Padding, "padding_size", opts.PaddingSize,
+		"cover", opts.Cover, "batch", opts.Batch, "compression", opts.Compression)
+}
+
+// sendQuery ارسال درخواست DNS، در صورت مذاکره از طریق batcher
+func sendQuery(msg *protocol.Message) error {
+	if b := batcher.Load(); b != nil {
+		b.Add(msg)
+		return nil
+	}
+	return sendMessage(msg)
+}
+
+// sendJitter تاخیر تصادفی قبل از ارسال
+func sendJitter() {
+	if config.Obfuscation.Jitter > 0 {
+		time.Sleep(time.Duration(protocol.RandomInt(int(config.Obfuscation.Jitter))))
+	}
+}
+
+// coverLoop ارسال ترافیک پوششی در زمان بیکاری
+func coverLoop() {
+	interval := config.Obfuscation.CoverInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if atomic.LoadInt32(&connected) == 0 || !codec.Load().Options().Cover {
+			continue
+		}
+		if time.Since(time.Unix(0, atomic.LoadInt64(&lastSend))) < interval {
+			continue
+		}
+
+		// فاصله تصادفی تا الگوی زمانی منظم ایجاد نشود
+		time.Sleep(time.Duration(protocol.RandomInt(int(interval))))
+
+		size := protocol.RandomInt(int(config.Obfuscation.PaddingSize) + 1)
+		if err := sendMessage(protocol.NewCover(size)); err == nil {
+			atomic.AddUint64(&stats.CoverBytes, uint64(size))
+		}
+	}
+}
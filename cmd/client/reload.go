@@ -0,0 +1,224 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/dns-forwarder/pkg/blocklist"
+	"github.com/dns-forwarder/pkg/domainlist"
+	"github.com/dns-forwarder/pkg/ipset"
+	"github.com/dns-forwarder/pkg/localzone"
+	"github.com/dns-forwarder/pkg/logging"
+	"github.com/dns-forwarder/pkg/reload"
+	"github.com/dns-forwarder/pkg/rpz"
+)
+
+// liveConfig تنظیماتی که بدون راه‌اندازی مجدد عوض می‌شوند
+type liveConfig struct {
+	DirectResolvers   []string
+	FallbackResolvers []string
+	FallbackAllow     *domainlist.List
+	FallbackDeny      *domainlist.List
+	Rules             []RoutingRule
+}
+
+// live تنظیمات فعلی قابل تغییر؛ با بارگذاری مجدد به صورت اتمیک جایگزین می‌شود
+var live atomic.Pointer[liveConfig]
+
+// liveSettings مسیرهای تنظیماتی که با بارگذاری مجدد اعمال می‌شوند
+var liveSettings = []string{
+	"routing.rules",
+	"routing.direct_resolvers",
+	"routing.geoip.cidrs",
+	"routing.geoip.cidr_files",
+	"fallback.resolvers",
+	"fallback.allow",
+	"fallback.deny",
+	"cache.ttl",
+	"cache.max_size",
+	"blocklist.action",
+	"blocklist.ttl",
+	"blocklist.allow",
+	"blocklist.allow_files",
+	"blocklist.lists",
+	"rpz.zones",
+	"local_zones.hosts_ttl",
+	"local_zones.hosts",
+	"local_zones.zones",
+	"log.level",
+}
+
+var (
+	// reloadMu جلوگیری از اجرای همزمان دو بارگذاری مجدد
+	reloadMu sync.Mutex
+	// loaded آخرین تنظیمات خوانده‌شده از فایل
+	loaded Config
+)
+
+// applicableSettings مسیرهای liveSettings که در این اجرا اعمال می‌شوند
+//
+// تنظیمات بخشی که هنگام شروع غیرفعال بوده (مثلاً cache وقتی کش خاموش است)
+// فقط با راه‌اندازی مجدد اثر دارند.
+func applicableSettings() []string {
+	var disabled []string
+	if dnsCache == nil {
+		disabled = append(disabled, "cache")
+	}
+	if !config.Routing.Enabled {
+		disabled = append(disabled, "routing")
+	} else if !config.Routing.GeoIP.Enabled {
+		disabled = append(disabled, "routing.geoip")
+	}
+	if !config.Fallback.Enabled {
+		disabled = append(disabled, "fallback")
+	}
+	if !config.Blocklist.Enabled {
+		disabled = append(disabled, "blocklist")
+	}
+	if !config.RPZ.Enabled {
+		disabled = append(disabled, "rpz")
+	}
+	if !config.LocalZones.Enabled {
+		disabled = append(disabled, "local_zones")
+	}
+	return reload.Exclude(liveSettings, disabled)
+}
+
+// newLiveConfig ساخت تنظیمات قابل تغییر از روی تنظیمات کامل
+func newLiveConfig(cfg *Config) (*liveConfig, error) {
+	allow, err := domainlist.New(cfg.Fallback.Allow...)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := domainlist.New(cfg.Fallback.Deny...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &liveConfig{
+		DirectResolvers:   cfg.Routing.DirectResolvers,
+		FallbackResolvers: cfg.Fallback.Resolvers,
+		FallbackAllow:     allow,
+		FallbackDeny:      deny,
+		Rules:             cfg.Routing.Rules,
+	}, nil
+}
+
+// setupReload آماده‌سازی تنظیمات قابل تغییر و بارگذاری مجدد با SIGHUP
+func setupReload() error {
+	lc, err := newLiveConfig(&config)
+	if err != nil {
+		return err
+	}
+	live.Store(lc)
+	loaded = config
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			reloadConfig()
+		}
+	}()
+	return nil
+}
+
+// reloadConfig خواندن دوباره فایل تنظیمات و اعمال تغییرات قابل اعمال
+//
+// تنظیمات جدید پیش از اعمال کامل اعتبارسنجی می‌شوند؛ در صورت خطا هیچ تغییری
+// اعمال نمی‌شود. اتصال تانل و محتوای کش حفظ می‌شوند.
+func reloadConfig() (reload.Result, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	next, err := parseConfig(*configFile)
+	if err != nil {
+		mainLog.Error("خطا در بارگذاری مجدد تنظیمات", "error", err)
+		return reload.Result{}, err
+	}
+	lc, err := newLiveConfig(&next)
+	if err != nil {
+		mainLog.Error("خطا در بارگذاری مجدد تنظیمات", "error", err)
+		return reload.Result{}, err
+	}
+
+	var rt *Router
+	var geoip *ipset.Set
+	if config.Routing.Enabled {
+		if rt, err = buildRouter(lc.Rules, router.Load()); err != nil {
+			mainLog.Error("خطا در بارگذاری مجدد تنظیمات", "error", err)
+			return reload.Result{}, err
+		}
+		if config.Routing.GeoIP.Enabled {
+			if geoip, err = buildGeoIP(&next); err != nil {
+				mainLog.Error("خطا در بارگذاری مجدد تنظیمات", "error", err)
+				return reload.Result{}, err
+			}
+		}
+	}
+
+	var filter *blocklist.Filter
+	if config.Blocklist.Enabled {
+		if filter, err = blocklist.Load(next.Blocklist.Config, blocker.Load()); err != nil {
+			mainLog.Error("خطا در بارگذاری مجدد تنظیمات", "error", err)
+			return reload.Result{}, err
+		}
+	}
+
+	// فایل‌های RPZ با هر بارگذاری مجدد دوباره خوانده می‌شوند
+	var zones *rpz.Policy
+	if config.RPZ.Enabled {
+		if zones, err = rpz.Load(next.RPZ.Config); err != nil {
+			mainLog.Error("خطا در بارگذاری مجدد تنظیمات", "error", err)
+			return reload.Result{}, err
+		}
+	}
+
+	var local *localzone.Store
+	if config.LocalZones.Enabled {
+		if local, err = localzone.Load(next.LocalZones.Config); err != nil {
+			mainLog.Error("خطا در بارگذاری مجدد تنظیمات", "error", err)
+			return reload.Result{}, err
+		}
+	}
+
+	// اعمال
+	live.Store(lc)
+	if filter != nil {
+		blocker.Store(filter)
+	}
+	if zones != nil {
+		policy.Store(zones)
+	}
+	if local != nil {
+		storeLocalZones(local)
+	}
+	if rt != nil {
+		router.Store(rt)
+		for _, rule := range rt.rules {
+			routingLog.Info("قاعده مسیریابی بارگذاری شد", "rule", rule.name, "entries", rule.list.Len())
+		}
+	}
+	if geoip != nil {
+		storeGeoIP(geoip)
+	}
+	if dnsCache != nil {
+		dnsCache.resize(next.Cache.MaxSize, next.Cache.TTL)
+	}
+	logging.SetLevel(next.Log.Level)
+
+	settings := applicableSettings()
+	var result reload.Result
+	result.Applied, _ = reload.Split(reload.Diff(loaded, next), settings)
+	_, result.Restart = reload.Split(reload.Diff(config, next), settings)
+	loaded = next
+
+	mainLog.Info("تنظیمات دوباره بارگذاری شد", "applied", result.Applied)
+	if len(result.Restart) > 0 {
+		mainLog.Warn("این تنظیمات فقط با راه‌اندازی مجدد اعمال می‌شوند", "settings", result.Restart)
+	}
+	return result, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/dns-forwarder/pkg/domainlist"
+	"github.com/miekg/dns"
+)
+
+// Route مسیر ارسال درخواست
+type Route int
+
+const (
+	// RouteTunnel ارسال از طریق تانل
+	RouteTunnel Route = iota
+	// RouteDirect ارسال به resolver مستقیم
+	RouteDirect
+	// RouteGeoIP ارسال همزمان و انتخاب پاسخ بر اساس IP
+	RouteGeoIP
+	// RouteFallback پاسخ از resolver جایگزین پس از خطای تانل یا geoip
+	RouteFallback
+)
+
+// String نام مسیر برای لاگ و metrics
+func (r Route) String() string {
+	switch r {
+	case RouteDirect:
+		return "direct"
+	case RouteGeoIP:
+		return "geoip"
+	case RouteFallback:
+		return "fallback"
+	}
+	return "tunnel"
+}
+
+// RoutingRule قاعده مسیریابی دامنه‌ها
+type RoutingRule struct {
+	Name    string   `yaml:"name"`
+	Action  string   `yaml:"action"`
+	Domains []string `yaml:"domains"`
+	Regexps []string `yaml:"regexps"`
+	Files   []string `yaml:"files"`
+}
+
+// Router مجموعه قواعد کامپایل‌شده
+type Router struct {
+	rules []*routerRule
+}
+
+type routerRule struct {
+	name  string
+	route Route
+	list  *domainlist.List
+	hits  *uint64
+}
+
+var router atomic.Pointer[Router]
+
+// setupRouting ساخت قواعد و راه‌اندازی بارگذاری مجدد
+func setupRouting() error {
+	directClient = &dns.Client{
+		Net:     "udp",
+		Timeout: config.Routing.Timeout,
+	}
+
+	if err := reloadRouting(); err != nil {
+		return err
+	}
+
+	if config.Routing.ReloadInterval > 0 {
+		go routingReloadLoop()
+	}
+	return nil
+}
+
+// buildRouter کامپایل قواعد از تنظیمات و فایل‌ها
+func buildRouter(rules []RoutingRule, previous *Router) (*Router, error) {
+	rt := &Router{}
+
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule-%d", i+1)
+		}
+
+		var route Route
+		switch rule.Action {
+		case "direct":
+			route = RouteDirect
+		case "tunnel", "":
+			route = RouteTunnel
+		default:
+			return nil, fmt.Errorf("rule %s: unknown action %q", name, rule.Action)
+		}
+
+		list, err := domainlist.New(rule.Domains...)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		for _, re := range rule.Regexps {
+			if err := list.Add("regexp:" + re); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", name, err)
+			}
+		}
+		for _, file := range rule.Files {
+			if err := list.LoadFile(file); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", name, err)
+			}
+		}
+
+		// حفظ شمارنده‌ها بین بارگذاری‌ها
+		hits := new(uint64)
+		if old := previous.find(name); old != nil {
+			hits = old.hits
+		}
+
+		rt.rules = append(rt.rules, &routerRule{
+			name:  name,
+			route: route,
+			list:  list,
+			hits:  hits,
+		})
+	}
+
+	return rt, nil
+}
+
+func (rt *Router) find(name string) *routerRule {
+	if rt == nil {
+		return nil
+	}
+	for _, rule := range rt.rules {
+		if rule.name == name {
+			return rule
+		}
+	}
+	return nil
+}
+
+// Route تعیین مسیر نام بر اساس اولین قاعده منطبق
+func (rt *Router) Route(name string) (Route, string) {
+	if rt != nil {
+		for _, rule := range rt.rules {
+			if rule.list.Match(name) {
+				atomic.AddUint64(rule.hits, 1)
+				return rule.route, rule.name
+			}
+		}
+	}
+	return RouteTunnel, ""
+}
+
+// reloadRouting بارگذاری مجدد قواعد و جایگزینی اتمیک
+//
+// reloadMu مانع می‌شود که قواعد ساخته‌شده از تنظیمات قبلی پس از اعمال
+// تنظیمات جدید با SIGHUP ذخیره شوند.
+func reloadRouting() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	rt, err := buildRouter(live.Load().Rules, router.Load())
+	if err != nil {
+		return err
+	}
+
+	if config.Routing.GeoIP.Enabled {
+		// بازه‌ها از آخرین تنظیمات خوانده‌شده تا تغییرات SIGHUP از دست نروند
+		set, err := buildGeoIP(&loaded)
+		if err != nil {
+			return err
+		}
+		storeGeoIP(set)
+	}
+
+	router.Store(rt)
+	for _, rule := range rt.rules {
+		routingLog.Info("قاعده مسیریابی بارگذاری شد", "rule", rule.name, "entries", rule.list.Len())
+	}
+
+	return nil
+}
+
+// routingReloadLoop بارگذاری دوره‌ای فایل‌های قواعد؛ SIGHUP کل تنظیمات را دوباره می‌خواند
+func routingReloadLoop() {
+	ticker := time.NewTicker(config.Routing.ReloadInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := reloadRouting(); err != nil {
+			routingLog.Error("خطا در بارگذاری مجدد قواعد مسیریابی", "error", err)
+		}
+	}
+}
+
+// routingHits شمارنده تطبیق هر قاعده
+func routingHits() string {
+	rt := router.Load()
+	if rt == nil {
+		return ""
+	}
+
+	var out string
+	for _, rule := range rt.rules {
+		if out != "" {
+			out += " "
+		}
+		out += fmt.Sprintf("%s=%d", rule.name, atomic.LoadUint64(rule.hits))
+	}
+	return out
+}
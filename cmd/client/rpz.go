@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"time"
+
+	"github.com/dns-forwarder/pkg/dnstap"
+	"github.com/dns-forwarder/pkg/rpz"
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// policy zone های RPZ فعلی؛ Load برابر nil یعنی غیرفعال
+var policy = rpz.NewHolder(dnsLog)
+
+// checkQueryPolicy بررسی قواعد Client-IP و QNAME پیش از کش و مسیریابی
+//
+// handled یعنی درخواست با قاعده پاسخ داده (یا رها) شد؛ passthru یعنی قاعده
+// PASSTHRU منطبق شد و قواعد پاسخ نباید بررسی شوند.
+func checkQueryPolicy(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, client string, start time.Time) (handled, passthru bool) {
+	p := policy.Load()
+	if p == nil || len(r.Question) == 0 {
+		return false, false
+	}
+	rule := p.Query(clientAddr(client), r.Question[0].Name)
+	if rule == nil {
+		return false, false
+	}
+	logRPZ(ctx, rule, client, r)
+	if rule.Action == rpz.ActionPassthru {
+		return false, true
+	}
+	answerRPZ(ctx, w, r, rule, client, start)
+	return true, false
+}
+
+// checkResponsePolicy بررسی قواعد Response-IP و NSDNAME روی پاسخ؛ true یعنی پاسخ جایگزین شد
+func checkResponsePolicy(ctx context.Context, w dns.ResponseWriter, r, response *dns.Msg, client string, start time.Time) bool {
+	if response.Rcode != dns.RcodeSuccess {
+		return false
+	}
+	// NS های zone cut برای قواعد NSDNAME از تانل پرسیده می‌شوند
+	exchange := func(q *dns.Msg) (*dns.Msg, error) {
+		m, _, err := resolveViaTunnel(ctx, q, q.Question[0].Name)
+		return m, err
+	}
+	rule := policy.Load().Response(response, exchange)
+	if rule == nil {
+		return false
+	}
+	logRPZ(ctx, rule, client, r)
+	if rule.Action == rpz.ActionPassthru {
+		return false
+	}
+	answerRPZ(ctx, w, r, rule, client, start)
+	return true
+}
+
+// answerRPZ ارسال پاسخ قاعده؛ CNAME های local data از تانل ادامه داده می‌شوند
+func answerRPZ(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, rule *rpz.Rule, client string, start time.Time) {
+	response := rule.Apply(r)
+	if response == nil {
+		// DROP: بدون پاسخ
+		recordQuery(ctx, client, "rpz", "", "", r, nil, start)
+		return
+	}
+
+	upstream := ""
+	if target := rpz.CNAMETarget(response, r.Question[0].Qtype); target != "" {
+		q := new(dns.Msg)
+		q.SetQuestion(target, r.Question[0].Qtype)
+		q.RecursionDesired = true
+		chased, server, err := resolveViaTunnel(ctx, q, target)
+		if errors.Is(err, errDropped) {
+			recordQuery(ctx, client, "rpz", "", server, r, nil, start)
+			return
+		}
+		if err != nil {
+			response.Rcode = dns.RcodeServerFailure
+		} else {
+			response.Answer = append(response.Answer, chased.Answer...)
+			response.Rcode = chased.Rcode
+			upstream = server
+		}
+	}
+
+	recordQuery(ctx, client, "rpz", "", upstream, r, response, start)
+	tap.LogClient(dnstap.ClientResponse, w, start, r, response)
+	w.WriteMsg(response)
+}
+
+// logRPZ ثبت قاعده اعمال‌شده در لاگ، metrics و span
+func logRPZ(ctx context.Context, rule *rpz.Rule, client string, r *dns.Msg) {
+	action := rule.Action.String()
+	metricRPZHits.WithLabelValues(rule.Zone, string(rule.Trigger), action).Inc()
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("dns.rpz.zone", rule.Zone),
+		attribute.String("dns.rpz.action", action))
+	dnsLog.Info("قاعده RPZ اعمال شد", "zone", rule.Zone, "trigger", rule.Trigger, "rule", rule.Name,
+		"action", action, "qname", r.Question[0].Name, "client", client)
+}
+
+// clientAddr آدرس IP کلاینت محلی برای trigger های rpz-client-ip
+func clientAddr(remote string) netip.Addr {
+	addr, err := netip.ParseAddrPort(remote)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Addr().Unmap()
+}
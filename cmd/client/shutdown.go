@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/dns-forwarder/pkg/drain"
+	"github.com/dns-forwarder/pkg/logging"
+	"github.com/miekg/dns"
+)
+
+// flushTimeout مهلت ارسال داده‌های باقی‌مانده tracing پس از پایان تخلیه
+const flushTimeout = 5 * time.Second
+
+var (
+	// inflight درخواست‌های DNS محلی در حال پردازش؛ با خاموش شدن بسته می‌شود
+	inflight drain.Group
+	// stopped پس از تخلیه یک می‌شود تا connectLoop دوباره وصل نشود
+	stopped int32
+
+	// شنونده‌هایی که هنگام خاموش شدن بسته می‌شوند
+	dnsServers    []*dns.Server
+	dohServer     *http.Server
+	socksListener net.Listener
+)
+
+// shuttingDown اینکه خاموش شدن شروع شده است؛ خطای پذیرش شنونده‌ها پس از آن عادی است
+func shuttingDown() bool {
+	return inflight.Closed()
+}
+
+// closing اینکه تانل برای خروج بسته شده است
+func closing() bool {
+	return atomic.LoadInt32(&stopped) == 1
+}
+
+// waitShutdown انتظار برای SIGINT یا SIGTERM و خاموش کردن آرام کلاینت
+//
+// به درخواست‌های جدید REFUSED داده می‌شود تا برنامه‌ها سراغ resolver دیگری
+// بروند، تا shutdown_timeout برای پاسخ درخواست‌های در حال پردازش صبر می‌شود و
+// سپس شنونده‌ها بسته و تانل با فریم بستن قطع می‌شود. سیگنال دوم برنامه را
+// فوراً می‌بندد.
+func waitShutdown() {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-stop
+	signal.Stop(stop)
+
+	mainLog.Info("خاموش شدن کلاینت", "signal", sig.String(), "timeout", config.Client.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), config.Client.ShutdownTimeout)
+	defer cancel()
+
+	// توقف پذیرش درخواست و اتصال جدید
+	inflight.Close()
+	if dohServer != nil {
+		go dohServer.Shutdown(ctx)
+	}
+	if socksListener != nil {
+		socksListener.Close()
+	}
+
+	if err := inflight.Wait(ctx); err != nil {
+		pendingMutex.RLock()
+		pending := len(pendingRequests)
+		pendingMutex.RUnlock()
+		mainLog.Warn("پایان مهلت خاموش شدن؛ درخواست‌های باقی‌مانده رها شدند", "pending", pending)
+	}
+
+	// سوکت شنونده‌های DNS پس از ارسال پاسخ‌ها بسته می‌شود
+	for _, server := range dnsServers {
+		server.ShutdownContext(ctx)
+	}
+
+	// بستن تانل؛ WebSocket با فریم بستن به سرور اطلاع می‌دهد
+	atomic.StoreInt32(&stopped, 1)
+	if b := batcher.Load(); b != nil {
+		b.Flush()
+	}
+	connMutex.RLock()
+	conn := tunnelConn
+	connMutex.RUnlock()
+	if conn != nil {
+		conn.Close()
+	}
+
+	flushOutputs()
+	mainLog.Info("کلاینت خاموش شد")
+}
+
+// flushOutputs نوشتن داده‌های باقی‌مانده dnstap، tracing و لاگ‌ها
+func flushOutputs() {
+	if tap != nil {
+		if err := tap.Close(); err != nil {
+			mainLog.Warn("خطا در بستن dnstap", "error", err)
+		}
+	}
+	if shutdownTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			mainLog.Warn("خطا در ارسال span های باقی‌مانده", "error", err)
+		}
+	}
+	logging.Sync()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/dns-forwarder/pkg/logging"
+	"github.com/dns-forwarder/pkg/mux"
+	"github.com/dns-forwarder/pkg/socks5"
+)
+
+// streams جریان‌های TCP اتصال فعلی (nil وقتی به سرور وصل نیستیم)
+var streams atomic.Pointer[mux.Mux]
+
+// socksHandshakeTimeout حداکثر زمان مذاکره SOCKS5
+const socksHandshakeTimeout = 30 * time.Second
+
+// startSocksListener راه‌اندازی شنونده SOCKS5 برای عبور اتصال‌های TCP از تانل
+func startSocksListener() {
+	listener, err := net.Listen("tcp", config.Socks.Listen)
+	if err != nil {
+		logging.Fatal(socksLog, "خطا در راه‌اندازی SOCKS5", "error", err)
+	}
+	socksListener = listener
+	socksLog.Info("SOCKS5 فعال", "listen", config.Socks.Listen)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !shuttingDown() {
+					socksLog.Error("خطا در پذیرش اتصال SOCKS5", "error", err)
+				}
+				return
+			}
+			go handleSocksConn(conn)
+		}
+	}()
+}
+
+// handleSocksConn مذاکره SOCKS5 و باز کردن جریان روی تانل
+func handleSocksConn(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+	req, err := socks5.Handshake(conn, config.Socks.Username, config.Socks.Password)
+	if err != nil {
+		if errors.Is(err, socks5.ErrAuth) {
+			socksLog.Warn("احراز هویت SOCKS5 ناموفق", "remote", conn.RemoteAddr().String())
+		}
+		return
+	}
+
+	switch req.Command {
+	case socks5.CmdConnect:
+	case socks5.CmdUDPAssociate:
+		handleUDPAssociate(conn)
+		return
+	default:
+		socks5.WriteReply(conn, socks5.ReplyCommandNotSupported, "")
+		return
+	}
+
+	m := streams.Load()
+	if m == nil {
+		socks5.WriteReply(conn, socks5.ReplyNetworkUnreachable, "")
+		return
+	}
+
+	stream, err := m.Open(req.Addr, config.Socks.OpenTimeout)
+	if err != nil {
+		socksLog.Warn("خطا در باز کردن جریان", "addr", req.Addr, "error", err)
+		socks5.WriteReply(conn, socksReplyCode(err), "")
+		return
+	}
+
+	if err := socks5.WriteReply(conn, socks5.ReplySucceeded, conn.LocalAddr().String()); err != nil {
+		stream.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	atomic.AddUint64(&stats.Streams, 1)
+	mux.Relay(stream, conn)
+
+	in, out := stream.Bytes()
+	atomic.AddUint64(&stats.StreamBytesIn, in)
+	atomic.AddUint64(&stats.StreamBytesOut, out)
+}
+
+// socksReplyCode تبدیل خطای باز کردن جریان به کد پاسخ SOCKS5
+func socksReplyCode(err error) byte {
+	var reset *mux.ResetError
+	if errors.As(err, &reset) {
+		switch reset.Reason {
+		case mux.ReasonDisabled, mux.ReasonNotAllowed:
+			return socks5.ReplyNotAllowed
+		case mux.ReasonUnreachable:
+			return socks5.ReplyHostUnreachable
+		}
+	}
+	if errors.Is(err, mux.ErrTimeout) {
+		return socks5.ReplyTTLExpired
+	}
+	return socks5.ReplyGeneralFailure
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats شمارنده‌های آماری کلاینت
+type Stats struct {
+	Queries   uint64 `json:"queries"`
+	CacheHits uint64 `json:"cache_hits"`
+	Tunnel    uint64 `json:"tunnel"`
+	Direct    uint64 `json:"direct"`
+	Fallback  uint64 `json:"fallback"`
+	Blocked   uint64 `json:"blocked"`
+	Failures  uint64 `json:"failures"`
+
+	PayloadBytes uint64 `json:"payload_bytes"`
+	FrameBytes   uint64 `json:"frame_bytes"`
+	CoverBytes   uint64 `json:"cover_bytes"`
+
+	Streams        uint64 `json:"streams"`
+	StreamBytesIn  uint64 `json:"stream_bytes_in"`
+	StreamBytesOut uint64 `json:"stream_bytes_out"`
+	DatagramsOut   uint64 `json:"datagrams_out"`
+	DatagramsIn    uint64 `json:"datagrams_in"`
+}
+
+var stats Stats
+
+// statsLoop چاپ دوره‌ای آمار
+func statsLoop() {
+	ticker := time.NewTicker(config.Client.StatsInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		statsLog.Info("آمار درخواست‌ها",
+			"queries", atomic.LoadUint64(&stats.Queries),
+			"cache", atomic.LoadUint64(&stats.CacheHits),
+			"tunnel", atomic.LoadUint64(&stats.Tunnel),
+			"direct", atomic.LoadUint64(&stats.Direct),
+			"fallback", atomic.LoadUint64(&stats.Fallback),
+			"blocked", atomic.LoadUint64(&stats.Blocked),
+			"failures", atomic.LoadUint64(&stats.Failures),
+		)
+		if opts := codec.Load().Options(); !opts.Empty() {
+			statsLog.Info("حجم ارسال",
+				"payload_bytes", atomic.LoadUint64(&stats.PayloadBytes),
+				"frame_bytes", atomic.LoadUint64(&stats.FrameBytes),
+				"cover_bytes", atomic.LoadUint64(&stats.CoverBytes))
+		}
+		if raw, compressed := codec.Load().CompressionRatio(); raw > 0 {
+			statsLog.Info("فشرده‌سازی اتصال فعلی", "raw_bytes", raw, "compressed_bytes", compressed,
+				"ratio", float64(compressed)/float64(raw))
+		}
+		if config.Socks.Enabled {
+			open := 0
+			if m := streams.Load(); m != nil {
+				open = m.Len()
+			}
+			statsLog.Info("جریان‌ها",
+				"open", open,
+				"total", atomic.LoadUint64(&stats.Streams),
+				"bytes_in", atomic.LoadUint64(&stats.StreamBytesIn),
+				"bytes_out", atomic.LoadUint64(&stats.StreamBytesOut))
+			statsLog.Info("UDP",
+				"datagrams_out", atomic.LoadUint64(&stats.DatagramsOut),
+				"datagrams_in", atomic.LoadUint64(&stats.DatagramsIn))
+		}
+		if config.Routing.Enabled {
+			statsLog.Info("تطبیق قواعد", "hits", routingHits())
+		}
+		if config.Routing.GeoIP.Enabled {
+			statsLog.Info("geoip", "hits", geoipHits())
+		}
+		if config.Blocklist.Enabled {
+			statsLog.Info("مسدودسازی", "hits", blocklistHits(), "allowed", blocker.Load().Overrides())
+		}
+	}
+}
+
+// snapshot کپی لحظه‌ای شمارنده‌ها
+func (s *Stats) snapshot() Stats {
+	return Stats{
+		Queries:        atomic.LoadUint64(&s.Queries),
+		CacheHits:      atomic.LoadUint64(&s.CacheHits),
+		Tunnel:         atomic.LoadUint64(&s.Tunnel),
+		Direct:         atomic.LoadUint64(&s.Direct),
+		Fallback:       atomic.LoadUint64(&s.Fallback),
+		Blocked:        atomic.LoadUint64(&s.Blocked),
+		Failures:       atomic.LoadUint64(&s.Failures),
+		PayloadBytes:   atomic.LoadUint64(&s.PayloadBytes),
+		FrameBytes:     atomic.LoadUint64(&s.FrameBytes),
+		CoverBytes:     atomic.LoadUint64(&s.CoverBytes),
+		Streams:        atomic.LoadUint64(&s.Streams),
+		StreamBytesIn:  atomic.LoadUint64(&s.StreamBytesIn),
+		StreamBytesOut: atomic.LoadUint64(&s.StreamBytesOut),
+		DatagramsOut:   atomic.LoadUint64(&s.DatagramsOut),
+		DatagramsIn:    atomic.LoadUint64(&s.DatagramsIn),
+	}
+}
+
+// sub تفاضل دو snapshot
+func (s Stats) sub(o Stats) Stats {
+	return Stats{
+		Queries:        s.Queries - o.Queries,
+		CacheHits:      s.CacheHits - o.CacheHits,
+		Tunnel:         s.Tunnel - o.Tunnel,
+		Direct:         s.Direct - o.Direct,
+		Fallback:       s.Fallback - o.Fallback,
+		Blocked:        s.Blocked - o.Blocked,
+		Failures:       s.Failures - o.Failures,
+		PayloadBytes:   s.PayloadBytes - o.PayloadBytes,
+		FrameBytes:     s.FrameBytes - o.FrameBytes,
+		CoverBytes:     s.CoverBytes - o.CoverBytes,
+		Streams:        s.Streams - o.Streams,
+		StreamBytesIn:  s.StreamBytesIn - o.StreamBytesIn,
+		StreamBytesOut: s.StreamBytesOut - o.StreamBytesOut,
+		DatagramsOut:   s.DatagramsOut - o.DatagramsOut,
+		DatagramsIn:    s.DatagramsIn - o.DatagramsIn,
+	}
+}
+
+// statsSampleInterval فاصله نمونه‌برداری آمار برای پنجره‌های متحرک
+const statsSampleInterval = 10 * time.Second
+
+// statsWindows پنجره‌های متحرک گزارش‌شده؛ بزرگ‌ترین پنجره اندازه تاریخچه را تعیین می‌کند
+var statsWindows = []struct {
+	name   string
+	length time.Duration
+}{
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+	{"15m", 15 * time.Minute},
+}
+
+// statsSample یک نمونه از شمارنده‌ها
+type statsSample struct {
+	at    time.Time
+	stats Stats
+}
+
+var (
+	statsHistoryMu sync.Mutex
+	// statsHistory نمونه‌های اخیر به ترتیب زمان؛ قدیمی‌ترین اول
+	statsHistory []statsSample
+)
+
+// statsHistoryLoop نمونه‌برداری دوره‌ای از شمارنده‌ها
+func statsHistoryLoop() {
+	keep := int(statsWindows[len(statsWindows)-1].length/statsSampleInterval) + 1
+	recordStatsSample(keep)
+
+	ticker := time.NewTicker(statsSampleInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		recordStatsSample(keep)
+	}
+}
+
+func recordStatsSample(keep int) {
+	sample := statsSample{at: time.Now(), stats: stats.snapshot()}
+
+	statsHistoryMu.Lock()
+	defer statsHistoryMu.Unlock()
+	statsHistory = append(statsHistory, sample)
+	if len(statsHistory) > keep {
+		statsHistory = append(statsHistory[:0], statsHistory[len(statsHistory)-keep:]...)
+	}
+}
+
+// WindowStats آمار یک پنجره متحرک
+//
+// اگر تاریخچه هنوز به اندازه پنجره نرسیده باشد Seconds کوتاه‌تر از پنجره است.
+type WindowStats struct {
+	Seconds float64 `json:"seconds"`
+	QPS     float64 `json:"qps"`
+	Stats
+}
+
+// rollingStats آمار هر پنجره متحرک نسبت به قدیمی‌ترین نمونه درون آن
+func rollingStats() map[string]WindowStats {
+	now := stats.snapshot()
+	at := time.Now()
+
+	statsHistoryMu.Lock()
+	defer statsHistoryMu.Unlock()
+
+	result := make(map[string]WindowStats, len(statsWindows))
+	for _, window := range statsWindows {
+		var base *statsSample
+		for i := range statsHistory {
+			if at.Sub(statsHistory[i].at) <= window.length {
+				base = &statsHistory[i]
+				break
+			}
+		}
+		if base == nil {
+			continue
+		}
+
+		w := WindowStats{Seconds: at.Sub(base.at).Seconds(), Stats: now.sub(base.stats)}
+		if w.Seconds > 0 {
+			w.QPS = float64(w.Queries) / w.Seconds
+		}
+		result[window.name] = w
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dns-forwarder/pkg/transport"
+)
+
+// ServerConfig تنظیمات یک سرور خارج
+type ServerConfig struct {
+	URL string `yaml:"url"`
+	// Transport نوع انتقال: websocket، poll، stream، quic یا auto (ابتدا websocket، در صورت خطا poll)
+	// برای stream آدرس به شکل tls://host:port یا tcp://host:port و برای quic به شکل quic://host:port است
+	Transport string `yaml:"transport"`
+	PollURL   string `yaml:"poll_url"`
+}
+
+// dialServer اتصال به سرور با انتقال تنظیم‌شده
+func dialServer(server ServerConfig) (transport.Conn, error) {
+	var tlsConfig *tls.Config
+	if config.Client.InsecureSkipTLS {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	header := make(http.Header)
+	for key, value := range config.Client.Headers {
+		header.Set(key, value)
+	}
+
+	switch server.Transport {
+	case "websocket":
+		return transport.DialWebSocket(server.URL, tlsConfig, header)
+
+	case "poll":
+		return transport.DialPoll(server.PollURL, tlsConfig, config.Client.LongPoll, header)
+
+	case "stream":
+		return transport.DialStream(server.URL, tlsConfig)
+
+	case "quic":
+		return transport.DialQUIC(server.URL, tlsConfig)
+
+	case "auto":
+		conn, err := transport.DialWebSocket(server.URL, tlsConfig, header)
+		if err == nil {
+			return conn, nil
+		}
+		tunnelLog.Warn("اتصال WebSocket ناموفق، تلاش با long-polling", "poll_url", server.PollURL, "error", err)
+		return transport.DialPoll(server.PollURL, tlsConfig, config.Client.LongPoll, header)
+	}
+
+	return nil, fmt.Errorf("unknown transport %q", server.Transport)
+}
+
+// derivePollURL ساخت آدرس long-polling از آدرس WebSocket
+func derivePollURL(wsURL string) string {
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return ""
+	}
+
+	switch u.Scheme {
+	case "wss":
+		u.Scheme = "https"
+	case "ws":
+		u.Scheme = "http"
+	}
+
+	if i := strings.LastIndex(u.Path, "/"); i >= 0 {
+		u.Path = u.Path[:i] + "/poll"
+	} else {
+		u.Path = "/poll"
+	}
+
+	return u.String()
+}
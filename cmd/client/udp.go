@@ -0,0 +1,152 @@
+package main
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dns-forwarder/pkg/protocol"
+	"github.com/dns-forwarder/pkg/socks5"
+)
+
+// udpAssociation یک UDP ASSOCIATE کلاینت SOCKS5
+//
+// association تا بسته شدن اتصال TCP کنترل برقرار است و فقط بسته‌های
+// همان IP کلاینت کنترل پذیرفته می‌شوند.
+type udpAssociation struct {
+	id      uint32
+	control net.Conn
+	conn    *net.UDPConn
+
+	mu        sync.Mutex
+	client    *net.UDPAddr
+	closeOnce sync.Once
+}
+
+var (
+	udpMutex   sync.RWMutex
+	udpAssocs  = make(map[uint32]*udpAssociation)
+	udpCounter uint32
+)
+
+// handleUDPAssociate ایجاد سوکت UDP محلی و عبور بسته‌های آن از تانل
+func handleUDPAssociate(control net.Conn) {
+	host, _, _ := net.SplitHostPort(control.LocalAddr().String())
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(host)})
+	if err != nil {
+		socksLog.Error("خطا در ایجاد سوکت UDP", "error", err)
+		socks5.WriteReply(control, socks5.ReplyGeneralFailure, "")
+		return
+	}
+
+	assoc := &udpAssociation{
+		id:      atomic.AddUint32(&udpCounter, 1),
+		control: control,
+		conn:    conn,
+	}
+
+	udpMutex.Lock()
+	udpAssocs[assoc.id] = assoc
+	udpMutex.Unlock()
+
+	if err := socks5.WriteReply(control, socks5.ReplySucceeded, conn.LocalAddr().String()); err != nil {
+		assoc.close(false)
+		return
+	}
+	control.SetDeadline(time.Time{})
+
+	go assoc.readLoop()
+
+	io.Copy(io.Discard, control)
+	assoc.close(true)
+}
+
+// readLoop ارسال بسته‌های کلاینت محلی به تانل
+func (a *udpAssociation) readLoop() {
+	controlIP := a.control.RemoteAddr().(*net.TCPAddr).IP
+	buf := make([]byte, protocol.MaxDatagramSize)
+
+	for {
+		n, from, err := a.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if !from.IP.Equal(controlIP) {
+			continue
+		}
+
+		addr, data, err := socks5.ParseUDPHeader(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		a.mu.Lock()
+		a.client = from
+		a.mu.Unlock()
+
+		if err := sendMessage(protocol.NewDatagram(a.id, addr, data)); err != nil {
+			continue
+		}
+		atomic.AddUint64(&stats.DatagramsOut, 1)
+	}
+}
+
+// close بستن association؛ notify یعنی سرور هم باید باخبر شود
+func (a *udpAssociation) close(notify bool) {
+	a.closeOnce.Do(func() {
+		udpMutex.Lock()
+		delete(udpAssocs, a.id)
+		udpMutex.Unlock()
+
+		a.conn.Close()
+		a.control.Close()
+		if notify {
+			sendMessage(protocol.NewDatagramClose(a.id, ""))
+		}
+	})
+}
+
+// handleDatagram تحویل بسته دریافتی از تانل به کلاینت محلی
+func handleDatagram(msg *protocol.Message) {
+	udpMutex.RLock()
+	assoc := udpAssocs[msg.RequestID]
+	udpMutex.RUnlock()
+	if assoc == nil {
+		return
+	}
+
+	addr, data, err := protocol.DecodeDatagram(msg.Payload)
+	if err != nil {
+		return
+	}
+
+	assoc.mu.Lock()
+	client := assoc.client
+	assoc.mu.Unlock()
+	if client == nil {
+		return
+	}
+
+	packet, err := socks5.AppendUDPHeader(nil, addr)
+	if err != nil {
+		return
+	}
+	if _, err := assoc.conn.WriteToUDP(append(packet, data...), client); err == nil {
+		atomic.AddUint64(&stats.DatagramsIn, 1)
+	}
+}
+
+// handleDatagramClose بستن association به درخواست سرور (بیکاری، سهمیه یا محدودیت)
+func handleDatagramClose(msg *protocol.Message) {
+	udpMutex.RLock()
+	assoc := udpAssocs[msg.RequestID]
+	udpMutex.RUnlock()
+	if assoc == nil {
+		return
+	}
+
+	socksLog.Info("association UDP توسط سرور بسته شد", "id", assoc.id, "reason", string(msg.Payload))
+	assoc.close(false)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/dns-forwarder/pkg/admin"
+	"github.com/dns-forwarder/pkg/logging"
+)
+
+// startAdmin راه‌اندازی API مدیریتی نشست‌ها
+//
+// بدون admin.listen روی همان پورت HTTP سرور ارائه می‌شود و درخواست بدون
+// توکن معتبر وب‌سایت پوششی را می‌بیند.
+func startAdmin() {
+	prefix := config.Admin.Path
+	mux := http.NewServeMux()
+	mux.HandleFunc(prefix+"/sessions", admin.Method(http.MethodGet, adminSessions))
+	mux.HandleFunc(prefix+"/sessions/kick", admin.Method(http.MethodPost, adminKick))
+	mux.HandleFunc(prefix+"/bans", admin.Method(http.MethodGet, adminBans))
+	mux.HandleFunc(prefix+"/bans/add", admin.Method(http.MethodPost, adminBanAdd))
+	mux.HandleFunc(prefix+"/bans/remove", admin.Method(http.MethodPost, adminBanRemove))
+	mux.HandleFunc(prefix+"/blocklist", admin.Method(http.MethodGet, adminBlocklist))
+	mux.HandleFunc(prefix+"/reload", admin.Method(http.MethodPost, adminReload))
+
+	if config.Admin.Listen == "" {
+		http.Handle(prefix+"/", admin.Protect(config.Admin.Token, mux, decoy))
+		mainLog.Info("API مدیریتی فعال", "path", prefix)
+		return
+	}
+
+	mainLog.Info("API مدیریتی فعال", "listen", config.Admin.Listen, "path", prefix)
+	go func() {
+		if err := http.ListenAndServe(config.Admin.Listen, admin.Protect(config.Admin.Token, mux, nil)); err != nil {
+			logging.Fatal(mainLog, "خطا در راه‌اندازی API مدیریتی", "error", err)
+		}
+	}()
+}
+
+// sessionInfo یک نشست در پاسخ /sessions
+type sessionInfo struct {
+	ID           uint64    `json:"id"`
+	Remote       string    `json:"remote"`
+	User         string    `json:"user"`
+	Since        time.Time `json:"connected_since"`
+	LastActivity time.Time `json:"last_activity"`
+	Queries      uint64    `json:"queries"`
+	BytesIn      uint64    `json:"bytes_in"`
+	BytesOut     uint64    `json:"bytes_out"`
+	Streams      int       `json:"streams"`
+	UDP          int       `json:"udp"`
+}
+
+// adminSessions فهرست نشست‌های باز
+func adminSessions(w http.ResponseWriter, r *http.Request) {
+	list := []sessionInfo{}
+	for _, s := range openSessions() {
+		s.udpMu.Lock()
+		udp := len(s.udpAssocs)
+		s.udpMu.Unlock()
+
+		list = append(list, sessionInfo{
+			ID:           s.id,
+			Remote:       s.remoteAddr,
+			User:         s.user.Name,
+			Since:        s.since,
+			LastActivity: time.Unix(0, atomic.LoadInt64(&s.lastActive)),
+			Queries:      atomic.LoadUint64(&s.queries),
+			BytesIn:      atomic.LoadUint64(&s.rxBytes),
+			BytesOut:     atomic.LoadUint64(&s.txBytes),
+			Streams:      s.mux.Len(),
+			UDP:          udp,
+		})
+	}
+	admin.JSON(w, http.StatusOK, list)
+}
+
+// adminKick بستن یک نشست با شناسه
+func adminKick(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		admin.Error(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	sessionsMu.RLock()
+	s := sessions[id]
+	sessionsMu.RUnlock()
+	if s == nil {
+		admin.Error(w, http.StatusNotFound, "unknown session")
+		return
+	}
+
+	s.kick("admin")
+	admin.JSON(w, http.StatusOK, map[string]uint64{"kicked": id})
+}
+
+// adminBans فهرست مسدودسازی‌های فعال
+func adminBans(w http.ResponseWriter, r *http.Request) {
+	admin.JSON(w, http.StatusOK, activeBans())
+}
+
+// adminBanAdd مسدود کردن کاربر یا IP و بستن نشست‌های منطبق
+//
+// پارامترها: user یا ip (IP یا CIDR)، duration اختیاری (مثلاً 1h) و reason.
+func adminBanAdd(w http.ResponseWriter, r *http.Request) {
+	kind, value, ok := banTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var duration time.Duration
+	if d := r.URL.Query().Get("duration"); d != "" {
+		var err error
+		if duration, err = time.ParseDuration(d); err != nil || duration < 0 {
+			admin.Error(w, http.StatusBadRequest, "invalid duration")
+			return
+		}
+	}
+
+	ban, err := addBan(kind, value, r.URL.Query().Get("reason"), duration)
+	if err != nil {
+		admin.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sessionLog.Info("مسدودسازی ثبت شد", "kind", ban.Kind, "value", ban.Value, "duration", duration, "reason", ban.Reason)
+
+	kicked := 0
+	for _, s := range openSessions() {
+		if ban.matches(s) {
+			s.kick("ban")
+			kicked++
+		}
+	}
+
+	admin.JSON(w, http.StatusOK, map[string]any{"ban": ban, "kicked": kicked})
+}
+
+// adminBanRemove لغو مسدودسازی کاربر یا IP
+func adminBanRemove(w http.ResponseWriter, r *http.Request) {
+	kind, value, ok := banTarget(w, r)
+	if !ok {
+		return
+	}
+	if !removeBan(kind, value) {
+		admin.Error(w, http.StatusNotFound, "no such ban")
+		return
+	}
+
+	sessionLog.Info("مسدودسازی لغو شد", "kind", kind, "value", value)
+	admin.JSON(w, http.StatusOK, map[string]string{"removed": kind + ":" + value})
+}
+
+// adminBlocklist آمار فهرست‌های مسدودسازی
+func adminBlocklist(w http.ResponseWriter, r *http.Request) {
+	filter := blocker.Load()
+	if filter == nil {
+		admin.Error(w, http.StatusNotFound, "blocklist disabled")
+		return
+	}
+	admin.JSON(w, http.StatusOK, filter.Status())
+}
+
+// adminReload بارگذاری مجدد تنظیمات؛ خطای اعتبارسنجی با 400 برگردانده می‌شود
+func adminReload(w http.ResponseWriter, r *http.Request) {
+	result, err := reloadConfig()
+	if err != nil {
+		admin.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	admin.JSON(w, http.StatusOK, result)
+}
+
+// banTarget خواندن یکی از پارامترهای user یا ip
+//
+// در صورت خطا پاسخ نوشته شده و ok برابر false است.
+func banTarget(w http.ResponseWriter, r *http.Request) (kind, value string, ok bool) {
+	user, ip := r.URL.Query().Get("user"), r.URL.Query().Get("ip")
+	switch {
+	case user != "" && ip != "":
+		admin.Error(w, http.StatusBadRequest, "user and ip are mutually exclusive")
+		return "", "", false
+	case user != "":
+		return banUser, user, true
+	case ip != "":
+		return banIP, ip, true
+	}
+	admin.Error(w, http.StatusBadRequest, "user or ip is required")
+	return "", "", false
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// انواع مسدودسازی
+const (
+	banUser = "user"
+	banIP   = "ip"
+)
+
+// Ban مسدودسازی یک کاربر یا IP (یا بازه CIDR)
+//
+// Expires خالی یعنی مسدودسازی تا راه‌اندازی مجدد سرور باقی می‌ماند.
+type Ban struct {
+	Kind    string     `json:"kind"`
+	Value   string     `json:"value"`
+	Reason  string     `json:"reason,omitempty"`
+	Created time.Time  `json:"created"`
+	Expires *time.Time `json:"expires,omitempty"`
+
+	network *net.IPNet
+}
+
+// active بررسی منقضی نشدن مسدودسازی
+func (b *Ban) active(now time.Time) bool {
+	return b.Expires == nil || now.Before(*b.Expires)
+}
+
+var (
+	bansMu sync.RWMutex
+	// bans مسدودسازی‌ها بر اساس kind:value
+	bans = make(map[string]*Ban)
+)
+
+// addBan ثبت یا جایگزینی یک مسدودسازی
+func addBan(kind, value, reason string, duration time.Duration) (*Ban, error) {
+	ban := &Ban{Kind: kind, Value: value, Reason: reason, Created: time.Now()}
+	if duration > 0 {
+		expires := ban.Created.Add(duration)
+		ban.Expires = &expires
+	}
+
+	switch kind {
+	case banUser:
+		if value == "" {
+			return nil, errors.New("empty user")
+		}
+	case banIP:
+		network, err := parseBanNetwork(value)
+		if err != nil {
+			return nil, err
+		}
+		ban.network = network
+		ban.Value = network.String()
+	default:
+		return nil, errors.New("unknown ban kind")
+	}
+
+	bansMu.Lock()
+	bans[ban.Kind+":"+ban.Value] = ban
+	bansMu.Unlock()
+	return ban, nil
+}
+
+// removeBan حذف مسدودسازی؛ false اگر وجود نداشته باشد
+func removeBan(kind, value string) bool {
+	if kind == banIP {
+		if network, err := parseBanNetwork(value); err == nil {
+			value = network.String()
+		}
+	}
+
+	key := kind + ":" + value
+	bansMu.Lock()
+	defer bansMu.Unlock()
+	if _, ok := bans[key]; !ok {
+		return false
+	}
+	delete(bans, key)
+	return true
+}
+
+// activeBans مسدودسازی‌های فعال؛ موارد منقضی‌شده حذف می‌شوند
+func activeBans() []*Ban {
+	now := time.Now()
+	bansMu.Lock()
+	list := make([]*Ban, 0, len(bans))
+	for key, ban := range bans {
+		if !ban.active(now) {
+			delete(bans, key)
+			continue
+		}
+		list = append(list, ban)
+	}
+	bansMu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list
+}
+
+// bannedUser مسدودسازی فعال کاربر یا nil
+func bannedUser(name string) *Ban {
+	bansMu.RLock()
+	defer bansMu.RUnlock()
+	if ban, ok := bans[banUser+":"+name]; ok && ban.active(time.Now()) {
+		return ban
+	}
+	return nil
+}
+
+// bannedIP مسدودسازی فعال شامل آدرس remote (host:port) یا nil
+func bannedIP(remote string) *Ban {
+	ip := remoteIP(remote)
+	if ip == nil {
+		return nil
+	}
+
+	now := time.Now()
+	bansMu.RLock()
+	defer bansMu.RUnlock()
+	for _, ban := range bans {
+		if ban.network != nil && ban.network.Contains(ip) && ban.active(now) {
+			return ban
+		}
+	}
+	return nil
+}
+
+// matches بررسی شمول نشست در مسدودسازی
+func (b *Ban) matches(s *Session) bool {
+	if b.Kind == banUser {
+		return s.user.Name == b.Value
+	}
+	ip := remoteIP(s.remoteAddr)
+	return ip != nil && b.network.Contains(ip)
+}
+
+// parseBanNetwork خواندن IP یا بازه CIDR
+func parseBanNetwork(value string) (*net.IPNet, error) {
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		return network, err
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, errors.New("invalid ip")
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// remoteIP استخراج IP از آدرس host:port
+func remoteIP(remote string) net.IP {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		host = remote
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+
+	"github.com/dns-forwarder/pkg/blocklist"
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// blocker فهرست‌های مسدودسازی فعلی؛ Load برابر nil یعنی غیرفعال
+var blocker = blocklist.NewHolder(dnsLog)
+
+// checkBlocklist پاسخ مسدودسازی برای درخواست منطبق با فهرست‌ها؛ nil اگر مسدود نباشد
+func checkBlocklist(ctx context.Context, r *dns.Msg) *dns.Msg {
+	filter := blocker.Load()
+	if filter == nil || len(r.Question) == 0 {
+		return nil
+	}
+	list := filter.Check(r.Question[0].Name)
+	if list == "" {
+		return nil
+	}
+
+	metricBlocked.WithLabelValues(list).Inc()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("dns.blocklist", list))
+	dnsLog.Debug("درخواست مسدود شد", "qname", r.Question[0].Name, "list", list)
+	return filter.Block(r)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+// decoy پاسخ‌دهنده به همه درخواست‌هایی که به تانل مربوط نیستند
+var decoy http.Handler
+
+// setupDecoy ساخت وب‌سایت پوششی از تنظیمات
+//
+// اولویت: reverse proxy به یک سایت واقعی، سپس پوشه فایل‌های ثابت،
+// و در نهایت صفحه 404 ساده.
+func setupDecoy() error {
+	var handler http.Handler
+
+	switch {
+	case config.Camouflage.ProxyURL != "":
+		target, err := url.Parse(config.Camouflage.ProxyURL)
+		if err != nil {
+			return err
+		}
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		director := proxy.Director
+		proxy.Director = func(r *http.Request) {
+			director(r)
+			r.Host = target.Host
+		}
+		handler = proxy
+		mainLog.Info("وب‌سایت پوششی", "proxy", config.Camouflage.ProxyURL)
+
+	case config.Camouflage.SiteDir != "":
+		handler = http.FileServer(http.Dir(config.Camouflage.SiteDir))
+		mainLog.Info("وب‌سایت پوششی", "dir", config.Camouflage.SiteDir)
+
+	default:
+		handler = http.HandlerFunc(http.NotFound)
+	}
+
+	decoy = withServerHeader(handler)
+	return nil
+}
+
+// withServerHeader افزودن هدر Server مشابه وب‌سرورهای رایج
+func withServerHeader(next http.Handler) http.Handler {
+	if config.Camouflage.ServerHeader == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", config.Camouflage.ServerHeader)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkPreAuth بررسی هدر یا کوکی پیش‌احراز قبل از ورود به تانل
+func checkPreAuth(r *http.Request) bool {
+	auth := config.Camouflage.PreAuth
+	if auth.Value == "" {
+		return true
+	}
+
+	var value string
+	if auth.Header != "" {
+		value = r.Header.Get(auth.Header)
+	}
+	if value == "" && auth.Cookie != "" {
+		if cookie, err := r.Cookie(auth.Cookie); err == nil {
+			value = cookie.Value
+		}
+	}
+
+	return subtle.ConstantTimeCompare([]byte(value), []byte(auth.Value)) == 1
+}
+
+// guardTunnel عبور فقط درخواست‌های معتبر تانل؛ بقیه به وب‌سایت پوششی می‌روند
+func guardTunnel(next http.Handler, requireUpgrade bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !checkPreAuth(r) || (requireUpgrade && !websocket.IsWebSocketUpgrade(r)) {
+			decoy.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
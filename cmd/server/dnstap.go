@@ -0,0 +1,17 @@
+package main
+
+import "github.com/dns-forwarder/pkg/dnstap"
+
+// tap خروجی dnstap تبادل با upstream ها؛ nil یعنی غیرفعال
+var tap *dnstap.Tap
+
+// setupDnstap باز کردن خروجی dnstap
+func setupDnstap() error {
+	t, err := dnstap.Open(config.Dnstap)
+	if err != nil || t == nil {
+		return err
+	}
+	tap = t
+	mainLog.Info("dnstap فعال", "output", config.Dnstap.Output)
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dns-forwarder/pkg/doh"
+	"github.com/dns-forwarder/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// handleDoH پاسخ به درخواست‌های DNS-over-HTTPS (RFC 8484)
+//
+// توکن دسترسی از هدر Authorization: Bearer یا از انتهای مسیر خوانده می‌شود
+// (مثلاً /dns-query/TOKEN برای مرورگرها و گوشی‌ها که هدر سفارشی نمی‌پذیرند).
+// درخواست بدون توکن معتبر یا نامعتبر از نظر DoH به decoy سپرده می‌شود تا
+// پاسخی متمایز به پویشگر داده نشود.
+func handleDoH(w http.ResponseWriter, r *http.Request) {
+	if !checkDoHToken(r) {
+		decoy.ServeHTTP(w, r)
+		return
+	}
+
+	dnsMsg, _, err := doh.ReadRequest(r)
+	if err != nil {
+		decoy.ServeHTTP(w, r)
+		return
+	}
+
+	// حفظ شناسه درخواست (طبق RFC معمولاً صفر است)
+	id := dnsMsg.Id
+	ctx, span := tracer.Start(r.Context(), "doh.query",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(tracing.QueryAttributes(dnsMsg)...))
+	defer span.End()
+
+	start := time.Now()
+	response, upstream := resolveQuery(ctx, r.RemoteAddr, dnsMsg)
+	recordQuery("doh", "", r.RemoteAddr, dnsMsg, response, upstream, start)
+	if response == nil {
+		// قاعده DROP: بستن اتصال بدون پاسخ
+		panic(http.ErrAbortHandler)
+	}
+	response.Id = id
+
+	if err := doh.WriteResponse(w, response); err != nil {
+		dnsLog.Warn("خطا در ارسال پاسخ DoH", "remote", r.RemoteAddr, "error", err)
+	}
+}
+
+// checkDoHToken بررسی توکن دسترسی DoH
+func checkDoHToken(r *http.Request) bool {
+	token := strings.TrimPrefix(r.URL.Path, config.DoH.Path)
+	token = strings.Trim(token, "/")
+
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	if token == "" {
+		return false
+	}
+
+	for _, allowed := range config.DoH.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(allowed)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"time"
+
+	"github.com/dns-forwarder/pkg/logging"
+	"github.com/miekg/dns"
+)
+
+// لاگ‌گرهای بخش‌های سرور
+var (
+	mainLog    = logging.Component("main")
+	sessionLog = logging.Component("session")
+	dnsLog     = logging.Component("dns")
+	streamLog  = logging.Component("streams")
+	udpLog     = logging.Component("udp")
+	userLog    = logging.Component("users")
+)
+
+// queryLog لاگ جداگانه درخواست‌ها؛ nil یعنی غیرفعال
+var queryLog *logging.QueryLog
+
+// setupLogging تنظیم لاگ تشخیصی و لاگ درخواست‌ها
+func setupLogging() (err error) {
+	if err = logging.Setup(config.Log); err != nil {
+		return err
+	}
+	queryLog, err = logging.OpenQueryLog(config.QueryLog)
+	return err
+}
+
+// recordQuery ثبت متریک و لاگ یک درخواست حل‌شده
+func recordQuery(source, user, client string, r, response *dns.Msg, upstream string, start time.Time) {
+	observeQuery(source, r, response)
+	if queryLog == nil {
+		return
+	}
+
+	entry := logging.NewQuery(r)
+	entry.User = user
+	entry.Client = client
+	entry.RCode = rcodeName(response)
+	entry.Route = source
+	entry.Upstream = upstream
+	entry.Latency = time.Since(start)
+	queryLog.Log(entry)
+}
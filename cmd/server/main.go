@@ -1,42 +1,142 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/hex"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
 	"net"
 	"net/http"
 	"os"
-	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/dns-forwarder/pkg/blocklist"
 	"github.com/dns-forwarder/pkg/crypto"
+	"github.com/dns-forwarder/pkg/dnstap"
+	"github.com/dns-forwarder/pkg/logging"
 	"github.com/dns-forwarder/pkg/protocol"
+	"github.com/dns-forwarder/pkg/rpz"
+	"github.com/dns-forwarder/pkg/tracing"
+	"github.com/dns-forwarder/pkg/transport"
 	"github.com/gorilla/websocket"
 	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/yaml.v3"
 )
 
 // Config تنظیمات سرور
 type Config struct {
 	Server struct {
-		Listen   string `yaml:"listen"`
-		TLSCert  string `yaml:"tls_cert"`
-		TLSKey   string `yaml:"tls_key"`
-		Password string `yaml:"password"`
-		Salt     string `yaml:"salt"`
+		Listen     string `yaml:"listen"`
+		TLSCert    string `yaml:"tls_cert"`
+		TLSKey     string `yaml:"tls_key"`
+		Password   string `yaml:"password"`
+		Salt       string `yaml:"salt"`
+		Path       string `yaml:"path"`
+		HealthPath string `yaml:"health_path"`
+		// ShutdownTimeout مهلت پاسخ به درخواست‌های در حال پردازش هنگام خاموش شدن
+		ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
 	} `yaml:"server"`
 	DNS struct {
 		Upstreams []string      `yaml:"upstreams"`
 		Timeout   time.Duration `yaml:"timeout"`
 	} `yaml:"dns"`
+	DoH struct {
+		Enabled bool     `yaml:"enabled"`
+		Path    string   `yaml:"path"`
+		Tokens  []string `yaml:"tokens"`
+	} `yaml:"doh"`
+	Transports struct {
+		Poll struct {
+			Enabled  bool          `yaml:"enabled"`
+			Path     string        `yaml:"path"`
+			LongPoll time.Duration `yaml:"long_poll"`
+		} `yaml:"poll"`
+		Stream struct {
+			Enabled bool   `yaml:"enabled"`
+			Listen  string `yaml:"listen"`
+			TLS     bool   `yaml:"tls"`
+			// AuthTimeout مهلت handshake و اولین فریم معتبر اتصال (برای نشست‌های poll هم)
+			AuthTimeout time.Duration `yaml:"auth_timeout"`
+		} `yaml:"stream"`
+		QUIC struct {
+			Enabled bool   `yaml:"enabled"`
+			Listen  string `yaml:"listen"`
+		} `yaml:"quic"`
+	} `yaml:"transports"`
+	Obfuscation struct {
+		DisablePadding bool          `yaml:"disable_padding"`
+		MaxPaddingSize uint16        `yaml:"max_padding_size"`
+		Jitter         time.Duration `yaml:"jitter"`
+	} `yaml:"obfuscation"`
+	Batching struct {
+		Disable  bool          `yaml:"disable"`
+		Delay    time.Duration `yaml:"delay"`
+		MaxBytes int           `yaml:"max_bytes"`
+	} `yaml:"batching"`
+	Compression struct {
+		Disable bool `yaml:"disable"`
+	} `yaml:"compression"`
+	Streams struct {
+		Enabled       bool          `yaml:"enabled"`
+		Allow         []string      `yaml:"allow"`
+		Deny          []string      `yaml:"deny"`
+		DialTimeout   time.Duration `yaml:"dial_timeout"`
+		MaxPerSession int           `yaml:"max_per_session"`
+		Window        uint32        `yaml:"window"`
+	} `yaml:"streams"`
+	UDP struct {
+		Enabled     bool          `yaml:"enabled"`
+		Allow       []string      `yaml:"allow"`
+		Deny        []string      `yaml:"deny"`
+		IdleTimeout time.Duration `yaml:"idle_timeout"`
+		QuotaBytes  int64         `yaml:"quota_bytes"`
+		QuotaPeriod time.Duration `yaml:"quota_period"`
+		MaxSessions int           `yaml:"max_sessions"`
+	} `yaml:"udp"`
+	Users   []UserConfig `yaml:"users"`
+	Metrics struct {
+		Enabled bool   `yaml:"enabled"`
+		Path    string `yaml:"path"`
+		Token   string `yaml:"token"`
+	} `yaml:"metrics"`
+	Admin struct {
+		Enabled bool   `yaml:"enabled"`
+		Path    string `yaml:"path"`
+		Listen  string `yaml:"listen"`
+		Token   string `yaml:"token"`
+	} `yaml:"admin"`
+	Blocklist struct {
+		Enabled          bool `yaml:"enabled"`
+		blocklist.Config `yaml:",inline"`
+	} `yaml:"blocklist"`
+	RPZ struct {
+		Enabled    bool `yaml:"enabled"`
+		rpz.Config `yaml:",inline"`
+	} `yaml:"rpz"`
+	Log        logging.Config         `yaml:"log"`
+	QueryLog   logging.QueryLogConfig `yaml:"query_log"`
+	Tracing    tracing.Config         `yaml:"tracing"`
+	Dnstap     dnstap.Config          `yaml:"dnstap"`
+	Camouflage struct {
+		SiteDir      string `yaml:"site_dir"`
+		ProxyURL     string `yaml:"proxy_url"`
+		ServerHeader string `yaml:"server_header"`
+		PreAuth      struct {
+			Header string `yaml:"header"`
+			Cookie string `yaml:"cookie"`
+			Value  string `yaml:"value"`
+		} `yaml:"preauth"`
+	} `yaml:"camouflage"`
 }
 
 var (
 	configFile = flag.String("config", "configs/server.yaml", "مسیر فایل تنظیمات")
 	config     Config
-	encryptor  *crypto.Encryptor
 	dnsClient  *dns.Client
 	upgrader   = websocket.Upgrader{
 		ReadBufferSize:  4096,
@@ -50,19 +150,28 @@ func main() {
 
 	// خواندن تنظیمات
 	if err := loadConfig(*configFile); err != nil {
-		log.Fatalf("خطا در خواندن تنظیمات: %v", err)
+		logging.Fatal(mainLog, "خطا در خواندن تنظیمات", "error", err)
+	}
+	if err := setupLogging(); err != nil {
+		logging.Fatal(mainLog, "خطا در تنظیم لاگ", "error", err)
+	}
+	if err := setupDnstap(); err != nil {
+		logging.Fatal(mainLog, "خطا در راه‌اندازی dnstap", "error", err)
+	}
+	if err := setupTracing(); err != nil {
+		logging.Fatal(mainLog, "خطا در راه‌اندازی tracing", "error", err)
 	}
 
 	// ایجاد رمزنگار
 	salt, err := hex.DecodeString(config.Server.Salt)
 	if err != nil {
-		log.Fatalf("خطا در خواندن salt: %v", err)
+		logging.Fatal(mainLog, "خطا در خواندن salt", "error", err)
 	}
 
-	encryptor, err = crypto.NewEncryptor(config.Server.Password, salt)
-	if err != nil {
-		log.Fatalf("خطا در ایجاد رمزنگار: %v", err)
+	if err := setupUsers(salt); err != nil {
+		logging.Fatal(mainLog, "خطا در ایجاد رمزنگار", "error", err)
 	}
+	setupReload()
 
 	// ایجاد DNS client
 	dnsClient = &dns.Client{
@@ -70,46 +179,225 @@ func main() {
 		Timeout: config.DNS.Timeout,
 	}
 
+	if config.Blocklist.Enabled {
+		if err := blocker.Start(config.Blocklist.Config); err != nil {
+			logging.Fatal(mainLog, "خطا در فهرست‌های مسدودسازی", "error", err)
+		}
+	}
+
+	if config.RPZ.Enabled {
+		if err := policy.Start(config.RPZ.Config); err != nil {
+			logging.Fatal(mainLog, "خطا در zone های RPZ", "error", err)
+		}
+	}
+
+	if err := setupStreams(); err != nil {
+		logging.Fatal(mainLog, "خطا در خواندن فهرست مقصدهای مجاز", "error", err)
+	}
+	if err := setupUDP(); err != nil {
+		logging.Fatal(mainLog, "خطا در خواندن فهرست مقصدهای مجاز UDP", "error", err)
+	}
+	if config.UDP.Enabled {
+		go quotaResetLoop()
+	}
+
 	// راه‌اندازی HTTP server
-	http.HandleFunc("/dns", handleWebSocket)
-	http.HandleFunc("/health", handleHealth)
+	if err := setupDecoy(); err != nil {
+		logging.Fatal(mainLog, "خطا در تنظیم وب‌سایت پوششی", "error", err)
+	}
+	upgrader.Error = func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		decoy.ServeHTTP(w, r)
+	}
+
+	http.Handle("/", decoy)
+	http.Handle(config.Server.Path, guardTunnel(http.HandlerFunc(handleWebSocket), true))
+	if config.Metrics.Enabled {
+		http.Handle(config.Metrics.Path, metricsHandler())
+	}
+	if config.Admin.Enabled {
+		startAdmin()
+	}
+	if config.Server.HealthPath != "" {
+		http.HandleFunc(config.Server.HealthPath, handleHealth)
+	}
+
+	if config.Transports.Poll.Enabled {
+		pollServer := transport.NewPollServer(config.Transports.Poll.LongPoll, config.Transports.Stream.AuthTimeout, serveSession)
+		pollServer.NotFound = decoy
+		http.Handle(config.Transports.Poll.Path, guardTunnel(pollServer, false))
+		mainLog.Info("انتقال HTTP long-polling فعال", "path", config.Transports.Poll.Path)
+	}
+
+	if config.Transports.Stream.Enabled {
+		startStreamListener()
+	}
+
+	if config.Transports.QUIC.Enabled {
+		startQUICListener()
+	}
+
+	if config.DoH.Enabled {
+		http.HandleFunc(config.DoH.Path, handleDoH)
+		http.HandleFunc(config.DoH.Path+"/", handleDoH)
+		mainLog.Info("DNS-over-HTTPS فعال", "path", config.DoH.Path)
+	}
 
 	// بررسی وجود گواهی TLS
-	if config.Server.TLSCert != "" && config.Server.TLSKey != "" {
-		log.Printf("🚀 سرور DNS Tunnel در حال اجرا روی %s (TLS)", config.Server.Listen)
-		tlsConfig := &tls.Config{
+	server := &http.Server{Addr: config.Server.Listen}
+	useTLS := config.Server.TLSCert != "" && config.Server.TLSKey != ""
+	if useTLS {
+		mainLog.Info("سرور DNS Tunnel در حال اجرا", "listen", config.Server.Listen, "tls", true)
+		server.TLSConfig = &tls.Config{
 			MinVersion: tls.VersionTLS12,
 		}
-		server := &http.Server{
-			Addr:      config.Server.Listen,
-			TLSConfig: tlsConfig,
-		}
-		log.Fatal(server.ListenAndServeTLS(config.Server.TLSCert, config.Server.TLSKey))
 	} else {
-		log.Printf("🚀 سرور DNS Tunnel در حال اجرا روی %s (بدون TLS - فقط برای تست)", config.Server.Listen)
-		log.Fatal(http.ListenAndServe(config.Server.Listen, nil))
+		mainLog.Warn("سرور DNS Tunnel در حال اجرا بدون TLS (فقط برای تست)", "listen", config.Server.Listen)
 	}
+
+	go func() {
+		var err error
+		if useTLS {
+			err = server.ListenAndServeTLS(config.Server.TLSCert, config.Server.TLSKey)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			logging.Fatal(mainLog, "خطا در اجرای سرور", "error", err)
+		}
+	}()
+
+	waitShutdown(server)
 }
 
 func loadConfig(path string) error {
-	data, err := os.ReadFile(path)
+	cfg, err := parseConfig(path)
 	if err != nil {
 		return err
 	}
+	config = cfg
+	return nil
+}
+
+// parseConfig خواندن و اعتبارسنجی تنظیمات با مقادیر پیش‌فرض
+func parseConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
 
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return err
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, err
 	}
 
 	// مقادیر پیش‌فرض
-	if config.DNS.Timeout == 0 {
-		config.DNS.Timeout = 5 * time.Second
+	if cfg.Server.Path == "" {
+		cfg.Server.Path = "/dns"
+	}
+	if cfg.Server.ShutdownTimeout == 0 {
+		cfg.Server.ShutdownTimeout = 10 * time.Second
+	}
+	if cfg.Transports.Stream.AuthTimeout == 0 {
+		cfg.Transports.Stream.AuthTimeout = 10 * time.Second
+	}
+	if cfg.DNS.Timeout == 0 {
+		cfg.DNS.Timeout = 5 * time.Second
+	}
+	if cfg.Batching.Delay == 0 {
+		cfg.Batching.Delay = 2 * time.Millisecond
+	}
+	if cfg.Batching.MaxBytes == 0 {
+		cfg.Batching.MaxBytes = 16 * 1024
+	}
+	if cfg.Obfuscation.MaxPaddingSize == 0 {
+		cfg.Obfuscation.MaxPaddingSize = 1024
+	}
+	if len(cfg.DNS.Upstreams) == 0 {
+		cfg.DNS.Upstreams = []string{"8.8.8.8:53", "1.1.1.1:53"}
+	}
+	if cfg.Transports.Poll.Path == "" {
+		cfg.Transports.Poll.Path = "/poll"
+	}
+	if cfg.Transports.Poll.LongPoll == 0 {
+		cfg.Transports.Poll.LongPoll = 25 * time.Second
+	}
+	if cfg.Transports.Stream.Listen == "" {
+		cfg.Transports.Stream.Listen = ":9443"
+	}
+	if cfg.Transports.Stream.TLS && (cfg.Server.TLSCert == "" || cfg.Server.TLSKey == "") {
+		return cfg, errors.New("stream tls requires server tls_cert and tls_key")
+	}
+	if cfg.Transports.QUIC.Listen == "" {
+		cfg.Transports.QUIC.Listen = ":8443"
+	}
+	if cfg.Transports.QUIC.Enabled && (cfg.Server.TLSCert == "" || cfg.Server.TLSKey == "") {
+		return cfg, errors.New("quic requires server tls_cert and tls_key")
 	}
-	if len(config.DNS.Upstreams) == 0 {
-		config.DNS.Upstreams = []string{"8.8.8.8:53", "1.1.1.1:53"}
+	if cfg.Streams.DialTimeout == 0 {
+		cfg.Streams.DialTimeout = 10 * time.Second
+	}
+	if cfg.Streams.MaxPerSession == 0 {
+		cfg.Streams.MaxPerSession = 256
+	}
+	if cfg.UDP.IdleTimeout == 0 {
+		cfg.UDP.IdleTimeout = 60 * time.Second
+	}
+	if cfg.UDP.QuotaPeriod == 0 {
+		cfg.UDP.QuotaPeriod = 24 * time.Hour
+	}
+	if cfg.UDP.MaxSessions == 0 {
+		cfg.UDP.MaxSessions = 64
+	}
+	if cfg.QueryLog.Output == "" {
+		cfg.QueryLog.Output = "stdout"
+	}
+	if cfg.Metrics.Path == "" {
+		cfg.Metrics.Path = "/metrics"
+	}
+	if cfg.Admin.Path == "" {
+		cfg.Admin.Path = "/admin"
+	}
+	if cfg.Metrics.Enabled && cfg.Metrics.Token == "" {
+		// metrics روی پورت عمومی تانل است و بدون توکن سرور را به پویشگر معرفی می‌کند
+		return cfg, errors.New("metrics enabled without token")
+	}
+	if cfg.Admin.Enabled && cfg.Admin.Token == "" {
+		return cfg, errors.New("admin enabled without token")
+	}
+	if cfg.DoH.Path == "" {
+		cfg.DoH.Path = "/dns-query"
+	}
+	if cfg.Tracing.Endpoint == "" {
+		cfg.Tracing.Endpoint = "127.0.0.1:4318"
+	}
+	if cfg.Tracing.SampleRatio == 0 {
+		cfg.Tracing.SampleRatio = 1
+	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "dns-forwarder-server"
+	}
+	if cfg.Dnstap.Enabled && cfg.Dnstap.Output == "" {
+		return cfg, errors.New("dnstap enabled without output")
+	}
+	if cfg.DoH.Enabled && len(cfg.DoH.Tokens) == 0 {
+		return cfg, errors.New("doh enabled without tokens")
 	}
 
-	return nil
+	if cfg.Blocklist.TTL == 0 {
+		cfg.Blocklist.TTL = 5 * time.Minute
+	}
+	if _, err := blocklist.ParseAction(cfg.Blocklist.Action); err != nil {
+		return cfg, err
+	}
+	if cfg.RPZ.Enabled && len(cfg.RPZ.Zones) == 0 {
+		return cfg, errors.New("rpz enabled without zones")
+	}
+
+	if _, err := logging.ParseLevel(cfg.Log.Level); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
 }
 
 func handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -120,144 +408,246 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("خطا در ارتقا به WebSocket: %v", err)
+		sessionLog.Debug("خطا در ارتقا به WebSocket", "remote", r.RemoteAddr, "error", err)
 		return
 	}
-	defer conn.Close()
 
-	clientAddr := r.RemoteAddr
-	log.Printf("📡 اتصال جدید از: %s", clientAddr)
+	serveSession(transport.NewWebSocket(conn, r.RemoteAddr, 30*time.Second))
+}
 
-	var writeMutex sync.Mutex
+// serveSession پردازش پیام‌های یک نشست تانل، مستقل از نوع انتقال
+func serveSession(conn transport.Conn) {
+	defer conn.Close()
 
-	// Heartbeat handler
-	go func() {
-		ticker := time.NewTicker(30 * time.Second)
-		defer ticker.Stop()
-		for range ticker.C {
-			writeMutex.Lock()
-			err := conn.WriteMessage(websocket.PingMessage, nil)
-			writeMutex.Unlock()
-			if err != nil {
-				return
-			}
-		}
-	}()
+	sess := newSession(conn)
+	clientAddr := sess.remoteAddr
+	if ban := bannedIP(clientAddr); ban != nil {
+		sessionLog.Info("اتصال از IP مسدود رد شد", "remote", clientAddr, "ban", ban.Value)
+		return
+	}
+	sessionLog.Info("اتصال جدید", "remote", clientAddr)
+
+	metricSessions.Inc()
+	defer metricSessions.Dec()
 
 	for {
-		messageType, encryptedData, err := conn.ReadMessage()
+		encryptedData, err := conn.ReadFrame()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("⚠️ خطا در خواندن پیام: %v", err)
+				sessionLog.Warn("خطا در خواندن پیام", "remote", clientAddr, "error", err)
 			}
 			break
 		}
 
-		if messageType != websocket.BinaryMessage {
-			continue
-		}
-
 		// رمزگشایی پیام
-		data, err := encryptor.Decrypt(encryptedData)
+		var frame []byte
+		if sess.user == nil {
+			sess.user, frame, err = identify(encryptedData)
+			if err == nil {
+				if ban := bannedUser(sess.user.Name); ban != nil {
+					sessionLog.Info("اتصال کاربر مسدود رد شد", "remote", clientAddr, "user", sess.user.Name)
+					break
+				}
+				if auth, ok := conn.(transport.AuthConn); ok {
+					auth.Authenticated()
+				}
+				sess.trackBytes()
+				sess.register()
+				sessionLog.Info("کاربر نشست شناسایی شد", "id", sess.id, "remote", clientAddr, "user", sess.user.Name)
+			}
+		} else {
+			frame, err = sess.user.encryptor.Decrypt(encryptedData)
+		}
 		if err != nil {
-			log.Printf("⚠️ خطا در رمزگشایی: %v", err)
+			metricDecryptFailures.Inc()
+			sessionLog.Warn("خطا در رمزگشایی", "remote", clientAddr, "error", err)
+			if _, ok := conn.(transport.AuthConn); ok && sess.user == nil {
+				// اولین فریم اتصال دارای مهلت شناسایی باید معتبر باشد
+				break
+			}
 			continue
 		}
 
+		sess.received(len(encryptedData))
+
 		// پردازش پیام
+		data, err := sess.frames.Unwrap(frame)
+		if err != nil {
+			sessionLog.Warn("خطا در پردازش پیام", "remote", clientAddr, "error", err)
+			continue
+		}
+		if data == nil {
+			// قطعه پیامی که هنوز کامل نشده است
+			continue
+		}
 		msg, err := protocol.Decode(data)
 		if err != nil {
-			log.Printf("⚠️ خطا در پردازش پیام: %v", err)
+			sessionLog.Warn("خطا در پردازش پیام", "remote", clientAddr, "error", err)
 			continue
 		}
 
-		switch msg.Type {
-		case protocol.TypeDNSQuery:
-			go handleDNSQuery(conn, &writeMutex, msg, clientAddr)
-
-		case protocol.TypeHeartbeat:
-			response := protocol.NewHeartbeatAck()
-			sendResponse(conn, &writeMutex, response)
-		}
+		sess.dispatch(msg)
 	}
 
-	log.Printf("👋 اتصال بسته شد: %s", clientAddr)
+	sess.unregister()
+	sess.mux.Close()
+	sess.closeAllUDP()
+	sess.untrackBytes()
+	sess.logOverhead()
+	sessionLog.Info("اتصال بسته شد", "remote", clientAddr)
 }
 
-func handleDNSQuery(conn *websocket.Conn, mutex *sync.Mutex, msg *protocol.Message, clientAddr string) {
+func handleDNSQuery(sess *Session, msg *protocol.Message) {
 	// parse کردن پکت DNS
 	dnsMsg := new(dns.Msg)
 	if err := dnsMsg.Unpack(msg.Payload); err != nil {
-		log.Printf("⚠️ خطا در parse پکت DNS: %v", err)
+		dnsLog.Warn("خطا در parse پکت DNS", "remote", sess.remoteAddr, "error", err)
 		return
 	}
 
-	var queryName string
-	if len(dnsMsg.Question) > 0 {
-		queryName = dnsMsg.Question[0].Name
+	// span سرور زیر span کلاینت که زمینه آن همراه پیام آمده است
+	ctx, span := tracer.Start(tracing.Extract(context.Background(), msg.Trace), "tunnel.query",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(tracing.QueryAttributes(dnsMsg)...),
+		trace.WithAttributes(attribute.String("tunnel.user", sess.user.Name)))
+	defer span.End()
+
+	atomic.AddUint64(&sess.queries, 1)
+	start := time.Now()
+	response, upstream := resolveQuery(ctx, sess.remoteAddr, dnsMsg)
+	recordQuery("tunnel", sess.user.Name, sess.remoteAddr, dnsMsg, response, upstream, start)
+	if response == nil {
+		// قاعده DROP: کلاینت باید بدون انتظار تا تایم‌اوت و بدون fallback پاسخ ندهد
+		sess.sendDNSResponse(protocol.NewDNSDrop(msg.RequestID))
+		return
 	}
+	span.SetAttributes(attribute.String("dns.rcode", dns.RcodeToString[response.Rcode]))
 
-	log.Printf("🔍 درخواست DNS: %s از %s", queryName, clientAddr)
+	// pack کردن پاسخ
+	responseData, err := response.Pack()
+	if err != nil {
+		dnsLog.Warn("خطا در pack پاسخ DNS", "error", err)
+		return
+	}
 
-	// ارسال به upstream DNS
-	var response *dns.Msg
-	var err error
+	// ایجاد پیام پاسخ
+	responseMsg := protocol.NewDNSResponse(msg.RequestID, responseData)
+	sendJitter()
+	sess.sendDNSResponse(responseMsg)
+}
 
-	for _, upstream := range config.DNS.Upstreams {
-		response, _, err = dnsClient.Exchange(dnsMsg, upstream)
+// resolveQuery حل درخواست از طریق upstream ها (مشترک بین تانل و DoH)
+//
+// upstream پاسخ‌دهنده هم برگردانده می‌شود (خالی اگر همه ناموفق باشند یا
+// درخواست با فهرست مسدودسازی یا RPZ پاسخ داده شود). پاسخ nil یعنی درخواست
+// با قاعده DROP رها شده است.
+func resolveQuery(ctx context.Context, client string, dnsMsg *dns.Msg) (*dns.Msg, string) {
+	if response := checkBlocklist(ctx, dnsMsg); response != nil {
+		return response, ""
+	}
+	return resolveWithPolicy(ctx, client, dnsMsg)
+}
+
+// resolveUpstream ارسال درخواست به upstream ها به ترتیب تا اولین پاسخ
+func resolveUpstream(ctx context.Context, dnsMsg *dns.Msg) (*dns.Msg, string) {
+	for _, upstream := range *upstreams.Load() {
+		ctx, span := tracer.Start(ctx, "upstream.exchange",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("dns.upstream", upstream)))
+
+		qtime := time.Now()
+		tap.LogForwarder(dnstap.ForwarderQuery, upstream, qtime, dnsMsg, nil)
+		response, rtt, err := dnsClient.ExchangeContext(ctx, dnsMsg, upstream)
+		tracing.End(span, err)
 		if err == nil {
-			break
+			metricUpstreamDuration.WithLabelValues(upstream).Observe(rtt.Seconds())
+			tap.LogForwarder(dnstap.ForwarderResponse, upstream, qtime, dnsMsg, response)
+			return response, upstream
 		}
-		log.Printf("⚠️ خطا از upstream %s: %v", upstream, err)
+		metricUpstreamErrors.WithLabelValues(upstream).Inc()
+		dnsLog.Warn("خطا از upstream", "upstream", upstream, "error", err)
 	}
 
-	if err != nil {
-		log.Printf("❌ همه upstream ها ناموفق: %v", err)
-		// ارسال پاسخ خالی
-		response = new(dns.Msg)
-		response.SetReply(dnsMsg)
-		response.Rcode = dns.RcodeServerFailure
+	dnsLog.Error("همه upstream ها ناموفق")
+	// ارسال پاسخ خالی
+	response := new(dns.Msg)
+	response.SetReply(dnsMsg)
+	response.Rcode = dns.RcodeServerFailure
+	return response, ""
+}
+
+func sendResponse(sess *Session, msg *protocol.Message) error {
+	for _, data := range sess.codec.Load().Wrap(msg.Encode()) {
+		encryptedData, err := sess.user.encryptor.Encrypt(data)
+		if err != nil {
+			sessionLog.Warn("خطا در رمزنگاری پاسخ", "remote", sess.remoteAddr, "error", err)
+			return err
+		}
+
+		if err := sess.conn.WriteFrame(encryptedData); err != nil {
+			sessionLog.Warn("خطا در ارسال پاسخ", "remote", sess.remoteAddr, "error", err)
+			return err
+		}
+		sess.sent(len(encryptedData))
 	}
+	return nil
+}
 
-	// pack کردن پاسخ
-	responseData, err := response.Pack()
+// startStreamListener راه‌اندازی شنونده TLS/TCP با فریم‌های دارای پیشوند طول
+func startStreamListener() {
+	var listener net.Listener
+	var err error
+
+	if config.Transports.Stream.TLS {
+		cert, certErr := tls.LoadX509KeyPair(config.Server.TLSCert, config.Server.TLSKey)
+		if certErr != nil {
+			logging.Fatal(mainLog, "خطا در خواندن گواهی TLS", "error", certErr)
+		}
+		listener, err = tls.Listen("tcp", config.Transports.Stream.Listen, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		})
+	} else {
+		listener, err = net.Listen("tcp", config.Transports.Stream.Listen)
+	}
 	if err != nil {
-		log.Printf("⚠️ خطا در pack پاسخ DNS: %v", err)
-		return
+		logging.Fatal(mainLog, "خطا در راه‌اندازی شنونده جریانی", "error", err)
 	}
 
-	// ایجاد پیام پاسخ
-	responseMsg := protocol.NewDNSResponse(msg.RequestID, responseData)
-	sendResponse(conn, mutex, responseMsg)
-
-	// لاگ جواب
-	if len(response.Answer) > 0 {
-		for _, ans := range response.Answer {
-			if a, ok := ans.(*dns.A); ok {
-				log.Printf("✅ پاسخ: %s -> %s", queryName, a.A.String())
-			} else if aaaa, ok := ans.(*dns.AAAA); ok {
-				log.Printf("✅ پاسخ: %s -> %s", queryName, aaaa.AAAA.String())
-			}
+	streamListener = listener
+	mainLog.Info("انتقال جریانی فعال", "listen", config.Transports.Stream.Listen, "tls", config.Transports.Stream.TLS)
+	go func() {
+		err := transport.ServeStream(listener, config.Transports.Stream.AuthTimeout, serveSession)
+		if !shuttingDown() {
+			logging.Fatal(mainLog, "خطا در اجرای شنونده جریانی", "error", err)
 		}
-	}
+	}()
 }
 
-func sendResponse(conn *websocket.Conn, mutex *sync.Mutex, msg *protocol.Message) {
-	data := msg.Encode()
-
-	encryptedData, err := encryptor.Encrypt(data)
+// startQUICListener راه‌اندازی شنونده QUIC (UDP)
+func startQUICListener() {
+	cert, err := tls.LoadX509KeyPair(config.Server.TLSCert, config.Server.TLSKey)
 	if err != nil {
-		log.Printf("⚠️ خطا در رمزنگاری پاسخ: %v", err)
-		return
+		logging.Fatal(mainLog, "خطا در خواندن گواهی TLS", "error", err)
 	}
 
-	mutex.Lock()
-	err = conn.WriteMessage(websocket.BinaryMessage, encryptedData)
-	mutex.Unlock()
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS13,
+	}
 
+	quicServer, err = transport.ListenQUIC(config.Transports.QUIC.Listen, tlsConfig)
 	if err != nil {
-		log.Printf("⚠️ خطا در ارسال پاسخ: %v", err)
+		logging.Fatal(mainLog, "خطا در راه‌اندازی شنونده QUIC", "error", err)
 	}
+
+	mainLog.Info("انتقال QUIC فعال", "listen", config.Transports.QUIC.Listen)
+	go func() {
+		err := quicServer.Serve(serveSession)
+		if !shuttingDown() {
+			logging.Fatal(mainLog, "خطا در اجرای شنونده QUIC", "error", err)
+		}
+	}()
 }
 
 // generateConfig تولید فایل تنظیمات نمونه
@@ -270,21 +660,19 @@ func generateConfig() {
 	cfg.Server.TLSKey = ""
 	cfg.Server.Password = "change-this-password"
 	cfg.Server.Salt = hex.EncodeToString(salt)
+	cfg.Server.Path = "/dns"
 	cfg.DNS.Upstreams = []string{"8.8.8.8:53", "1.1.1.1:53"}
 	cfg.DNS.Timeout = 5 * time.Second
 
 	data, _ := yaml.Marshal(cfg)
-	log.Printf("نمونه تنظیمات:\n%s", string(data))
+	fmt.Print(string(data))
 }
 
 func init() {
-	// تنظیم لاگ
-	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
-
 	// بررسی آرگومان برای تولید salt
 	if len(os.Args) > 1 && os.Args[1] == "generate-salt" {
 		salt, _ := crypto.GenerateSalt()
-		log.Printf("Salt جدید: %s", hex.EncodeToString(salt))
+		fmt.Println(hex.EncodeToString(salt))
 		os.Exit(0)
 	}
 
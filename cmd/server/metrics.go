@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "dnsforwarder_server"
+
+var (
+	metricQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "queries_total",
+		Help:      "DNS queries resolved, by source (tunnel or doh), query type and response code.",
+	}, []string{"source", "qtype", "rcode"})
+
+	metricUpstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_duration_seconds",
+		Help:      "Round trip time of upstream resolvers.",
+		Buckets:   prometheus.ExponentialBuckets(0.002, 2, 12),
+	}, []string{"upstream"})
+
+	metricUpstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_errors_total",
+		Help:      "Failed exchanges with upstream resolvers.",
+	}, []string{"upstream"})
+
+	metricBlocked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "blocked_total",
+		Help:      "Queries answered from a blocklist, by list.",
+	}, []string{"list"})
+
+	metricRPZHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rpz_hits_total",
+		Help:      "Response policy zone rules fired, by zone, trigger and action.",
+	}, []string{"zone", "trigger", "action"})
+
+	metricDecryptFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "decrypt_failures_total",
+		Help:      "Tunnel frames that failed to decrypt with any user key.",
+	})
+
+	metricSessions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "sessions",
+		Help:      "Open tunnel sessions.",
+	})
+
+	metricSessionBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "session_bytes_total",
+		Help:      "Encrypted bytes received and sent per open session.",
+	}, []string{"session", "user", "direction"})
+
+	_ = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dnstap_dropped_total",
+		Help:      "dnstap messages dropped because the output queue was full or failed.",
+	}, func() float64 {
+		return float64(tap.Dropped())
+	})
+)
+
+// metricsHandler خروجی Prometheus؛ درخواست بدون توکن وب‌سایت پوششی را می‌بیند
+func metricsHandler() http.Handler {
+	handler := promhttp.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(config.Metrics.Token)) != 1 {
+			decoy.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// observeQuery ثبت یک درخواست حل‌شده
+func observeQuery(source string, r, response *dns.Msg) {
+	qtype := ""
+	if len(r.Question) > 0 {
+		qtype = dns.TypeToString[r.Question[0].Qtype]
+	}
+	metricQueries.WithLabelValues(source, qtype, rcodeName(response)).Inc()
+}
+
+// rcodeName نام rcode پاسخ؛ DROP برای درخواستی که با RPZ رها شد
+func rcodeName(response *dns.Msg) string {
+	if response == nil {
+		return "DROP"
+	}
+	return dns.RcodeToString[response.Rcode]
+}
+
+// trackBytes شمارش بایت‌های نشست پس از شناسایی کاربر
+func (s *Session) trackBytes() {
+	s.bytesIn = metricSessionBytes.WithLabelValues(s.remoteAddr, s.user.Name, "in")
+	s.bytesOut = metricSessionBytes.WithLabelValues(s.remoteAddr, s.user.Name, "out")
+}
+
+// untrackBytes حذف شمارنده‌های نشست بسته‌شده
+func (s *Session) untrackBytes() {
+	if s.user == nil {
+		return
+	}
+	metricSessionBytes.DeleteLabelValues(s.remoteAddr, s.user.Name, "in")
+	metricSessionBytes.DeleteLabelValues(s.remoteAddr, s.user.Name, "out")
+}
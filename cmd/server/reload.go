@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/dns-forwarder/pkg/blocklist"
+	"github.com/dns-forwarder/pkg/logging"
+	"github.com/dns-forwarder/pkg/reload"
+	"github.com/dns-forwarder/pkg/rpz"
+)
+
+// upstreams resolver های فعلی؛ با بارگذاری مجدد به صورت اتمیک جایگزین می‌شود
+var upstreams atomic.Pointer[[]string]
+
+// liveSettings مسیرهای تنظیماتی که با بارگذاری مجدد اعمال می‌شوند
+var liveSettings = []string{
+	"dns.upstreams",
+	"server.password",
+	"users",
+	"udp.quota_bytes",
+	"udp.max_sessions",
+	"blocklist.action",
+	"blocklist.ttl",
+	"blocklist.allow",
+	"blocklist.allow_files",
+	"blocklist.lists",
+	"rpz.zones",
+	"log.level",
+}
+
+var (
+	// reloadMu جلوگیری از اجرای همزمان دو بارگذاری مجدد
+	reloadMu sync.Mutex
+	// loaded آخرین تنظیمات خوانده‌شده از فایل
+	loaded Config
+)
+
+// applicableSettings مسیرهای liveSettings که در این اجرا اعمال می‌شوند
+//
+// تنظیمات بخشی که هنگام شروع غیرفعال بوده فقط با راه‌اندازی مجدد اثر دارند.
+func applicableSettings() []string {
+	var disabled []string
+	if !config.Blocklist.Enabled {
+		disabled = append(disabled, "blocklist")
+	}
+	if !config.RPZ.Enabled {
+		disabled = append(disabled, "rpz")
+	}
+	return reload.Exclude(liveSettings, disabled)
+}
+
+// setupReload آماده‌سازی تنظیمات قابل تغییر و بارگذاری مجدد با SIGHUP
+func setupReload() {
+	list := config.DNS.Upstreams
+	upstreams.Store(&list)
+	loaded = config
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			reloadConfig()
+		}
+	}()
+}
+
+// reloadConfig خواندن دوباره فایل تنظیمات و اعمال تغییرات قابل اعمال
+//
+// تنظیمات جدید پیش از اعمال کامل اعتبارسنجی می‌شوند؛ در صورت خطا هیچ تغییری
+// اعمال نمی‌شود. نشست‌های باز قطع نمی‌شوند.
+func reloadConfig() (reload.Result, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	next, err := parseConfig(*configFile)
+	if err != nil {
+		mainLog.Error("خطا در بارگذاری مجدد تنظیمات", "error", err)
+		return reload.Result{}, err
+	}
+	list, err := buildUsers(&next, currentUsers())
+	if err != nil {
+		mainLog.Error("خطا در بارگذاری مجدد تنظیمات", "error", err)
+		return reload.Result{}, err
+	}
+	var filter *blocklist.Filter
+	if config.Blocklist.Enabled {
+		if filter, err = blocklist.Load(next.Blocklist.Config, blocker.Load()); err != nil {
+			mainLog.Error("خطا در بارگذاری مجدد تنظیمات", "error", err)
+			return reload.Result{}, err
+		}
+	}
+	// فایل‌های RPZ با هر بارگذاری مجدد دوباره خوانده می‌شوند
+	var zones *rpz.Policy
+	if config.RPZ.Enabled {
+		if zones, err = rpz.Load(next.RPZ.Config); err != nil {
+			mainLog.Error("خطا در بارگذاری مجدد تنظیمات", "error", err)
+			return reload.Result{}, err
+		}
+	}
+
+	// اعمال
+	users.Store(&list)
+	upstreamList := next.DNS.Upstreams
+	upstreams.Store(&upstreamList)
+	if filter != nil {
+		blocker.Store(filter)
+	}
+	if zones != nil {
+		policy.Store(zones)
+	}
+	logging.SetLevel(next.Log.Level)
+
+	settings := applicableSettings()
+	var result reload.Result
+	result.Applied, _ = reload.Split(reload.Diff(loaded, next), settings)
+	_, result.Restart = reload.Split(reload.Diff(config, next), settings)
+	loaded = next
+
+	mainLog.Info("تنظیمات دوباره بارگذاری شد", "applied", result.Applied, "users", len(list))
+	if len(result.Restart) > 0 {
+		mainLog.Warn("این تنظیمات فقط با راه‌اندازی مجدد اعمال می‌شوند", "settings", result.Restart)
+	}
+	return result, nil
+}
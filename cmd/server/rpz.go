@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/dns-forwarder/pkg/rpz"
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// policy zone های RPZ فعلی؛ Load برابر nil یعنی غیرفعال
+var policy = rpz.NewHolder(dnsLog)
+
+// resolveWithPolicy حل درخواست با اعمال قواعد RPZ پیش و پس از upstream
+//
+// پاسخ nil یعنی قاعده DROP؛ درخواست نباید پاسخ داده شود.
+func resolveWithPolicy(ctx context.Context, client string, r *dns.Msg) (*dns.Msg, string) {
+	p := policy.Load()
+	if p == nil || len(r.Question) == 0 {
+		return resolveUpstream(ctx, r)
+	}
+
+	rule := p.Query(clientAddr(client), r.Question[0].Name)
+	if rule != nil {
+		logRPZ(ctx, rule, client, r)
+		if rule.Action != rpz.ActionPassthru {
+			return applyRPZ(ctx, rule, r), ""
+		}
+	}
+
+	response, upstream := resolveUpstream(ctx, r)
+	if rule != nil || response.Rcode != dns.RcodeSuccess {
+		return response, upstream
+	}
+	exchange := func(q *dns.Msg) (*dns.Msg, error) {
+		m, _ := resolveUpstream(ctx, q)
+		return m, nil
+	}
+	if rule = p.Response(response, exchange); rule != nil {
+		logRPZ(ctx, rule, client, r)
+		if rule.Action != rpz.ActionPassthru {
+			return applyRPZ(ctx, rule, r), ""
+		}
+	}
+	return response, upstream
+}
+
+// applyRPZ پاسخ قاعده؛ CNAME های local data از upstream ادامه داده می‌شوند
+func applyRPZ(ctx context.Context, rule *rpz.Rule, r *dns.Msg) *dns.Msg {
+	m := rule.Apply(r)
+	target := rpz.CNAMETarget(m, r.Question[0].Qtype)
+	if target == "" {
+		return m
+	}
+
+	q := new(dns.Msg)
+	q.SetQuestion(target, r.Question[0].Qtype)
+	q.RecursionDesired = true
+	chased, _ := resolveUpstream(ctx, q)
+	m.Answer = append(m.Answer, chased.Answer...)
+	m.Rcode = chased.Rcode
+	return m
+}
+
+// logRPZ ثبت قاعده اعمال‌شده در لاگ، metrics و span
+func logRPZ(ctx context.Context, rule *rpz.Rule, client string, r *dns.Msg) {
+	action := rule.Action.String()
+	metricRPZHits.WithLabelValues(rule.Zone, string(rule.Trigger), action).Inc()
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("dns.rpz.zone", rule.Zone),
+		attribute.String("dns.rpz.action", action))
+	dnsLog.Info("قاعده RPZ اعمال شد", "zone", rule.Zone, "trigger", rule.Trigger, "rule", rule.Name,
+		"action", action, "qname", r.Question[0].Name, "client", client)
+}
+
+// clientAddr آدرس IP کلاینت برای trigger های rpz-client-ip
+func clientAddr(remote string) netip.Addr {
+	addr, _ := netip.AddrFromSlice(remoteIP(remote))
+	return addr.Unmap()
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dns-forwarder/pkg/mux"
+	"github.com/dns-forwarder/pkg/protocol"
+	"github.com/dns-forwarder/pkg/transport"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Session یک نشست تانل با کلاینت
+type Session struct {
+	id         uint64
+	conn       transport.Conn
+	remoteAddr string
+	since      time.Time
+	codec      atomic.Pointer[protocol.Codec]
+	batcher    atomic.Pointer[protocol.Batcher]
+	// frames جمع کردن قطعه‌های فریم‌های حالت fixed
+	frames protocol.Reassembler
+	mux    *mux.Mux
+	// user کاربری که کلیدش اولین فریم نشست را رمزگشایی کرد
+	user *User
+
+	udpMu     sync.Mutex
+	udpAssocs map[uint32]*udpAssoc
+
+	bytesIn  prometheus.Counter
+	bytesOut prometheus.Counter
+
+	// شمارنده‌های جدول نشست‌ها
+	queries    uint64
+	rxBytes    uint64
+	txBytes    uint64
+	lastActive int64
+	kicked     int32
+}
+
+var (
+	sessionsMu sync.RWMutex
+	// sessions جدول نشست‌های باز (با کاربر شناسایی‌شده) بر اساس شناسه
+	sessions      = make(map[uint64]*Session)
+	sessionNextID uint64
+)
+
+func newSession(conn transport.Conn) *Session {
+	s := &Session{
+		id:         atomic.AddUint64(&sessionNextID, 1),
+		conn:       conn,
+		remoteAddr: conn.RemoteAddr(),
+		since:      time.Now(),
+		lastActive: time.Now().UnixNano(),
+	}
+	s.mux = mux.New(func(msg *protocol.Message) error {
+		return sendResponse(s, msg)
+	}, config.Streams.Window, s.acceptStream)
+	return s
+}
+
+// register افزودن نشست به جدول نشست‌ها؛ پس از شناسایی کاربر صدا زده می‌شود
+func (s *Session) register() {
+	sessionsMu.Lock()
+	sessions[s.id] = s
+	sessionsMu.Unlock()
+}
+
+// unregister حذف نشست از جدول نشست‌ها
+func (s *Session) unregister() {
+	sessionsMu.Lock()
+	delete(sessions, s.id)
+	sessionsMu.Unlock()
+}
+
+// openSessions نشست‌های باز به ترتیب شناسه
+func openSessions() []*Session {
+	sessionsMu.RLock()
+	list := make([]*Session, 0, len(sessions))
+	for _, s := range sessions {
+		list = append(list, s)
+	}
+	sessionsMu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+	return list
+}
+
+// received ثبت یک فریم دریافتی معتبر
+func (s *Session) received(n int) {
+	atomic.AddUint64(&s.rxBytes, uint64(n))
+	atomic.StoreInt64(&s.lastActive, time.Now().UnixNano())
+	s.bytesIn.Add(float64(n))
+}
+
+// sent ثبت یک فریم ارسالی
+func (s *Session) sent(n int) {
+	atomic.AddUint64(&s.txBytes, uint64(n))
+	s.bytesOut.Add(float64(n))
+}
+
+// kick بستن نشست؛ حلقه خواندن serveSession با خطا پایان می‌یابد
+func (s *Session) kick(reason string) {
+	if !atomic.CompareAndSwapInt32(&s.kicked, 0, 1) {
+		return
+	}
+	sessionLog.Info("نشست بسته شد", "id", s.id, "remote", s.remoteAddr, "user", s.user.Name, "reason", reason)
+	s.conn.Close()
+}
+
+// handleHello پذیرش گزینه‌های پیشنهادی کلاینت و ارسال پاسخ
+func (s *Session) handleHello(msg *protocol.Message) {
+	requested, err := protocol.DecodeOptions(msg.Payload)
+	if err != nil {
+		sessionLog.Warn("خطا در خواندن گزینه‌های نشست", "remote", s.remoteAddr, "error", err)
+		return
+	}
+
+	accepted := requested.Negotiate(protocol.Policy{
+		AllowPadding:     !config.Obfuscation.DisablePadding,
+		AllowBatch:       !config.Batching.Disable,
+		AllowCompression: !config.Compression.Disable,
+		MaxPaddingSize:   config.Obfuscation.MaxPaddingSize,
+	})
+
+	// پاسخ با فریم خام ارسال می‌شود و پس از آن گزینه‌ها فعال می‌شوند
+	sendResponse(s, protocol.NewHelloAck(accepted))
+	s.codec.Store(protocol.NewCodec(accepted))
+	if accepted.Batch {
+		s.batcher.Store(protocol.NewBatcher(config.Batching.Delay, config.Batching.MaxBytes, func(msg *protocol.Message) {
+			sendResponse(s, msg)
+		}))
+	}
+
+	sessionLog.Info("گزینه‌های نشست", "remote", s.remoteAddr,
+		"padding", accepted.Padding, "padding_size", accepted.PaddingSize, "cover", accepted.Cover,
+		"batch", accepted.Batch, "compression", accepted.Compression)
+}
+
+// dispatch پردازش یک پیام دریافتی؛ پیام‌های دسته‌ای باز می‌شوند
+func (s *Session) dispatch(msg *protocol.Message) {
+	switch msg.Type {
+	case protocol.TypeDNSQuery:
+		// هنگام خاموش شدن درخواست جدید پذیرفته نمی‌شود؛ کلاینت پس از GoAway آن را دوباره می‌فرستد
+		if !inflight.Enter() {
+			dnsLog.Debug("درخواست هنگام خاموش شدن رد شد", "remote", s.remoteAddr)
+			return
+		}
+		go func() {
+			defer inflight.Leave()
+			handleDNSQuery(s, msg)
+		}()
+
+	case protocol.TypeHeartbeat:
+		response := protocol.NewHeartbeatAck()
+		sendResponse(s, response)
+
+	case protocol.TypeHello:
+		s.handleHello(msg)
+
+	case protocol.TypeCover:
+		// پاسخ پوششی با طول تصادفی تا جهت برگشت هم ترافیک داشته باشد
+		if opts := s.codec.Load().Options(); opts.Cover {
+			go sendResponse(s, protocol.NewCover(protocol.RandomInt(int(opts.PaddingSize)+1)))
+		}
+
+	case protocol.TypeStreamOpen, protocol.TypeStreamData, protocol.TypeStreamWindow, protocol.TypeStreamClose:
+		if !s.handshakeDone() {
+			return
+		}
+		s.mux.Handle(msg)
+
+	case protocol.TypeDatagram:
+		if !s.handshakeDone() {
+			return
+		}
+		go s.handleDatagram(msg)
+
+	case protocol.TypeDatagramClose:
+		if !s.handshakeDone() {
+			return
+		}
+		s.handleDatagramClose(msg)
+
+	case protocol.TypeBatch:
+		msgs, err := protocol.DecodeBatch(msg.Payload)
+		if err != nil {
+			sessionLog.Warn("خطا در باز کردن پیام دسته‌ای", "remote", s.remoteAddr, "error", err)
+			return
+		}
+		for _, inner := range msgs {
+			s.dispatch(inner)
+		}
+	}
+}
+
+// handshakeDone انتظار برای تکمیل handshake پیش از پیام‌های دارای اثر جانبی
+//
+// فریم‌های 0-RTT قابل تکرارند؛ فقط درخواست‌های DNS (بدون اثر جانبی) پیش از
+// تکمیل handshake پردازش می‌شوند و باز کردن stream و ارسال datagram منتظر
+// می‌ماند. اتصال تکراری مهاجم هرگز به این مرحله نمی‌رسد.
+func (s *Session) handshakeDone() bool {
+	early, ok := s.conn.(transport.EarlyConn)
+	if !ok || early.WaitHandshake() {
+		return true
+	}
+	sessionLog.Warn("پیام 0-RTT بدون تکمیل handshake رد شد", "remote", s.remoteAddr)
+	return false
+}
+
+// sendDNSResponse ارسال پاسخ DNS، در صورت مذاکره از طریق batcher
+func (s *Session) sendDNSResponse(msg *protocol.Message) {
+	if batcher := s.batcher.Load(); batcher != nil {
+		batcher.Add(msg)
+		return
+	}
+	sendResponse(s, msg)
+}
+
+// logOverhead ثبت سربار padding و نسبت فشرده‌سازی در پایان نشست
+func (s *Session) logOverhead() {
+	codec := s.codec.Load()
+	if payload, overhead := codec.Overhead(); overhead > 0 {
+		sessionLog.Info("سربار نشست", "remote", s.remoteAddr, "payload_bytes", payload, "overhead_bytes", overhead)
+	}
+	if raw, compressed := codec.CompressionRatio(); raw > 0 {
+		sessionLog.Info("فشرده‌سازی نشست", "remote", s.remoteAddr, "raw_bytes", raw, "compressed_bytes", compressed,
+			"ratio", float64(compressed)/float64(raw))
+	}
+}
+
+// sendJitter تاخیر تصادفی قبل از ارسال
+func sendJitter() {
+	if config.Obfuscation.Jitter > 0 {
+		time.Sleep(time.Duration(protocol.RandomInt(int(config.Obfuscation.Jitter))))
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/dns-forwarder/pkg/drain"
+	"github.com/dns-forwarder/pkg/logging"
+	"github.com/dns-forwarder/pkg/protocol"
+	"github.com/dns-forwarder/pkg/transport"
+)
+
+// flushTimeout مهلت ارسال داده‌های باقی‌مانده tracing پس از پایان تخلیه
+const flushTimeout = 5 * time.Second
+
+var (
+	// inflight درخواست‌های DNS تانل در حال پردازش؛ با خاموش شدن بسته می‌شود
+	inflight drain.Group
+
+	// شنونده‌های جانبی که هنگام خاموش شدن بسته می‌شوند
+	streamListener net.Listener
+	quicServer     *transport.QUICServer
+)
+
+// shuttingDown اینکه خاموش شدن شروع شده است؛ خطای پذیرش شنونده‌ها پس از آن عادی است
+func shuttingDown() bool {
+	return inflight.Closed()
+}
+
+// waitShutdown انتظار برای SIGINT یا SIGTERM و خاموش کردن آرام سرور
+//
+// پذیرش اتصال و درخواست جدید متوقف می‌شود، به نشست‌ها پیام GoAway فرستاده
+// می‌شود تا کلاینت‌ها فوراً به سرور دیگری بروند و تا shutdown_timeout برای
+// پاسخ درخواست‌های در حال پردازش صبر می‌شود. سیگنال دوم برنامه را فوراً می‌بندد.
+func waitShutdown(httpServer *http.Server) {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-stop
+	signal.Stop(stop)
+
+	mainLog.Info("خاموش شدن سرور", "signal", sig.String(), "timeout", config.Server.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), config.Server.ShutdownTimeout)
+	defer cancel()
+
+	// توقف پذیرش اتصال و درخواست جدید
+	inflight.Close()
+	if streamListener != nil {
+		streamListener.Close()
+	}
+	if quicServer != nil {
+		quicServer.Shutdown()
+	}
+	httpDone := make(chan struct{})
+	go func() {
+		httpServer.Shutdown(ctx)
+		close(httpDone)
+	}()
+
+	open := openSessions()
+	for _, s := range open {
+		sendResponse(s, protocol.NewGoAway("shutdown"))
+	}
+	sessionLog.Info("GoAway به نشست‌ها ارسال شد", "sessions", len(open))
+
+	if err := inflight.Wait(ctx); err != nil {
+		mainLog.Warn("پایان مهلت خاموش شدن؛ درخواست‌های باقی‌مانده رها شدند")
+	}
+
+	// ارسال پاسخ‌های مانده در صف و بستن نشست‌ها با فریم بستن
+	for _, s := range openSessions() {
+		if b := s.batcher.Load(); b != nil {
+			b.Flush()
+		}
+		s.kick("shutdown")
+	}
+	if quicServer != nil {
+		quicServer.Close()
+	}
+	select {
+	case <-httpDone:
+	case <-ctx.Done():
+		httpServer.Close()
+	}
+
+	flushOutputs()
+	mainLog.Info("سرور خاموش شد")
+}
+
+// flushOutputs نوشتن داده‌های باقی‌مانده dnstap، tracing و لاگ‌ها
+func flushOutputs() {
+	if tap != nil {
+		if err := tap.Close(); err != nil {
+			mainLog.Warn("خطا در بستن dnstap", "error", err)
+		}
+	}
+	if shutdownTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			mainLog.Warn("خطا در ارسال span های باقی‌مانده", "error", err)
+		}
+	}
+	logging.Sync()
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/dns-forwarder/pkg/domainlist"
+	"github.com/dns-forwarder/pkg/mux"
+)
+
+// streamPolicy فهرست مقصدهای مجاز جریان‌های TCP
+var streamPolicy *destPolicy
+
+// errDestDenied مقصد در فهرست مجاز نیست
+var errDestDenied = errors.New("destination not allowed")
+
+// destRule یک قاعده مقصد به شکل host:ports
+//
+// host می‌تواند *، دامنه (با پیشوندهای domainlist)، IP یا CIDR باشد و
+// ports می‌تواند *، یک پورت، فهرست جداشده با کاما یا بازه 8000-9000 باشد.
+type destRule struct {
+	any     bool
+	domains *domainlist.List
+	prefix  netip.Prefix
+	ports   [][2]uint16
+}
+
+// parseDestRule خواندن یک قاعده مقصد
+func parseDestRule(entry string) (destRule, error) {
+	var rule destRule
+
+	i := strings.LastIndex(entry, ":")
+	if i < 0 {
+		return rule, fmt.Errorf("missing port in %q", entry)
+	}
+	host := strings.Trim(entry[:i], "[]")
+	ports := entry[i+1:]
+
+	switch {
+	case host == "*":
+		rule.any = true
+	case strings.Contains(host, "/"):
+		prefix, err := netip.ParsePrefix(host)
+		if err != nil {
+			return rule, err
+		}
+		rule.prefix = prefix.Masked()
+	default:
+		if addr, err := netip.ParseAddr(host); err == nil {
+			rule.prefix = netip.PrefixFrom(addr, addr.BitLen())
+			break
+		}
+		domains, err := domainlist.New(host)
+		if err != nil {
+			return rule, err
+		}
+		rule.domains = domains
+	}
+
+	if ports == "*" {
+		return rule, nil
+	}
+	for _, part := range strings.Split(ports, ",") {
+		lo, hi, found := strings.Cut(part, "-")
+		if !found {
+			hi = lo
+		}
+		from, err := strconv.ParseUint(lo, 10, 16)
+		if err != nil {
+			return rule, fmt.Errorf("invalid port in %q", entry)
+		}
+		to, err := strconv.ParseUint(hi, 10, 16)
+		if err != nil || to < from {
+			return rule, fmt.Errorf("invalid port in %q", entry)
+		}
+		rule.ports = append(rule.ports, [2]uint16{uint16(from), uint16(to)})
+	}
+	return rule, nil
+}
+
+// match بررسی تطابق نام، IP و پورت مقصد
+func (r destRule) match(host string, ip netip.Addr, port uint16) bool {
+	if r.ports != nil {
+		ok := false
+		for _, pr := range r.ports {
+			if port >= pr[0] && port <= pr[1] {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	switch {
+	case r.any:
+		return true
+	case r.domains != nil:
+		return host != "" && r.domains.Match(host)
+	default:
+		return r.prefix.Contains(ip.Unmap())
+	}
+}
+
+// destPolicy قواعد مجاز و ممنوع مقصدها؛ قواعد ممنوع اولویت دارند
+type destPolicy struct {
+	allow []destRule
+	deny  []destRule
+}
+
+// newDestPolicy ساخت سیاست مقصد از تنظیمات
+func newDestPolicy(allow, deny []string) (*destPolicy, error) {
+	p := &destPolicy{}
+	for _, entry := range allow {
+		rule, err := parseDestRule(entry)
+		if err != nil {
+			return nil, err
+		}
+		p.allow = append(p.allow, rule)
+	}
+	for _, entry := range deny {
+		rule, err := parseDestRule(entry)
+		if err != nil {
+			return nil, err
+		}
+		p.deny = append(p.deny, rule)
+	}
+	return p, nil
+}
+
+// permits بررسی مجاز بودن یک IP مقصد
+func (p *destPolicy) permits(host string, ip netip.Addr, port uint16) bool {
+	for _, rule := range p.deny {
+		if rule.match(host, ip, port) {
+			return false
+		}
+	}
+	for _, rule := range p.allow {
+		if rule.match(host, ip, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve تبدیل مقصد به آدرس قابل اتصال پس از بررسی سیاست
+//
+// نام مقصد همین‌جا resolve می‌شود و به IP بررسی‌شده وصل می‌شویم تا
+// تغییر پاسخ DNS بین بررسی و اتصال راهی برای دور زدن فهرست نباشد.
+func (p *destPolicy) resolve(ctx context.Context, addr string) (string, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return "", err
+	}
+
+	var ips []netip.Addr
+	name := ""
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ips = []netip.Addr{ip}
+	} else {
+		name = host
+		ips, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	for _, ip := range ips {
+		if p.permits(name, ip, uint16(port)) {
+			return netip.AddrPortFrom(ip.Unmap(), uint16(port)).String(), nil
+		}
+	}
+	return "", errDestDenied
+}
+
+// setupStreams آماده‌سازی فهرست مقصدهای مجاز
+func setupStreams() error {
+	policy, err := newDestPolicy(config.Streams.Allow, config.Streams.Deny)
+	if err != nil {
+		return err
+	}
+	streamPolicy = policy
+	return nil
+}
+
+// acceptStream اتصال به مقصد درخواستی کلاینت و جابه‌جایی داده
+func (s *Session) acceptStream(stream *mux.Stream, addr string) {
+	if !config.Streams.Enabled {
+		stream.Reject(mux.ReasonDisabled)
+		return
+	}
+	if s.mux.Len() > config.Streams.MaxPerSession {
+		stream.Reject(mux.ReasonLimit)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Streams.DialTimeout)
+	defer cancel()
+
+	target, err := streamPolicy.resolve(ctx, addr)
+	if err != nil {
+		streamLog.Warn("جریان رد شد", "remote", s.remoteAddr, "addr", addr, "error", err)
+		if errors.Is(err, errDestDenied) {
+			stream.Reject(mux.ReasonNotAllowed)
+		} else {
+			stream.Reject(mux.ReasonUnreachable)
+		}
+		return
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		streamLog.Warn("خطا در اتصال به مقصد", "addr", addr, "error", err)
+		stream.Reject(mux.ReasonUnreachable)
+		return
+	}
+
+	if err := stream.Accept(); err != nil {
+		conn.Close()
+		return
+	}
+
+	streamLog.Info("جریان جدید", "id", stream.ID(), "remote", s.remoteAddr, "addr", addr)
+	mux.Relay(stream, conn)
+
+	in, out := stream.Bytes()
+	streamLog.Info("جریان بسته شد", "id", stream.ID(), "bytes_up", in, "bytes_down", out)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+
+	"github.com/dns-forwarder/pkg/tracing"
+)
+
+// tracer span های سرور؛ تا فعال شدن tracing بدون اثر است
+var tracer = tracing.Tracer("dns-forwarder/server")
+
+// shutdownTracing ارسال span های باقی‌مانده هنگام خروج؛ nil یعنی tracing غیرفعال
+var shutdownTracing func(context.Context) error
+
+// setupTracing راه‌اندازی خروجی OTLP
+func setupTracing() (err error) {
+	shutdownTracing, err = tracing.Setup(config.Tracing)
+	return err
+}
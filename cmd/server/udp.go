@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dns-forwarder/pkg/protocol"
+)
+
+// udpPolicy فهرست مقصدهای مجاز بسته‌های UDP
+var udpPolicy *destPolicy
+
+// دلایل پایان association
+const (
+	udpReasonDisabled = "disabled"
+	udpReasonLimit    = "limit"
+	udpReasonQuota    = "quota"
+	udpReasonIdle     = "idle"
+)
+
+// udpAssoc یک association UDP کلاینت روی سرور
+//
+// فقط پاسخ مقصدهایی که قبلاً به آن‌ها بسته فرستاده شده پذیرفته می‌شود.
+type udpAssoc struct {
+	id   uint32
+	sess *Session
+	conn *net.UDPConn
+
+	mu       sync.Mutex
+	targets  map[string]*net.UDPAddr
+	peers    map[string]bool
+	lastSeen int64
+
+	bytesOut uint64
+	bytesIn  uint64
+}
+
+// setupUDP آماده‌سازی فهرست مقصدهای مجاز UDP
+func setupUDP() error {
+	policy, err := newDestPolicy(config.UDP.Allow, config.UDP.Deny)
+	if err != nil {
+		return err
+	}
+	udpPolicy = policy
+	return nil
+}
+
+// handleDatagram ارسال بسته UDP کلاینت به مقصد
+func (s *Session) handleDatagram(msg *protocol.Message) {
+	addr, data, err := protocol.DecodeDatagram(msg.Payload)
+	if err != nil {
+		udpLog.Warn("خطا در خواندن بسته UDP", "remote", s.remoteAddr, "error", err)
+		return
+	}
+
+	assoc, reason := s.udpAssoc(msg.RequestID)
+	if assoc == nil {
+		sendResponse(s, protocol.NewDatagramClose(msg.RequestID, reason))
+		return
+	}
+
+	target, err := assoc.resolve(addr)
+	if err != nil {
+		udpLog.Warn("بسته UDP رد شد", "remote", s.remoteAddr, "addr", addr, "error", err)
+		return
+	}
+
+	// سهمیه فقط برای بسته‌ای که واقعاً به مقصد مجاز ارسال می‌شود مصرف می‌شود
+	if !s.user.consumeUDP(len(data)) {
+		udpLog.Warn("سهمیه UDP کاربر تمام شد", "user", s.user.Name)
+		s.closeUDP(assoc, udpReasonQuota)
+		return
+	}
+
+	atomic.StoreInt64(&assoc.lastSeen, time.Now().UnixNano())
+	if _, err := assoc.conn.WriteToUDP(data, target); err != nil {
+		udpLog.Warn("خطا در ارسال بسته UDP", "addr", addr, "error", err)
+		return
+	}
+	atomic.AddUint64(&assoc.bytesOut, uint64(len(data)))
+}
+
+// udpAssoc یافتن یا ایجاد association؛ در صورت رد دلیل آن برگردانده می‌شود
+func (s *Session) udpAssoc(id uint32) (*udpAssoc, string) {
+	s.udpMu.Lock()
+	defer s.udpMu.Unlock()
+
+	if assoc, ok := s.udpAssocs[id]; ok {
+		return assoc, ""
+	}
+	if !config.UDP.Enabled {
+		return nil, udpReasonDisabled
+	}
+	if !s.user.acquireUDP() {
+		return nil, udpReasonLimit
+	}
+
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		s.user.releaseUDP()
+		udpLog.Error("خطا در ایجاد سوکت UDP", "error", err)
+		return nil, udpReasonLimit
+	}
+
+	assoc := &udpAssoc{
+		id:       id,
+		sess:     s,
+		conn:     conn,
+		targets:  make(map[string]*net.UDPAddr),
+		peers:    make(map[string]bool),
+		lastSeen: time.Now().UnixNano(),
+	}
+	if s.udpAssocs == nil {
+		s.udpAssocs = make(map[uint32]*udpAssoc)
+	}
+	s.udpAssocs[id] = assoc
+
+	udpLog.Info("association UDP جدید", "id", id, "remote", s.remoteAddr, "user", s.user.Name)
+	go assoc.readLoop()
+	return assoc, ""
+}
+
+// closeUDP بستن association و اطلاع به کلاینت (reason خالی یعنی درخواست خود کلاینت)
+func (s *Session) closeUDP(assoc *udpAssoc, reason string) {
+	s.udpMu.Lock()
+	if s.udpAssocs[assoc.id] != assoc {
+		s.udpMu.Unlock()
+		return
+	}
+	delete(s.udpAssocs, assoc.id)
+	s.udpMu.Unlock()
+
+	assoc.conn.Close()
+	s.user.releaseUDP()
+	if reason != "" {
+		sendResponse(s, protocol.NewDatagramClose(assoc.id, reason))
+	}
+
+	udpLog.Info("association UDP بسته شد", "id", assoc.id, "reason", reason,
+		"bytes_out", atomic.LoadUint64(&assoc.bytesOut), "bytes_in", atomic.LoadUint64(&assoc.bytesIn))
+}
+
+// handleDatagramClose بستن association به درخواست کلاینت
+func (s *Session) handleDatagramClose(msg *protocol.Message) {
+	s.udpMu.Lock()
+	assoc := s.udpAssocs[msg.RequestID]
+	s.udpMu.Unlock()
+
+	if assoc != nil {
+		s.closeUDP(assoc, "")
+	}
+}
+
+// closeAllUDP بستن همه association های نشست پس از قطع تانل
+func (s *Session) closeAllUDP() {
+	s.udpMu.Lock()
+	assocs := make([]*udpAssoc, 0, len(s.udpAssocs))
+	for _, assoc := range s.udpAssocs {
+		assocs = append(assocs, assoc)
+	}
+	s.udpMu.Unlock()
+
+	for _, assoc := range assocs {
+		s.closeUDP(assoc, "")
+	}
+}
+
+// resolve تبدیل مقصد به آدرس بررسی‌شده؛ نتیجه برای بسته‌های بعدی نگه داشته می‌شود
+func (a *udpAssoc) resolve(addr string) (*net.UDPAddr, error) {
+	a.mu.Lock()
+	target, ok := a.targets[addr]
+	a.mu.Unlock()
+	if ok {
+		return target, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.DNS.Timeout)
+	defer cancel()
+
+	resolved, err := udpPolicy.resolve(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	target, err = net.ResolveUDPAddr("udp", resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	a.targets[addr] = target
+	a.peers[target.String()] = true
+	a.mu.Unlock()
+	return target, nil
+}
+
+// readLoop دریافت پاسخ مقصدها و بستن association پس از بیکاری
+func (a *udpAssoc) readLoop() {
+	s := a.sess
+	buf := make([]byte, protocol.MaxDatagramSize)
+
+	for {
+		a.conn.SetReadDeadline(time.Now().Add(config.UDP.IdleTimeout))
+		n, from, err := a.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				idle := time.Since(time.Unix(0, atomic.LoadInt64(&a.lastSeen)))
+				if idle < config.UDP.IdleTimeout {
+					continue
+				}
+				s.closeUDP(a, udpReasonIdle)
+			}
+			return
+		}
+
+		a.mu.Lock()
+		known := a.peers[from.String()]
+		a.mu.Unlock()
+		if !known {
+			continue
+		}
+
+		if !s.user.consumeUDP(n) {
+			udpLog.Warn("سهمیه UDP کاربر تمام شد", "user", s.user.Name)
+			s.closeUDP(a, udpReasonQuota)
+			return
+		}
+
+		atomic.StoreInt64(&a.lastSeen, time.Now().UnixNano())
+		atomic.AddUint64(&a.bytesIn, uint64(n))
+		sendResponse(s, protocol.NewDatagram(a.id, from.String(), buf[:n]))
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/dns-forwarder/pkg/crypto"
+)
+
+// UserConfig تنظیمات یک کاربر تانل
+type UserConfig struct {
+	Name     string `yaml:"name"`
+	Password string `yaml:"password"`
+	UDP      struct {
+		QuotaBytes  int64 `yaml:"quota_bytes"`
+		MaxSessions int   `yaml:"max_sessions"`
+	} `yaml:"udp"`
+}
+
+// User کاربر تانل
+//
+// هر کاربر رمز جداگانه دارد و هویت نشست با کلیدی که اولین فریم آن را
+// رمزگشایی می‌کند مشخص می‌شود.
+type User struct {
+	Name      string
+	password  string
+	encryptor *crypto.Encryptor
+
+	udpQuota    int64
+	udpMaxAssoc int32
+	udpBytes    int64
+	udpAssocs   int32
+}
+
+// users کاربران تانل؛ server.password کاربر default است
+//
+// با بارگذاری مجدد تنظیمات کل فهرست جایگزین می‌شود؛ نشست‌های باز کاربر
+// قبلی خود را نگه می‌دارند.
+var users atomic.Pointer[[]*User]
+
+// userSalt salt رمزنگاری کاربران (تغییر آن نیاز به راه‌اندازی مجدد دارد)
+var userSalt []byte
+
+// errUnknownUser فریم با کلید هیچ کاربری رمزگشایی نشد
+var errUnknownUser = errors.New("no user key matches")
+
+// setupUsers ساخت رمزنگار هر کاربر
+func setupUsers(salt []byte) error {
+	userSalt = salt
+	list, err := buildUsers(&config, nil)
+	if err != nil {
+		return err
+	}
+	users.Store(&list)
+
+	userLog.Info("کاربران تعریف شدند", "count", len(list))
+	return nil
+}
+
+// currentUsers فهرست فعلی کاربران
+func currentUsers() []*User {
+	return *users.Load()
+}
+
+// buildUsers ساخت کاربران از تنظیمات
+//
+// کاربری که نام و رمزش در previous تغییر نکرده همان شیء قبلی را نگه می‌دارد
+// تا مصرف و association های UDP آن حفظ شود؛ سهمیه‌های جدید فقط در صورت
+// موفقیت کل فهرست روی آن اعمال می‌شوند.
+func buildUsers(cfg *Config, previous []*User) ([]*User, error) {
+	configs := cfg.Users
+	if cfg.Server.Password != "" {
+		def := UserConfig{Name: "default", Password: cfg.Server.Password}
+		configs = append([]UserConfig{def}, configs...)
+	}
+	if len(configs) == 0 {
+		return nil, errors.New("no password or users configured")
+	}
+
+	type quota struct {
+		user     *User
+		bytes    int64
+		maxAssoc int32
+	}
+	var quotas []quota
+
+	var list []*User
+	seen := make(map[string]bool)
+	for _, uc := range configs {
+		if uc.Name == "" || uc.Password == "" {
+			return nil, errors.New("user without name or password")
+		}
+		if seen[uc.Name] {
+			return nil, fmt.Errorf("duplicate user %q", uc.Name)
+		}
+		seen[uc.Name] = true
+
+		q := quota{bytes: uc.UDP.QuotaBytes, maxAssoc: int32(uc.UDP.MaxSessions)}
+		if q.bytes == 0 {
+			q.bytes = cfg.UDP.QuotaBytes
+		}
+		if q.maxAssoc == 0 {
+			q.maxAssoc = int32(cfg.UDP.MaxSessions)
+		}
+
+		user := findUser(previous, uc.Name)
+		if user == nil || user.password != uc.Password {
+			enc, err := crypto.NewEncryptor(uc.Password, userSalt)
+			if err != nil {
+				return nil, err
+			}
+			user = &User{Name: uc.Name, password: uc.Password, encryptor: enc}
+		}
+		q.user = user
+		quotas = append(quotas, q)
+		list = append(list, user)
+	}
+
+	for _, q := range quotas {
+		atomic.StoreInt64(&q.user.udpQuota, q.bytes)
+		atomic.StoreInt32(&q.user.udpMaxAssoc, q.maxAssoc)
+	}
+	return list, nil
+}
+
+// findUser یافتن کاربر با نام
+func findUser(list []*User, name string) *User {
+	for _, user := range list {
+		if user.Name == name {
+			return user
+		}
+	}
+	return nil
+}
+
+// identify یافتن کاربری که کلیدش فریم را رمزگشایی می‌کند
+func identify(encrypted []byte) (*User, []byte, error) {
+	for _, user := range currentUsers() {
+		if frame, err := user.encryptor.Decrypt(encrypted); err == nil {
+			return user, frame, nil
+		}
+	}
+	return nil, nil, errUnknownUser
+}
+
+// consumeUDP ثبت مصرف UDP؛ false اگر سهمیه دوره تمام شده باشد
+func (u *User) consumeUDP(n int) bool {
+	used := atomic.AddInt64(&u.udpBytes, int64(n))
+	quota := atomic.LoadInt64(&u.udpQuota)
+	return quota <= 0 || used <= quota
+}
+
+// acquireUDP رزرو یک association برای کاربر
+func (u *User) acquireUDP() bool {
+	limit := atomic.LoadInt32(&u.udpMaxAssoc)
+	if atomic.AddInt32(&u.udpAssocs, 1) > limit && limit > 0 {
+		atomic.AddInt32(&u.udpAssocs, -1)
+		return false
+	}
+	return true
+}
+
+// releaseUDP آزاد کردن association کاربر
+func (u *User) releaseUDP() {
+	atomic.AddInt32(&u.udpAssocs, -1)
+}
+
+// quotaResetLoop صفر کردن مصرف UDP کاربران در ابتدای هر دوره
+func quotaResetLoop() {
+	ticker := time.NewTicker(config.UDP.QuotaPeriod)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, user := range currentUsers() {
+			if used := atomic.SwapInt64(&user.udpBytes, 0); used > 0 {
+				userLog.Info("مصرف UDP کاربر در دوره گذشته", "user", user.Name, "bytes", used)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Package admin ابزارهای مشترک API مدیریتی HTTP (احراز هویت با توکن و پاسخ JSON)
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// CheckListen بررسی اینکه نشانی گوش دادن API مدیریتی فقط روی loopback باشد
+func CheckListen(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return errors.New("admin listen address must be loopback")
+	}
+	return nil
+}
+
+// Protect بررسی توکن Bearer پیش از اجرای handler
+//
+// درخواست بدون توکن یا با توکن نادرست به denied سپرده می‌شود؛ اگر denied
+// nil باشد پاسخ 401 می‌گیرد.
+func Protect(token string, h, denied http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			if denied != nil {
+				denied.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			Error(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Method محدود کردن handler به یک متد HTTP
+func Method(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			Error(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// JSON نوشتن پاسخ JSON
+func JSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// Error نوشتن خطا به شکل {"error": "..."}
+func Error(w http.ResponseWriter, status int, msg string) {
+	JSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,103 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProtect(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	decoy := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	tests := []struct {
+		name   string
+		token  string
+		auth   string
+		denied http.Handler
+		status int
+	}{
+		{"valid token", "secret", "Bearer secret", nil, http.StatusNoContent},
+		{"wrong token", "secret", "Bearer wrong", nil, http.StatusUnauthorized},
+		{"token prefix", "secret", "Bearer secre", nil, http.StatusUnauthorized},
+		{"missing header", "secret", "", nil, http.StatusUnauthorized},
+		{"bare token", "secret", "secret", nil, http.StatusNoContent},
+		{"empty configured token", "", "Bearer ", nil, http.StatusUnauthorized},
+		{"empty configured token no header", "", "", nil, http.StatusUnauthorized},
+		{"denied handler", "secret", "Bearer wrong", decoy, http.StatusNotFound},
+		{"denied handler valid token", "secret", "Bearer secret", decoy, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/stats", nil)
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+
+			Protect(tt.token, ok, tt.denied).ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusUnauthorized {
+				return
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != `Bearer realm="admin"` {
+				t.Fatalf("WWW-Authenticate = %q", got)
+			}
+			var body map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error"] != "unauthorized" {
+				t.Fatalf("unexpected body %q", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCheckListen(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{"127.0.0.1:9154", false},
+		{"127.0.0.2:9154", false},
+		{"[::1]:9154", false},
+		{"localhost:9154", false},
+		{"0.0.0.0:9154", true},
+		{":9154", true},
+		{"[::]:9154", true},
+		{"192.0.2.1:9154", true},
+		{"example.com:9154", true},
+		{"127.0.0.1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if err := CheckListen(tt.addr); (err != nil) != tt.wantErr {
+				t.Fatalf("CheckListen(%q) = %v, wantErr %v", tt.addr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMethod(t *testing.T) {
+	h := Method(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/reload", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("POST status = %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/reload", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodPost {
+		t.Fatalf("GET status = %d, Allow = %q", w.Code, w.Header().Get("Allow"))
+	}
+}
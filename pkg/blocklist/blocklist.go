@@ -0,0 +1,260 @@
+// Package blocklist مسدودسازی دامنه‌ها با فهرست‌های تبلیغات و بدافزار
+//
+// فهرست‌ها از فایل‌های محلی با قالب hosts، AdBlock یا فهرست ساده دامنه‌ها
+// خوانده می‌شوند. فهرست allow (و قواعد استثنای @@ در AdBlock) بر همه
+// فهرست‌ها اولویت دارد. تطبیق پسوندی با جدول hash روی برچسب‌های نام انجام
+// می‌شود و هزینه آن به تعداد ورودی‌ها بستگی ندارد.
+package blocklist
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/dns-forwarder/pkg/domainlist"
+	"github.com/miekg/dns"
+)
+
+// Action پاسخ به درخواست مسدودشده
+type Action int
+
+const (
+	// ActionNXDomain پاسخ NXDOMAIN (پیش‌فرض)
+	ActionNXDomain Action = iota
+	// ActionNullIP پاسخ 0.0.0.0 یا :: و پاسخ خالی برای بقیه نوع‌ها
+	ActionNullIP
+	// ActionRefused پاسخ REFUSED
+	ActionRefused
+)
+
+// ParseAction خواندن نام action؛ خالی یعنی nxdomain
+func ParseAction(name string) (Action, error) {
+	switch name {
+	case "", "nxdomain":
+		return ActionNXDomain, nil
+	case "null_ip":
+		return ActionNullIP, nil
+	case "refused":
+		return ActionRefused, nil
+	}
+	return 0, fmt.Errorf("invalid blocklist action %q", name)
+}
+
+// Config تنظیمات مسدودسازی
+type Config struct {
+	// Action یکی از nxdomain، null_ip یا refused
+	Action string `yaml:"action"`
+	// TTL پاسخ‌های null_ip
+	TTL time.Duration `yaml:"ttl"`
+	// ReloadInterval فاصله خواندن دوباره فایل‌ها (صفر = غیرفعال)
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+	// Allow دامنه‌هایی که هرگز مسدود نمی‌شوند (قالب domainlist)
+	Allow      []string     `yaml:"allow"`
+	AllowFiles []string     `yaml:"allow_files"`
+	Lists      []ListConfig `yaml:"lists"`
+}
+
+// ListConfig یک فهرست مسدودسازی
+type ListConfig struct {
+	Name string `yaml:"name"`
+	// Format یکی از hosts، adblock یا domains (پیش‌فرض)
+	Format  string   `yaml:"format"`
+	Files   []string `yaml:"files"`
+	Domains []string `yaml:"domains"`
+}
+
+// Filter فهرست‌های بارگذاری‌شده؛ پس از ساخت فقط خواندنی است
+type Filter struct {
+	cfg    Config
+	action Action
+	ttl    uint32
+	allow  *domainlist.List
+	lists  []*list
+	// overrides تعداد درخواست‌های منطبق با فهرست که allow آن‌ها را آزاد کرد
+	overrides *uint64
+	loaded    time.Time
+}
+
+type list struct {
+	name    string
+	domains *domainlist.List
+	hits    *uint64
+	// invalid خط‌های نادیده‌گرفته‌شده فایل‌ها
+	invalid int
+}
+
+// ListStats آمار یک فهرست
+type ListStats struct {
+	Name    string `json:"name"`
+	Entries int    `json:"entries"`
+	// Invalid خط‌های خراب فایل‌ها که نادیده گرفته شدند
+	Invalid int    `json:"invalid"`
+	Hits    uint64 `json:"hits"`
+}
+
+// Load خواندن همه فهرست‌ها؛ شمارنده‌های فهرست‌های هم‌نام previous حفظ می‌شوند
+func Load(cfg Config, previous *Filter) (*Filter, error) {
+	action, err := ParseAction(cfg.Action)
+	if err != nil {
+		return nil, err
+	}
+
+	allow, err := domainlist.New(cfg.Allow...)
+	if err != nil {
+		return nil, fmt.Errorf("allow: %w", err)
+	}
+	for _, file := range cfg.AllowFiles {
+		if err := allow.LoadFile(file); err != nil {
+			return nil, fmt.Errorf("allow: %w", err)
+		}
+	}
+
+	f := &Filter{
+		cfg:       cfg,
+		action:    action,
+		ttl:       uint32(cfg.TTL / time.Second),
+		allow:     allow,
+		overrides: new(uint64),
+		loaded:    time.Now(),
+	}
+	if previous != nil {
+		f.overrides = previous.overrides
+	}
+
+	for i, lc := range cfg.Lists {
+		name := lc.Name
+		if name == "" {
+			name = fmt.Sprintf("list-%d", i+1)
+		}
+
+		domains, err := domainlist.New(lc.Domains...)
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", name, err)
+		}
+		invalid := 0
+		for _, file := range lc.Files {
+			n, err := loadFile(file, lc.Format, domains, allow)
+			if err != nil {
+				return nil, fmt.Errorf("list %s: %w", name, err)
+			}
+			invalid += n
+		}
+
+		hits := new(uint64)
+		if old := previous.find(name); old != nil {
+			hits = old.hits
+		}
+		f.lists = append(f.lists, &list{name: name, domains: domains, hits: hits, invalid: invalid})
+	}
+
+	return f, nil
+}
+
+func (f *Filter) find(name string) *list {
+	if f == nil {
+		return nil
+	}
+	for _, l := range f.lists {
+		if l.name == name {
+			return l
+		}
+	}
+	return nil
+}
+
+// Config تنظیماتی که فیلتر با آن ساخته شده است (برای بارگذاری دوره‌ای)
+func (f *Filter) Config() Config {
+	return f.cfg
+}
+
+// Check نام اولین فهرست منطبق با نام؛ خالی اگر مسدود نباشد یا در allow باشد
+func (f *Filter) Check(name string) string {
+	if f == nil {
+		return ""
+	}
+	for _, l := range f.lists {
+		if l.domains.Match(name) {
+			if f.allow.Match(name) {
+				atomic.AddUint64(f.overrides, 1)
+				return ""
+			}
+			atomic.AddUint64(l.hits, 1)
+			return l.name
+		}
+	}
+	return ""
+}
+
+// Block ساخت پاسخ درخواست مسدودشده بر اساس action
+func (f *Filter) Block(r *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.RecursionAvailable = true
+
+	switch f.action {
+	case ActionRefused:
+		m.Rcode = dns.RcodeRefused
+	case ActionNullIP:
+		if len(r.Question) == 0 {
+			break
+		}
+		q := r.Question[0]
+		hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: f.ttl}
+		switch q.Qtype {
+		case dns.TypeA:
+			m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: net.IPv4zero})
+		case dns.TypeAAAA:
+			m.Answer = append(m.Answer, &dns.AAAA{Hdr: hdr, AAAA: net.IPv6zero})
+		}
+	default:
+		m.Rcode = dns.RcodeNameError
+	}
+	return m
+}
+
+// Stats آمار فهرست‌ها به ترتیب تنظیمات
+func (f *Filter) Stats() []ListStats {
+	if f == nil {
+		return nil
+	}
+	out := make([]ListStats, 0, len(f.lists))
+	for _, l := range f.lists {
+		out = append(out, ListStats{Name: l.name, Entries: l.domains.Len(), Invalid: l.invalid, Hits: atomic.LoadUint64(l.hits)})
+	}
+	return out
+}
+
+// Overrides تعداد درخواست‌هایی که با allow آزاد شدند
+func (f *Filter) Overrides() uint64 {
+	if f == nil {
+		return 0
+	}
+	return atomic.LoadUint64(f.overrides)
+}
+
+// AllowEntries تعداد ورودی‌های allow (شامل استثناهای AdBlock)
+func (f *Filter) AllowEntries() int {
+	if f == nil {
+		return 0
+	}
+	return f.allow.Len()
+}
+
+// Status خلاصه وضعیت فیلتر برای API مدیریتی
+type Status struct {
+	Lists        []ListStats `json:"lists"`
+	AllowEntries int         `json:"allow_entries"`
+	Allowed      uint64      `json:"allowed"`
+	Loaded       time.Time   `json:"loaded_at"`
+}
+
+// Status وضعیت فعلی فهرست‌ها و شمارنده‌ها
+func (f *Filter) Status() Status {
+	return Status{
+		Lists:        f.Stats(),
+		AllowEntries: f.AllowEntries(),
+		Allowed:      f.Overrides(),
+		Loaded:       f.loaded,
+	}
+}
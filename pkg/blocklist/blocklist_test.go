@@ -0,0 +1,261 @@
+package blocklist
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/dns-forwarder/pkg/domainlist"
+	"github.com/miekg/dns"
+)
+
+func loadTestFilter(t *testing.T, action string) *Filter {
+	t.Helper()
+	f, err := Load(Config{
+		Action: action,
+		Allow:  []string{"full:ok.tracker.example"},
+		Lists: []ListConfig{
+			{Name: "hosts", Format: FormatHosts, Files: []string{"testdata/hosts"}},
+			{Name: "ads", Format: FormatAdBlock, Files: []string{"testdata/adblock.txt"}},
+			{Format: FormatDomains, Domains: []string{"malware.example"}},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestParseHosts(t *testing.T) {
+	tests := []struct {
+		line    string
+		added   int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"# توضیح", 0, false},
+		{"0.0.0.0 a.example", 1, false},
+		{"0.0.0.0 a.example b.example # توضیح", 2, false},
+		{"127.0.0.1 localhost", 0, false},
+		{"fe80::1%eth0 a.example", 1, false},
+		{"a.example", 0, true},
+		{"not-an-ip a.example", 0, true},
+		{"0.0.0.0 bad..name a.example", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			block, allow := newList(t), newList(t)
+			err := parseHosts(tt.line, block, allow)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if block.Len() != tt.added || allow.Len() != 0 {
+				t.Fatalf("added %d/%d, want %d/0", block.Len(), allow.Len(), tt.added)
+			}
+		})
+	}
+}
+
+func TestParseAdBlock(t *testing.T) {
+	tests := []struct {
+		line  string
+		block int
+		allow int
+	}{
+		{"! توضیح", 0, 0},
+		{"[Adblock Plus 2.0]", 0, 0},
+		{"||a.example^", 1, 0},
+		{"||a.example^$important", 1, 0},
+		{"||a.example^$third-party", 0, 0},
+		{"||a.example/path", 0, 0},
+		{"||*.a.example^", 0, 0},
+		{"@@||a.example^", 0, 1},
+		{"a.example##.banner", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			block, allow := newList(t), newList(t)
+			if err := parseAdBlock(tt.line, block, allow); err != nil {
+				t.Fatal(err)
+			}
+			if block.Len() != tt.block || allow.Len() != tt.allow {
+				t.Fatalf("got %d/%d, want %d/%d", block.Len(), allow.Len(), tt.block, tt.allow)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	f := loadTestFilter(t, "")
+	want := []ListStats{
+		{Name: "hosts", Entries: 5, Invalid: 3},
+		{Name: "ads", Entries: 2},
+		{Name: "list-3", Entries: 1},
+	}
+	got := f.Stats()
+	if len(got) != len(want) {
+		t.Fatalf("got %d lists, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("list %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	// یک ورودی تنظیمات و یک استثنای AdBlock
+	if n := f.AllowEntries(); n != 2 {
+		t.Fatalf("AllowEntries() = %d, want 2", n)
+	}
+
+	if _, err := Load(Config{Action: "drop"}, nil); err == nil {
+		t.Fatal("invalid action accepted")
+	}
+	if _, err := Load(Config{Lists: []ListConfig{{Format: "csv", Files: []string{"testdata/hosts"}}}}, nil); err == nil {
+		t.Fatal("unknown format accepted")
+	}
+	if _, err := Load(Config{Lists: []ListConfig{{Files: []string{"testdata/missing"}}}}, nil); err == nil {
+		t.Fatal("missing file accepted")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	f := loadTestFilter(t, "")
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"ads.example.", "hosts"},
+		// نام‌های hosts فقط خودشان را مسدود می‌کنند
+		{"sub.ads.example.", ""},
+		{"IPV6-ZONE.example.", "hosts"},
+		{"metrics.example.", "hosts"},
+		{"bad..name.example.", ""},
+		{"banner.example.", ""},
+		{"localhost.", ""},
+		// قواعد AdBlock زیردامنه‌ها را هم می‌گیرند
+		{"doubleclick.example.", "ads"},
+		{"x.doubleclick.example.", "ads"},
+		{"important.example.", "ads"},
+		{"third-party.example.", ""},
+		{"malware.example.", "list-3"},
+		// allow بر همه فهرست‌ها اولویت دارد
+		{"allowed.example.", ""},
+		{"tracker.example.", "hosts"},
+		{"ok.tracker.example.", ""},
+		{"good.example.", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.Check(tt.name); got != tt.want {
+				t.Fatalf("Check(%s) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+
+	if f.Overrides() != 1 {
+		t.Fatalf("Overrides() = %d, want 1", f.Overrides())
+	}
+	if hits := f.Stats()[0].Hits; hits != 4 {
+		t.Fatalf("hosts hits = %d, want 4", hits)
+	}
+	var disabled *Filter
+	if disabled.Check("ads.example.") != "" {
+		t.Fatal("nil filter blocked a name")
+	}
+}
+
+func TestLoadKeepsCounters(t *testing.T) {
+	f := loadTestFilter(t, "")
+	f.Check("ads.example.")
+	f.Check("allowed.example.")
+
+	next, err := Load(f.Config(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits := next.Stats()[0].Hits; hits != 1 {
+		t.Fatalf("hits after reload = %d, want 1", hits)
+	}
+	if next.Overrides() != 1 {
+		t.Fatalf("overrides after reload = %d, want 1", next.Overrides())
+	}
+}
+
+func TestBlock(t *testing.T) {
+	tests := []struct {
+		action  string
+		qtype   uint16
+		rcode   int
+		answers int
+	}{
+		{"", dns.TypeA, dns.RcodeNameError, 0},
+		{"nxdomain", dns.TypeAAAA, dns.RcodeNameError, 0},
+		{"refused", dns.TypeA, dns.RcodeRefused, 0},
+		{"null_ip", dns.TypeA, dns.RcodeSuccess, 1},
+		{"null_ip", dns.TypeAAAA, dns.RcodeSuccess, 1},
+		{"null_ip", dns.TypeMX, dns.RcodeSuccess, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action+"/"+dns.TypeToString[tt.qtype], func(t *testing.T) {
+			f := loadTestFilter(t, tt.action)
+			r := new(dns.Msg)
+			r.SetQuestion("ads.example.", tt.qtype)
+			m := f.Block(r)
+			if m.Id != r.Id || m.Rcode != tt.rcode || len(m.Answer) != tt.answers {
+				t.Fatalf("got %s", m)
+			}
+			for _, rr := range m.Answer {
+				switch rr := rr.(type) {
+				case *dns.A:
+					if !rr.A.IsUnspecified() {
+						t.Fatalf("got %s", rr)
+					}
+				case *dns.AAAA:
+					if !rr.AAAA.IsUnspecified() {
+						t.Fatalf("got %s", rr)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHolder(t *testing.T) {
+	h := NewHolder(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if h.Load() != nil {
+		t.Fatal("new holder not empty")
+	}
+	cfg := loadTestFilter(t, "").Config()
+	if err := h.Start(cfg); err != nil {
+		t.Fatal(err)
+	}
+	first := h.Load()
+	if first.Check("ads.example.") != "hosts" {
+		t.Fatal("holder filter does not block")
+	}
+
+	// خطای بارگذاری فهرست قبلی را نگه می‌دارد
+	bad := cfg
+	bad.Action = "drop"
+	if err := h.Reload(bad); err == nil {
+		t.Fatal("invalid config accepted")
+	}
+	if h.Load() != first {
+		t.Fatal("failed reload replaced the filter")
+	}
+
+	if err := h.Reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if h.Load() == first || h.Load().Stats()[0].Hits != 1 {
+		t.Fatal("reload did not keep counters")
+	}
+}
+
+func newList(t *testing.T) *domainlist.List {
+	t.Helper()
+	l, err := domainlist.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
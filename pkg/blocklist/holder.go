@@ -0,0 +1,87 @@
+package blocklist
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Holder فهرست‌های فعلی با جایگزینی اتمیک و بارگذاری دوره‌ای
+//
+// تا اولین Start یا Store مقدار Load برابر nil است (مسدودسازی غیرفعال).
+type Holder struct {
+	filter atomic.Pointer[Filter]
+	log    *slog.Logger
+	// mu ساخت و ذخیره را یکجا می‌کند تا بارگذاری دوره‌ای فهرست ساخته‌شده از
+	// تنظیمات قبلی را پس از Store تنظیمات جدید ذخیره نکند
+	mu sync.Mutex
+}
+
+// NewHolder ساخت نگهدارنده‌ای که بارگذاری‌ها را در log ثبت می‌کند
+func NewHolder(log *slog.Logger) *Holder {
+	return &Holder{log: log}
+}
+
+// Start بارگذاری فهرست‌ها و راه‌اندازی بارگذاری دوره‌ای با ReloadInterval
+func (h *Holder) Start(cfg Config) error {
+	if err := h.Reload(cfg); err != nil {
+		return err
+	}
+	if cfg.ReloadInterval > 0 {
+		go h.reloadLoop(cfg.ReloadInterval)
+	}
+	return nil
+}
+
+// Load فهرست‌های فعلی؛ nil یعنی غیرفعال
+func (h *Holder) Load() *Filter {
+	return h.filter.Load()
+}
+
+// Reload خواندن فهرست‌ها و جایگزینی اتمیک؛ در صورت خطا فهرست قبلی می‌ماند
+func (h *Holder) Reload(cfg Config) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.reload(cfg)
+}
+
+func (h *Holder) reload(cfg Config) error {
+	f, err := Load(cfg, h.Load())
+	if err != nil {
+		return err
+	}
+	h.store(f)
+	return nil
+}
+
+// Store جایگزینی فهرست‌های ساخته‌شده و ثبت تعداد ورودی‌ها
+func (h *Holder) Store(f *Filter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.store(f)
+}
+
+func (h *Holder) store(f *Filter) {
+	h.filter.Store(f)
+	for _, l := range f.Stats() {
+		h.log.Info("فهرست مسدودسازی بارگذاری شد", "list", l.Name, "entries", l.Entries, "invalid", l.Invalid)
+	}
+	if n := f.AllowEntries(); n > 0 {
+		h.log.Info("فهرست allow بارگذاری شد", "entries", n)
+	}
+}
+
+// reloadLoop خواندن دوره‌ای فایل‌های فهرست با آخرین تنظیمات
+func (h *Holder) reloadLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.mu.Lock()
+		err := h.reload(h.Load().Config())
+		h.mu.Unlock()
+		if err != nil {
+			h.log.Error("خطا در بارگذاری مجدد فهرست‌های مسدودسازی", "error", err)
+		}
+	}
+}
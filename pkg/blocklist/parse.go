@@ -0,0 +1,135 @@
+package blocklist
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/dns-forwarder/pkg/domainlist"
+	"github.com/miekg/dns"
+)
+
+// قالب‌های فایل فهرست
+const (
+	// FormatDomains هر خط یک ورودی domainlist (example.com، full:...، regexp:...)
+	FormatDomains = "domains"
+	// FormatHosts قالب /etc/hosts؛ هر نام فقط خودش را مسدود می‌کند
+	FormatHosts = "hosts"
+	// FormatAdBlock قواعد ||example.com^ و استثنای @@||example.com^
+	FormatAdBlock = "adblock"
+)
+
+// hostsIgnored نام‌های معمول ابتدای فایل‌های hosts که نباید مسدود شوند
+var hostsIgnored = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+	"0.0.0.0":               true,
+}
+
+// loadFile خواندن یک فایل فهرست؛ استثناهای AdBlock به allow افزوده می‌شوند
+//
+// فهرست‌های عمومی hosts و AdBlock همیشه چند خط خراب دارند؛ این خط‌ها
+// نادیده گرفته و در invalid شمرده می‌شوند تا کل فهرست از دست نرود.
+func loadFile(path, format string, block, allow *domainlist.List) (invalid int, err error) {
+	var parse func(line string, block, allow *domainlist.List) error
+	switch format {
+	case "", FormatDomains:
+		return 0, block.LoadFile(path)
+	case FormatHosts:
+		parse = parseHosts
+	case FormatAdBlock:
+		parse = parseAdBlock
+	default:
+		return 0, fmt.Errorf("unknown format %q", format)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if parse(scanner.Text(), block, allow) != nil {
+			invalid++
+		}
+	}
+	return invalid, scanner.Err()
+}
+
+// parseHosts خواندن یک خط hosts: IP و سپس یک یا چند نام
+//
+// نام‌های نامعتبر خط افزوده نمی‌شوند ولی نام‌های درست همان خط می‌مانند.
+func parseHosts(line string, block, allow *domainlist.List) error {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	if len(fields) < 2 || net.ParseIP(strings.SplitN(fields[0], "%", 2)[0]) == nil {
+		return fmt.Errorf("invalid hosts line %q", line)
+	}
+	var firstErr error
+	for _, name := range fields[1:] {
+		if hostsIgnored[strings.ToLower(name)] {
+			continue
+		}
+		if _, ok := dns.IsDomainName(name); !ok {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("invalid name %q", name)
+			}
+			continue
+		}
+		if err := block.Add("full:" + name); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// parseAdBlock خواندن یک قاعده AdBlock
+//
+// فقط قواعد سطح دامنه (||name^) پشتیبانی می‌شوند؛ قواعد مخصوص مرورگر
+// (مسیر، wildcard، cosmetic و گزینه‌های $ به جز important) نادیده گرفته می‌شوند.
+func parseAdBlock(line string, block, allow *domainlist.List) error {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '!' || line[0] == '[' || line[0] == '#' {
+		return nil
+	}
+
+	target := block
+	if strings.HasPrefix(line, "@@") {
+		target = allow
+		line = line[2:]
+	}
+	if !strings.HasPrefix(line, "||") {
+		return nil
+	}
+	line = line[2:]
+
+	if i := strings.IndexByte(line, '$'); i >= 0 {
+		if line[i+1:] != "important" {
+			return nil
+		}
+		line = line[:i]
+	}
+	line = strings.TrimSuffix(line, "^")
+	if line == "" || strings.ContainsAny(line, "/*^|:") {
+		return nil
+	}
+	return target.Add("domain:" + line)
+}
@@ -0,0 +1,316 @@
+// Package dnstap خروجی dnstap (frame streams + protobuf) برای ثبت دقیق پیام‌های DNS
+//
+// خروجی با ابزارهای معمول dnstap (مثلاً dnstap -r یا dnstap -u) خوانده می‌شود.
+package dnstap
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	dt "github.com/dnstap/golang-dnstap"
+	framestream "github.com/farsightsec/golang-framestream"
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/proto"
+)
+
+// queueSize ظرفیت صف فریم‌ها؛ با پر شدن صف فریم‌ها دور ریخته می‌شوند
+const queueSize = 4096
+
+// MessageType نوع پیام dnstap
+type MessageType = dt.Message_Type
+
+// انواع پیام‌های ثبت‌شده
+const (
+	ClientQuery       = dt.Message_CLIENT_QUERY
+	ClientResponse    = dt.Message_CLIENT_RESPONSE
+	ForwarderQuery    = dt.Message_FORWARDER_QUERY
+	ForwarderResponse = dt.Message_FORWARDER_RESPONSE
+)
+
+// Message یک پیام DNS برای ثبت
+//
+// QueryAddr فرستنده درخواست و ResponseAddr پاسخ‌دهنده است؛ هر کدام می‌تواند nil باشد.
+type Message struct {
+	Type         MessageType
+	QueryAddr    net.Addr
+	ResponseAddr net.Addr
+	QueryTime    time.Time
+	ResponseTime time.Time
+	Query        *dns.Msg
+	Response     *dns.Msg
+}
+
+// Config تنظیمات خروجی dnstap
+type Config struct {
+	Enabled bool   `yaml:"enabled"`
+	Output  string `yaml:"output"`
+	// Identity نام این نمونه در پیام‌ها؛ خالی یعنی hostname
+	Identity string `yaml:"identity"`
+}
+
+// Open ساخت خروجی از تنظیمات؛ برای تنظیمات غیرفعال nil برمی‌گرداند
+func Open(cfg Config) (*Tap, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	identity := cfg.Identity
+	if identity == "" {
+		identity, _ = os.Hostname()
+	}
+	return New(cfg.Output, identity)
+}
+
+// frameWriter نویسنده فریم‌های dnstap (فایل یا سوکت)
+type frameWriter interface {
+	WriteFrame([]byte) (int, error)
+	Close() error
+}
+
+// Tap خروجی dnstap
+//
+// مقدار nil یعنی dnstap غیرفعال است و Log کاری انجام نمی‌دهد.
+type Tap struct {
+	identity []byte
+	frames   chan []byte
+	w        frameWriter
+	flush    func() error
+	done     chan struct{}
+	dropped  uint64
+
+	// mu جلوگیری از ارسال روی صف بسته‌شده پس از Close
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New ساخت خروجی dnstap
+//
+// output مسیر فایل است (در صورت وجود بازنویسی می‌شود) یا unix:/path برای
+// سوکت یک collector؛ اتصال سوکت در صورت قطع دوباره برقرار می‌شود.
+func New(output, identity string) (*Tap, error) {
+	t := &Tap{
+		identity: []byte(identity),
+		frames:   make(chan []byte, queueSize),
+		done:     make(chan struct{}),
+	}
+
+	switch {
+	case output == "":
+		return nil, errors.New("dnstap output is empty")
+
+	case strings.HasPrefix(output, "unix:"):
+		addr := &net.UnixAddr{Name: strings.TrimPrefix(output, "unix:"), Net: "unix"}
+		t.w = dt.NewSocketWriter(addr, &dt.SocketWriterOptions{
+			FlushTimeout:  time.Second,
+			RetryInterval: 5 * time.Second,
+			Dialer:        &net.Dialer{Timeout: 5 * time.Second},
+		})
+
+	default:
+		f, err := os.Create(output)
+		if err != nil {
+			return nil, err
+		}
+		w, err := framestream.NewWriter(f, &framestream.WriterOptions{
+			ContentTypes: [][]byte{dt.FSContentType},
+		})
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		t.w = fileWriter{Writer: w, f: f}
+		t.flush = w.Flush
+	}
+
+	go t.run()
+	return t, nil
+}
+
+// fileWriter بستن فایل پس از پایان جریان
+type fileWriter struct {
+	*framestream.Writer
+	f *os.File
+}
+
+func (w fileWriter) Close() error {
+	err := w.Writer.Close()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Log ثبت یک پیام؛ اگر صف پر باشد پیام دور ریخته می‌شود
+func (t *Tap) Log(m Message) {
+	if t == nil {
+		return
+	}
+
+	frame, err := t.encode(m)
+	if err != nil {
+		atomic.AddUint64(&t.dropped, 1)
+		return
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		atomic.AddUint64(&t.dropped, 1)
+		return
+	}
+	select {
+	case t.frames <- frame:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+// LogClient ثبت درخواست یا پاسخ یک شنونده محلی؛ response برای درخواست nil است
+func (t *Tap) LogClient(typ MessageType, w dns.ResponseWriter, qtime time.Time, query, response *dns.Msg) {
+	if t == nil {
+		return
+	}
+	m := Message{
+		Type:         typ,
+		QueryAddr:    w.RemoteAddr(),
+		ResponseAddr: w.LocalAddr(),
+		QueryTime:    qtime,
+		Query:        query,
+		Response:     response,
+	}
+	if response != nil {
+		m.ResponseTime = time.Now()
+	}
+	t.Log(m)
+}
+
+// LogForwarder ثبت درخواست یا پاسخ ارسال‌شده به upstream با آدرس host:port
+func (t *Tap) LogForwarder(typ MessageType, upstream string, qtime time.Time, query, response *dns.Msg) {
+	if t == nil {
+		return
+	}
+	m := Message{
+		Type:      typ,
+		QueryTime: qtime,
+		Query:     query,
+		Response:  response,
+	}
+	if addr, err := net.ResolveUDPAddr("udp", upstream); err == nil {
+		m.ResponseAddr = addr
+	}
+	if response != nil {
+		m.ResponseTime = time.Now()
+	}
+	t.Log(m)
+}
+
+// Dropped تعداد پیام‌های دور ریخته‌شده
+func (t *Tap) Dropped() uint64 {
+	if t == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// Close نوشتن پیام‌های باقی‌مانده و بستن خروجی؛ پیام‌های بعدی دور ریخته می‌شوند
+func (t *Tap) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.frames)
+	t.mu.Unlock()
+
+	<-t.done
+	return t.w.Close()
+}
+
+// run نوشتن فریم‌ها؛ خروجی فایل هر بار که صف خالی شود flush می‌شود
+func (t *Tap) run() {
+	defer close(t.done)
+	for frame := range t.frames {
+		if _, err := t.w.WriteFrame(frame); err != nil {
+			atomic.AddUint64(&t.dropped, 1)
+			continue
+		}
+		if t.flush != nil && len(t.frames) == 0 {
+			t.flush()
+		}
+	}
+}
+
+// encode ساخت فریم protobuf یک پیام
+func (t *Tap) encode(m Message) ([]byte, error) {
+	msg := &dt.Message{Type: &m.Type}
+
+	if family, protocol, ip, port, ok := splitAddr(m.QueryAddr); ok {
+		msg.SocketFamily, msg.SocketProtocol = &family, &protocol
+		msg.QueryAddress, msg.QueryPort = ip, &port
+	}
+	if family, protocol, ip, port, ok := splitAddr(m.ResponseAddr); ok {
+		msg.SocketFamily, msg.SocketProtocol = &family, &protocol
+		msg.ResponseAddress, msg.ResponsePort = ip, &port
+	}
+
+	if !m.QueryTime.IsZero() {
+		sec, nsec := uint64(m.QueryTime.Unix()), uint32(m.QueryTime.Nanosecond())
+		msg.QueryTimeSec, msg.QueryTimeNsec = &sec, &nsec
+	}
+	if !m.ResponseTime.IsZero() {
+		sec, nsec := uint64(m.ResponseTime.Unix()), uint32(m.ResponseTime.Nanosecond())
+		msg.ResponseTimeSec, msg.ResponseTimeNsec = &sec, &nsec
+	}
+
+	if m.Query != nil {
+		data, err := m.Query.Pack()
+		if err != nil {
+			return nil, err
+		}
+		msg.QueryMessage = data
+	}
+	if m.Response != nil {
+		data, err := m.Response.Pack()
+		if err != nil {
+			return nil, err
+		}
+		msg.ResponseMessage = data
+	}
+
+	typ := dt.Dnstap_MESSAGE
+	return proto.Marshal(&dt.Dnstap{
+		Identity: t.identity,
+		Type:     &typ,
+		Message:  msg,
+	})
+}
+
+// splitAddr جدا کردن خانواده، پروتکل، IP و پورت یک آدرس
+func splitAddr(addr net.Addr) (dt.SocketFamily, dt.SocketProtocol, []byte, uint32, bool) {
+	var ip net.IP
+	var port int
+	protocol := dt.SocketProtocol_UDP
+
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip, port = a.IP, a.Port
+	case *net.TCPAddr:
+		ip, port = a.IP, a.Port
+		protocol = dt.SocketProtocol_TCP
+	default:
+		return 0, 0, nil, 0, false
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return dt.SocketFamily_INET, protocol, ip4, uint32(port), true
+	}
+	return dt.SocketFamily_INET6, protocol, ip.To16(), uint32(port), true
+}
@@ -0,0 +1,105 @@
+package doh
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// ContentType نوع محتوای پیام DNS طبق RFC 8484
+	ContentType = "application/dns-message"
+	// MaxMessageSize حداکثر اندازه پیام DNS
+	MaxMessageSize = 65535
+)
+
+// ReadRequest خواندن پیام DNS از درخواست HTTP (GET با ?dns= یا POST)
+//
+// در صورت خطا، کد وضعیت HTTP مناسب هم برگردانده می‌شود.
+func ReadRequest(r *http.Request) (*dns.Msg, int, error) {
+	var data []byte
+
+	switch r.Method {
+	case http.MethodGet:
+		param := r.URL.Query().Get("dns")
+		if param == "" {
+			return nil, http.StatusBadRequest, errors.New("missing dns parameter")
+		}
+		decoded, err := base64.RawURLEncoding.DecodeString(param)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		data = decoded
+
+	case http.MethodPost:
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != ContentType {
+			return nil, http.StatusUnsupportedMediaType, errors.New("unsupported content type")
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, MaxMessageSize+1))
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		if len(body) > MaxMessageSize {
+			return nil, http.StatusRequestEntityTooLarge, errors.New("message too large")
+		}
+		data = body
+
+	default:
+		return nil, http.StatusMethodNotAllowed, errors.New("method not allowed")
+	}
+
+	msg := new(dns.Msg)
+	if err := msg.Unpack(data); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if len(msg.Question) == 0 {
+		return nil, http.StatusBadRequest, errors.New("no question")
+	}
+
+	return msg, http.StatusOK, nil
+}
+
+// WriteResponse نوشتن پاسخ DNS با هدرهای مناسب RFC 8484
+func WriteResponse(w http.ResponseWriter, msg *dns.Msg) error {
+	data, err := msg.Pack()
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return err
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if ttl, ok := minTTL(msg); ok {
+		w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(ttl), 10))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	_, err = w.Write(data)
+	return err
+}
+
+// minTTL کمترین TTL رکوردهای پاسخ
+func minTTL(msg *dns.Msg) (uint32, bool) {
+	if msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError {
+		return 0, false
+	}
+
+	found := false
+	var ttl uint32
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns} {
+		for _, rr := range section {
+			if !found || rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+				found = true
+			}
+		}
+	}
+
+	return ttl, found
+}
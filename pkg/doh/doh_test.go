@@ -0,0 +1,135 @@
+package doh
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func packQuery(t *testing.T, name string) []byte {
+	t.Helper()
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, dns.TypeA)
+	msg.Id = 0
+	data, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestReadRequest(t *testing.T) {
+	query := packQuery(t, "example.com.")
+	noQuestion, _ := new(dns.Msg).Pack()
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        []byte
+		status      int
+	}{
+		{"get", http.MethodGet, "/dns-query?dns=" + base64.RawURLEncoding.EncodeToString(query), "", nil, http.StatusOK},
+		{"get padded base64", http.MethodGet, "/dns-query?dns=" + base64.URLEncoding.EncodeToString(query), "", nil, http.StatusBadRequest},
+		{"get missing param", http.MethodGet, "/dns-query", "", nil, http.StatusBadRequest},
+		{"get garbage", http.MethodGet, "/dns-query?dns=AAAA", "", nil, http.StatusBadRequest},
+		{"get no question", http.MethodGet, "/dns-query?dns=" + base64.RawURLEncoding.EncodeToString(noQuestion), "", nil, http.StatusBadRequest},
+		{"post", http.MethodPost, "/dns-query", ContentType, query, http.StatusOK},
+		{"post with params", http.MethodPost, "/dns-query", ContentType + "; charset=binary", query, http.StatusOK},
+		{"post wrong type", http.MethodPost, "/dns-query", "application/json", query, http.StatusUnsupportedMediaType},
+		{"post no type", http.MethodPost, "/dns-query", "", query, http.StatusUnsupportedMediaType},
+		{"post too large", http.MethodPost, "/dns-query", ContentType, make([]byte, MaxMessageSize+1), http.StatusRequestEntityTooLarge},
+		{"post truncated", http.MethodPost, "/dns-query", ContentType, query[:5], http.StatusBadRequest},
+		{"put", http.MethodPut, "/dns-query", ContentType, query, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, bytes.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+
+			msg, status, err := ReadRequest(r)
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d (err %v)", status, tt.status, err)
+			}
+			if tt.status != http.StatusOK {
+				if err == nil || msg != nil {
+					t.Fatalf("expected error, got msg %v", msg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msg.Question) != 1 || msg.Question[0].Name != "example.com." || msg.Question[0].Qtype != dns.TypeA {
+				t.Fatalf("unexpected question %v", msg.Question)
+			}
+		})
+	}
+}
+
+func TestWriteResponse(t *testing.T) {
+	rr := func(s string) dns.RR {
+		r, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		rcode  int
+		answer []dns.RR
+		ns     []dns.RR
+		cache  string
+	}{
+		{"min answer ttl", dns.RcodeSuccess, []dns.RR{rr("example.com. 300 IN A 192.0.2.1"), rr("example.com. 60 IN A 192.0.2.2")}, nil, "max-age=60"},
+		{"nxdomain soa", dns.RcodeNameError, nil, []dns.RR{rr("com. 900 IN SOA a.gtld. nstld. 1 1800 900 604800 86400")}, "max-age=900"},
+		{"no records", dns.RcodeSuccess, nil, nil, ""},
+		{"servfail", dns.RcodeServerFailure, []dns.RR{rr("example.com. 300 IN A 192.0.2.1")}, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := new(dns.Msg)
+			msg.SetQuestion("example.com.", dns.TypeA)
+			msg.Response = true
+			msg.Rcode = tt.rcode
+			msg.Answer = tt.answer
+			msg.Ns = tt.ns
+
+			w := httptest.NewRecorder()
+			if err := WriteResponse(w, msg); err != nil {
+				t.Fatal(err)
+			}
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != ContentType {
+				t.Fatalf("Content-Type = %q", ct)
+			}
+			if cc := w.Header().Get("Cache-Control"); cc != tt.cache {
+				t.Fatalf("Cache-Control = %q, want %q", cc, tt.cache)
+			}
+			if cl := w.Header().Get("Content-Length"); cl != strconv.Itoa(w.Body.Len()) {
+				t.Fatalf("Content-Length = %q, body %d", cl, w.Body.Len())
+			}
+
+			got := new(dns.Msg)
+			if err := got.Unpack(w.Body.Bytes()); err != nil {
+				t.Fatal(err)
+			}
+			if got.Rcode != tt.rcode || len(got.Answer) != len(tt.answer) {
+				t.Fatalf("unexpected response %v", got)
+			}
+		})
+	}
+}
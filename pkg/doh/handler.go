@@ -0,0 +1,85 @@
+package doh
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/miekg/dns"
+)
+
+// Handler تبدیل یک dns.Handler به http.Handler برای سرویس DoH
+type Handler struct {
+	DNS dns.Handler
+}
+
+// ServeHTTP خواندن درخواست DoH، اجرای handler و نوشتن پاسخ
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, status, err := ReadRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	rw := &responseWriter{remote: r.RemoteAddr, local: localAddr(r)}
+	h.DNS.ServeDNS(rw, req)
+
+	if rw.msg == nil {
+		http.Error(w, "no response", http.StatusBadGateway)
+		return
+	}
+
+	WriteResponse(w, rw.msg)
+}
+
+// responseWriter پیاده‌سازی dns.ResponseWriter که پاسخ را نگه می‌دارد
+type responseWriter struct {
+	remote string
+	local  net.Addr
+	msg    *dns.Msg
+}
+
+func (rw *responseWriter) LocalAddr() net.Addr {
+	return rw.local
+}
+
+func (rw *responseWriter) RemoteAddr() net.Addr {
+	addr, err := net.ResolveTCPAddr("tcp", rw.remote)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+	return addr
+}
+
+func (rw *responseWriter) WriteMsg(msg *dns.Msg) error {
+	rw.msg = msg
+	return nil
+}
+
+func (rw *responseWriter) Write(data []byte) (int, error) {
+	msg := new(dns.Msg)
+	if err := msg.Unpack(data); err != nil {
+		return 0, err
+	}
+	rw.msg = msg
+	return len(data), nil
+}
+
+func (rw *responseWriter) Close() error {
+	return nil
+}
+
+func (rw *responseWriter) TsigStatus() error {
+	return errors.New("tsig not supported")
+}
+
+func (rw *responseWriter) TsigTimersOnly(bool) {}
+
+func (rw *responseWriter) Hijack() {}
+
+func localAddr(r *http.Request) net.Addr {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		return addr
+	}
+	return &net.TCPAddr{}
+}
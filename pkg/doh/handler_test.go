@@ -0,0 +1,57 @@
+package doh
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestHandler(t *testing.T) {
+	answer := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		rr, _ := dns.NewRR(req.Question[0].Name + " 120 IN A 192.0.2.1")
+		resp.Answer = append(resp.Answer, rr)
+		w.WriteMsg(resp)
+	})
+	silent := dns.HandlerFunc(func(dns.ResponseWriter, *dns.Msg) {})
+
+	query := packQuery(t, "example.com.")
+
+	tests := []struct {
+		name   string
+		h      dns.Handler
+		body   []byte
+		status int
+	}{
+		{"answer", answer, query, http.StatusOK},
+		{"no response", silent, query, http.StatusBadGateway},
+		{"bad request", answer, []byte{1, 2, 3}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/dns-query", bytes.NewReader(tt.body))
+			r.Header.Set("Content-Type", ContentType)
+			w := httptest.NewRecorder()
+
+			(&Handler{DNS: tt.h}).ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			resp := new(dns.Msg)
+			if err := resp.Unpack(w.Body.Bytes()); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Answer) != 1 || w.Header().Get("Cache-Control") != "max-age=120" {
+				t.Fatalf("unexpected response %v", resp)
+			}
+		})
+	}
+}
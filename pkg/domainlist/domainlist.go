@@ -0,0 +1,162 @@
+package domainlist
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// List فهرست دامنه‌ها با تطبیق کامل، پسوندی و regex
+//
+// قالب هر ورودی:
+//
+//	example.com          دامنه و همه زیردامنه‌ها
+//	domain:example.com   مشابه بالا
+//	full:example.com     فقط خود دامنه
+//	regexp:^ads[0-9]+\.  عبارت منظم روی نام (بدون نقطه انتهایی)
+type List struct {
+	full     map[string]struct{}
+	suffixes map[string]struct{}
+	regexps  []*regexp.Regexp
+	hits     uint64
+}
+
+// New ایجاد فهرست جدید از روی ورودی‌ها
+func New(entries ...string) (*List, error) {
+	l := &List{
+		full:     make(map[string]struct{}),
+		suffixes: make(map[string]struct{}),
+	}
+	for _, entry := range entries {
+		if err := l.Add(entry); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Add افزودن یک ورودی به فهرست
+func (l *List) Add(entry string) error {
+	entry = strings.TrimSpace(entry)
+	if entry == "" {
+		return nil
+	}
+
+	kind, value := "domain", entry
+	if i := strings.IndexByte(entry, ':'); i > 0 {
+		kind, value = entry[:i], entry[i+1:]
+	}
+
+	switch kind {
+	case "domain":
+		if name := normalize(value); name != "" {
+			l.suffixes[name] = struct{}{}
+		}
+	case "full":
+		if name := normalize(value); name != "" {
+			l.full[name] = struct{}{}
+		}
+	case "regexp":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return fmt.Errorf("invalid regexp %q: %w", value, err)
+		}
+		l.regexps = append(l.regexps, re)
+	default:
+		return fmt.Errorf("unknown entry type %q", kind)
+	}
+
+	return nil
+}
+
+// LoadFile خواندن ورودی‌ها از فایل (هر خط یک ورودی، # برای توضیح)
+func (l *List) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if err := l.Add(line); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Match بررسی تطبیق نام با فهرست
+func (l *List) Match(name string) bool {
+	if l == nil {
+		return false
+	}
+
+	name = normalize(name)
+	if l.match(name) {
+		atomic.AddUint64(&l.hits, 1)
+		return true
+	}
+	return false
+}
+
+func (l *List) match(name string) bool {
+	if _, ok := l.full[name]; ok {
+		return true
+	}
+
+	if len(l.suffixes) > 0 {
+		for suffix := name; suffix != ""; {
+			if _, ok := l.suffixes[suffix]; ok {
+				return true
+			}
+			i := strings.IndexByte(suffix, '.')
+			if i < 0 {
+				break
+			}
+			suffix = suffix[i+1:]
+		}
+	}
+
+	for _, re := range l.regexps {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Len تعداد ورودی‌های فهرست
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.full) + len(l.suffixes) + len(l.regexps)
+}
+
+// Hits تعداد تطبیق‌های موفق
+func (l *List) Hits() uint64 {
+	if l == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&l.hits)
+}
+
+// normalize حروف کوچک و حذف نقطه انتهایی
+func normalize(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.TrimPrefix(name, "*.")
+	name = strings.TrimPrefix(name, ".")
+	return strings.TrimSuffix(name, ".")
+}
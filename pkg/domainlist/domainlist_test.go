@@ -0,0 +1,125 @@
+package domainlist
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	l, err := New(
+		"example.com",
+		"domain:Corp.Example.",
+		"full:exact.example.org",
+		"*.wild.example.net",
+		`regexp:^ads[0-9]+\.`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		// دامنه و همه زیردامنه‌ها
+		{"example.com", true},
+		{"www.example.com.", true},
+		{"a.b.EXAMPLE.com", true},
+		{"notexample.com", false},
+		{"example.com.evil", false},
+		{"x.corp.example", true},
+		// full فقط خود نام
+		{"exact.example.org.", true},
+		{"www.exact.example.org", false},
+		{"example.org", false},
+		// *. معادل تطبیق پسوندی است
+		{"wild.example.net", true},
+		{"a.wild.example.net", true},
+		// regexp روی نام بدون نقطه انتهایی
+		{"ads42.tracker.io.", true},
+		{"www.ads42.tracker.io", false},
+		{"ads.tracker.io", false},
+		{"", false},
+		{".", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := l.Match(tt.name); got != tt.want {
+				t.Fatalf("Match(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+
+	if l.Len() != 5 {
+		t.Fatalf("Len() = %d, want 5", l.Len())
+	}
+	if l.Hits() != 8 {
+		t.Fatalf("Hits() = %d, want 8", l.Hits())
+	}
+
+	var empty *List
+	if empty.Match("example.com") || empty.Len() != 0 || empty.Hits() != 0 {
+		t.Fatal("nil list matched")
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		entry   string
+		len     int
+		wantErr bool
+	}{
+		{"example.com", 1, false},
+		{"  full:example.com  ", 1, false},
+		{"", 0, false},
+		{"domain:.", 0, false},
+		{"regexp:[", 0, true},
+		{"keyword:ads", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			l, _ := New()
+			err := l.Add(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Add(%q) error = %v, wantErr %v", tt.entry, err, tt.wantErr)
+			}
+			if l.Len() != tt.len {
+				t.Fatalf("Len() = %d, want %d", l.Len(), tt.len)
+			}
+		})
+	}
+
+	if _, err := New("example.com", "regexp:("); err == nil {
+		t.Fatal("New accepted an invalid regexp")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "list.txt")
+	content := "# فهرست آزمایشی\nexample.com\n\nfull:exact.example.org  # توضیح\nregexp:^cdn[0-9]+\\.\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, _ := New()
+	if err := l.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if l.Len() != 3 || !l.Match("www.example.com") || !l.Match("exact.example.org") || !l.Match("cdn7.example.net") {
+		t.Fatalf("unexpected list of %d entries", l.Len())
+	}
+
+	bad := filepath.Join(dir, "bad.txt")
+	if err := os.WriteFile(bad, []byte("example.com\nregexp:(\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.LoadFile(bad); err == nil || !strings.HasPrefix(err.Error(), bad+":2:") {
+		t.Fatalf("LoadFile error = %v, want line 2", err)
+	}
+	if err := l.LoadFile(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Fatal("missing file accepted")
+	}
+}
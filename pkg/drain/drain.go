@@ -0,0 +1,65 @@
+// Package drain شمارش کارهای در حال انجام برای خاموش شدن آرام
+//
+// هر کار با Enter شروع و با Leave تمام می‌شود. پس از Close کار جدیدی پذیرفته
+// نمی‌شود و Wait تا پایان کارهای باقی‌مانده یا پایان مهلت صبر می‌کند.
+package drain
+
+import (
+	"context"
+	"sync"
+)
+
+// Group مجموعه کارهای در حال انجام؛ مقدار صفر آماده استفاده است
+type Group struct {
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Enter ثبت شروع یک کار؛ پس از Close مقدار false برمی‌گرداند
+func (g *Group) Enter() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.closed {
+		return false
+	}
+	g.wg.Add(1)
+	return true
+}
+
+// Leave ثبت پایان کاری که Enter آن موفق بوده است
+func (g *Group) Leave() {
+	g.wg.Done()
+}
+
+// Close توقف پذیرش کار جدید
+func (g *Group) Close() {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+}
+
+// Closed اینکه Close صدا زده شده است یا نه
+func (g *Group) Closed() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.closed
+}
+
+// Wait بستن گروه و انتظار برای پایان کارهای باقی‌مانده تا پایان ctx
+func (g *Group) Wait(ctx context.Context) error {
+	g.Close()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,102 @@
+package drain
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGroupWait(t *testing.T) {
+	var g Group
+	if !g.Enter() || !g.Enter() {
+		t.Fatal("Enter refused before Close")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- g.Wait(context.Background()) }()
+
+	// Wait گروه را می‌بندد ولی تا پایان کارهای قبلی منتظر می‌ماند
+	deadline := time.Now().Add(time.Second)
+	for !g.Closed() {
+		if time.Now().After(deadline) {
+			t.Fatal("Wait did not close the group")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if g.Enter() {
+		t.Fatal("Enter accepted after Close")
+	}
+
+	g.Leave()
+	select {
+	case err := <-done:
+		t.Fatalf("Wait returned with work in flight: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	g.Leave()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the last Leave")
+	}
+}
+
+func TestGroupWaitTimeout(t *testing.T) {
+	var g Group
+	g.Enter()
+	defer g.Leave()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := g.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestGroupEmpty(t *testing.T) {
+	var g Group
+	if g.Closed() {
+		t.Fatal("zero group closed")
+	}
+	if err := g.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGroupConcurrent(t *testing.T) {
+	var g Group
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	entered := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !g.Enter() {
+				return
+			}
+			mu.Lock()
+			entered++
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			g.Leave()
+		}()
+	}
+
+	if err := g.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// هر کاری که پذیرفته شده پیش از بازگشت Wait تمام شده است
+	mu.Lock()
+	n := entered
+	mu.Unlock()
+	wg.Wait()
+	if n != entered {
+		t.Fatalf("%d tasks entered after Wait returned", entered-n)
+	}
+}
@@ -0,0 +1,181 @@
+package ipset
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Set مجموعه بازه‌های IP برای جستجوی سریع
+//
+// قالب فایل: هر خط یک CIDR یا یک IP (IPv4 یا IPv6)، # برای توضیح
+//
+//	2.144.0.0/14
+//	5.22.0.0/17   # توضیح
+//	2a01:5ec0::/29
+type Set struct {
+	ranges []ipRange
+	sorted bool
+}
+
+type ipRange struct {
+	first netip.Addr
+	last  netip.Addr
+}
+
+// New ایجاد مجموعه جدید از روی ورودی‌ها
+func New(entries ...string) (*Set, error) {
+	s := &Set{}
+	for _, entry := range entries {
+		if err := s.Add(entry); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Add افزودن یک CIDR یا IP
+func (s *Set) Add(entry string) error {
+	entry = strings.TrimSpace(entry)
+	if entry == "" {
+		return nil
+	}
+
+	var prefix netip.Prefix
+	if strings.Contains(entry, "/") {
+		p, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return fmt.Errorf("invalid cidr %q: %w", entry, err)
+		}
+		prefix = p.Masked()
+	} else {
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return fmt.Errorf("invalid ip %q: %w", entry, err)
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	first := prefix.Addr().Unmap()
+	s.ranges = append(s.ranges, ipRange{first: first, last: lastAddr(prefix)})
+	s.sorted = false
+
+	return nil
+}
+
+// LoadFile خواندن بازه‌ها از فایل
+func (s *Set) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if err := s.Add(line); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	s.Compact()
+	return nil
+}
+
+// Compact مرتب‌سازی و ادغام بازه‌های هم‌پوشان
+//
+// باید پس از آخرین Add و قبل از استفاده همزمان از Contains فراخوانی شود.
+func (s *Set) Compact() {
+	sort.Slice(s.ranges, func(i, j int) bool {
+		return s.ranges[i].first.Less(s.ranges[j].first)
+	})
+
+	merged := s.ranges[:0]
+	for _, r := range s.ranges {
+		if n := len(merged); n > 0 {
+			prev := &merged[n-1]
+			next := prev.last.Next()
+			if prev.first.Is4() == r.first.Is4() && (!next.IsValid() || !next.Less(r.first)) {
+				if prev.last.Less(r.last) {
+					prev.last = r.last
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+
+	s.ranges = merged
+	s.sorted = true
+}
+
+// Contains بررسی عضویت IP در مجموعه
+func (s *Set) Contains(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	return s.ContainsAddr(addr)
+}
+
+// ContainsAddr بررسی عضویت آدرس در مجموعه
+func (s *Set) ContainsAddr(addr netip.Addr) bool {
+	if s == nil || len(s.ranges) == 0 {
+		return false
+	}
+	if !s.sorted {
+		s.Compact()
+	}
+
+	addr = addr.Unmap()
+	i := sort.Search(len(s.ranges), func(i int) bool {
+		return addr.Less(s.ranges[i].first)
+	})
+	if i == 0 {
+		return false
+	}
+
+	r := s.ranges[i-1]
+	return r.first.Is4() == addr.Is4() && !r.last.Less(addr)
+}
+
+// Len تعداد بازه‌ها پس از ادغام
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.ranges)
+}
+
+// lastAddr آخرین آدرس یک prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Addr().Unmap()
+	bits := prefix.Bits()
+	if prefix.Addr().Is4In6() {
+		bits -= 96
+		if bits < 0 {
+			bits = 0
+		}
+	}
+
+	b := addr.AsSlice()
+	for i := bits; i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - uint(i%8))
+	}
+
+	last, _ := netip.AddrFromSlice(b)
+	return last
+}
@@ -0,0 +1,156 @@
+package ipset
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		entry   string
+		wantErr bool
+	}{
+		{"2.144.0.0/14", false},
+		{"5.22.0.1", false},
+		{"2a01:5ec0::/29", false},
+		{"  10.0.0.0/8  ", false},
+		{"", false},
+		{"10.0.0.0/33", true},
+		{"10.0.0/8", true},
+		{"2a01::/129", true},
+		{"300.1.1.1", true},
+		{"example.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			err := (&Set{}).Add(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Add(%q) error = %v, wantErr %v", tt.entry, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	s, err := New(
+		"10.0.0.5/8", // بیت‌های میزبان نادیده گرفته می‌شوند
+		"192.0.2.7",
+		"198.51.100.0/24",
+		"198.51.100.128/25", // داخل بازه قبلی
+		"203.0.113.0/25",
+		"203.0.113.128/25", // مجاور بازه قبلی
+		"2001:db8::/32",
+		"::ffff:100.64.0.0/106", // IPv4 به شکل IPv6
+		"255.255.255.255/32",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.0.0.0", true},
+		{"10.255.255.255", true},
+		{"11.0.0.0", false},
+		{"9.255.255.255", false},
+		{"192.0.2.7", true},
+		{"192.0.2.8", false},
+		{"198.51.100.200", true},
+		{"203.0.113.0", true},
+		{"203.0.113.255", true},
+		{"203.0.114.0", false},
+		{"100.64.0.1", true},
+		{"100.127.255.255", true},
+		{"100.128.0.0", false},
+		{"255.255.255.255", true},
+		{"2001:db8:ffff::1", true},
+		{"2001:db9::1", false},
+		// IPv4 داخل IPv6 مانند IPv4 بررسی می‌شود
+		{"::ffff:10.1.2.3", true},
+		{"::ffff:11.1.2.3", false},
+		// آدرس IPv6 با بیت‌های برابر بازه IPv4 عضو نیست
+		{"::a00:1", false},
+		{"::", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := s.ContainsAddr(netip.MustParseAddr(tt.ip)); got != tt.want {
+				t.Fatalf("ContainsAddr(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+			// net.ParseIP برای IPv4 هم شکل ۱۶ بایتی برمی‌گرداند
+			if got := s.Contains(net.ParseIP(tt.ip)); got != tt.want {
+				t.Fatalf("Contains(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+
+	if s.Contains(nil) {
+		t.Fatal("Contains(nil) = true")
+	}
+	var empty *Set
+	if empty.Contains(net.ParseIP("10.0.0.1")) {
+		t.Fatal("nil set contains address")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		want    int
+	}{
+		{"overlapping", []string{"10.0.0.0/8", "10.1.0.0/16", "10.2.3.4"}, 1},
+		{"adjacent", []string{"10.0.0.0/9", "10.128.0.0/9"}, 1},
+		{"disjoint", []string{"10.0.0.0/16", "10.2.0.0/16"}, 2},
+		{"unsorted", []string{"10.2.0.0/16", "10.0.0.0/8", "9.0.0.0/8"}, 1},
+		{"families kept apart", []string{"255.255.255.255", "::/128"}, 2},
+		{"ipv6 overlapping", []string{"2001:db8::/32", "2001:db8:1::/48"}, 1},
+		{"duplicates", []string{"192.0.2.1", "192.0.2.1"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(tt.entries...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Compact()
+			if s.Len() != tt.want {
+				t.Fatalf("Len() = %d, want %d", s.Len(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ir.txt")
+	content := "# فهرست آزمایشی\n2.144.0.0/14\n\n5.22.0.0/17   # توضیح\n2a01:5ec0::/29\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Set{}
+	if err := s.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", s.Len())
+	}
+	if !s.Contains(net.ParseIP("5.22.0.1")) || s.Contains(net.ParseIP("5.22.128.1")) {
+		t.Fatal("unexpected membership for 5.22.0.0/17")
+	}
+
+	bad := filepath.Join(dir, "bad.txt")
+	if err := os.WriteFile(bad, []byte("10.0.0.0/8\nnot-an-ip\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Set{}).LoadFile(bad); err == nil || !strings.HasPrefix(err.Error(), bad+":2:") {
+		t.Fatalf("LoadFile error = %v, want line 2", err)
+	}
+}
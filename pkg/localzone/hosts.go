@@ -0,0 +1,110 @@
+package localzone
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// hosts نام‌های فایل‌های hosts؛ هر نام فقط خودش را پاسخ می‌دهد
+type hosts struct {
+	ttl   uint32
+	addrs map[string][]net.IP
+	// ptr نام اصلی هر آدرس برای درخواست‌های معکوس
+	ptr map[string]string
+}
+
+func newHosts(ttl uint32) *hosts {
+	return &hosts{ttl: ttl, addrs: make(map[string][]net.IP), ptr: make(map[string]string)}
+}
+
+// loadFile خواندن یک فایل با قالب /etc/hosts: IP و سپس نام اصلی و نام‌های دیگر
+func (h *hosts) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		// آدرس‌های دارای zone (مثل fe80::1%lo0) نادیده گرفته می‌شوند
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			if strings.Contains(fields[0], "%") {
+				continue
+			}
+			return fmt.Errorf("%s:%d: invalid address %q", path, lineNum, fields[0])
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		for i, name := range fields[1:] {
+			if _, ok := dns.IsDomainName(name); !ok {
+				return fmt.Errorf("%s:%d: invalid name %q", path, lineNum, name)
+			}
+			key := strings.ToLower(dns.Fqdn(name))
+			h.addrs[key] = append(h.addrs[key], ip)
+			if i == 0 {
+				if rev, err := dns.ReverseAddr(ip.String()); err == nil {
+					if _, exists := h.ptr[rev]; !exists {
+						h.ptr[rev] = dns.Fqdn(name)
+					}
+				}
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// lookup پاسخ نام از hosts؛ nil اگر نام در فایل‌ها نباشد
+//
+// نوع‌های بدون رکورد (مثلاً AAAA برای نامی که فقط IPv4 دارد) پاسخ NODATA می‌گیرند.
+func (h *hosts) lookup(key, name string, qtype uint16) *result {
+	if target, ok := h.ptr[key]; ok {
+		res := &result{rcode: dns.RcodeSuccess}
+		if qtype == dns.TypePTR || qtype == dns.TypeANY {
+			res.answer = []dns.RR{&dns.PTR{
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: h.ttl},
+				Ptr: target,
+			}}
+		}
+		return res
+	}
+
+	addrs, ok := h.addrs[key]
+	if !ok {
+		return nil
+	}
+	res := &result{rcode: dns.RcodeSuccess}
+	for _, ip := range addrs {
+		v4 := ip.To4() != nil
+		switch {
+		case v4 && (qtype == dns.TypeA || qtype == dns.TypeANY):
+			res.answer = append(res.answer, &dns.A{
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: h.ttl},
+				A:   ip,
+			})
+		case !v4 && (qtype == dns.TypeAAAA || qtype == dns.TypeANY):
+			res.answer = append(res.answer, &dns.AAAA{
+				Hdr:  dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: h.ttl},
+				AAAA: ip,
+			})
+		}
+	}
+	return res
+}
@@ -0,0 +1,200 @@
+// Package localzone پاسخ محلی و authoritative به نام‌های داخلی
+//
+// داده‌ها از فایل‌های zone با قالب RFC 1035 و فایل‌های hosts خوانده می‌شوند.
+// پاسخ‌ها پرچم AA دارند؛ نام ناموجود در zone پاسخ NXDOMAIN و نوع ناموجود
+// پاسخ NODATA می‌گیرد و SOA zone در بخش authority قرار می‌گیرد (RFC 2308).
+// زنجیره CNAME تا جایی که در داده‌های محلی باشد همین‌جا دنبال می‌شود و
+// مقصد بیرونی به فراخواننده برگردانده می‌شود.
+package localzone
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maxChain حداکثر طول زنجیره CNAME محلی
+const maxChain = 8
+
+// SourceHosts نام منبع پاسخ‌های فایل‌های hosts
+const SourceHosts = "hosts"
+
+// Config تنظیمات zone های محلی
+type Config struct {
+	// WatchInterval فاصله بررسی تغییر فایل‌ها
+	WatchInterval time.Duration `yaml:"watch_interval"`
+	// HostsTTL TTL پاسخ‌های فایل‌های hosts
+	HostsTTL time.Duration `yaml:"hosts_ttl"`
+	Hosts    []string      `yaml:"hosts"`
+	Zones    []ZoneConfig  `yaml:"zones"`
+}
+
+// ZoneConfig یک فایل zone
+type ZoneConfig struct {
+	File string `yaml:"file"`
+	// Origin نام zone برای فایل‌های بدون $ORIGIN
+	Origin string `yaml:"origin"`
+}
+
+// Store داده‌های بارگذاری‌شده؛ پس از ساخت فقط خواندنی است
+type Store struct {
+	cfg   Config
+	hosts *hosts
+	// zones به ترتیب طول نام (عمیق‌ترین اول)
+	zones []*zone
+}
+
+// Load خواندن همه فایل‌های zone و hosts
+func Load(cfg Config) (*Store, error) {
+	s := &Store{cfg: cfg, hosts: newHosts(uint32(cfg.HostsTTL / time.Second))}
+	for _, file := range cfg.Hosts {
+		if err := s.hosts.loadFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, zc := range cfg.Zones {
+		z, err := loadZone(zc)
+		if err != nil {
+			return nil, err
+		}
+		if seen[z.origin] {
+			return nil, fmt.Errorf("%s: duplicate zone %s", zc.File, z.origin)
+		}
+		seen[z.origin] = true
+		s.zones = append(s.zones, z)
+	}
+	sort.SliceStable(s.zones, func(i, j int) bool {
+		return dns.CountLabel(s.zones[i].origin) > dns.CountLabel(s.zones[j].origin)
+	})
+	return s, nil
+}
+
+// Config تنظیماتی که داده‌ها با آن ساخته شده‌اند (برای بارگذاری با تغییر فایل)
+func (s *Store) Config() Config {
+	return s.cfg
+}
+
+// ZoneInfo خلاصه یک zone برای لاگ
+type ZoneInfo struct {
+	Origin  string
+	Serial  uint32
+	Records int
+}
+
+// Zones خلاصه zone های بارگذاری‌شده
+func (s *Store) Zones() []ZoneInfo {
+	if s == nil {
+		return nil
+	}
+	out := make([]ZoneInfo, 0, len(s.zones))
+	for _, z := range s.zones {
+		out = append(out, ZoneInfo{Origin: strings.TrimSuffix(z.origin, "."), Serial: z.soa.Serial, Records: z.records})
+	}
+	return out
+}
+
+// HostsEntries تعداد نام‌های فایل‌های hosts
+func (s *Store) HostsEntries() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.hosts.addrs)
+}
+
+// result پاسخ یک نام در داده‌های محلی
+type result struct {
+	answer []dns.RR
+	ns     []dns.RR
+	rcode  int
+	// cname مقصد CNAME که باید دنبال شود
+	cname string
+}
+
+// Answer پاسخ محلی درخواست؛ nil اگر نام در هیچ zone یا فایل hosts نباشد
+//
+// source نام zone (یا hosts) پاسخ‌دهنده است. chase مقصد CNAME بیرون از
+// داده‌های محلی است که فراخواننده باید پاسخ آن را به انتهای پاسخ اضافه کند.
+func (s *Store) Answer(r *dns.Msg) (m *dns.Msg, source, chase string) {
+	if s == nil || len(r.Question) == 0 {
+		return nil, "", ""
+	}
+	q := r.Question[0]
+	if q.Qclass != dns.ClassINET && q.Qclass != dns.ClassANY {
+		return nil, "", ""
+	}
+
+	m = new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	m.RecursionAvailable = true
+
+	name := q.Name
+	for i := 0; i < maxChain; i++ {
+		res, src := s.lookup(name, q.Qtype)
+		if res == nil {
+			if i == 0 {
+				return nil, "", ""
+			}
+			return m, source, name
+		}
+		if i == 0 {
+			source = src
+		}
+		m.Answer = append(m.Answer, res.answer...)
+		if res.cname == "" {
+			m.Rcode = res.rcode
+			m.Ns = res.ns
+			return m, source, ""
+		}
+		name = res.cname
+	}
+
+	// حلقه CNAME در داده‌های محلی
+	m.Rcode = dns.RcodeServerFailure
+	return m, source, ""
+}
+
+// lookup پاسخ یک نام از hosts یا عمیق‌ترین zone شامل آن
+func (s *Store) lookup(name string, qtype uint16) (*result, string) {
+	key := strings.ToLower(dns.Fqdn(name))
+	if res := s.hosts.lookup(key, name, qtype); res != nil {
+		return res, SourceHosts
+	}
+	for _, z := range s.zones {
+		if dns.IsSubDomain(z.origin, key) {
+			return z.lookup(key, name, qtype), strings.TrimSuffix(z.origin, ".")
+		}
+	}
+	return nil, ""
+}
+
+// Snapshot اثر انگشت اندازه و زمان تغییر فایل‌ها برای تشخیص تغییر
+func Snapshot(cfg Config) string {
+	var b strings.Builder
+	files := append([]string(nil), cfg.Hosts...)
+	for _, zc := range cfg.Zones {
+		files = append(files, zc.File)
+	}
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			fmt.Fprintf(&b, "%s:missing;", file)
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", file, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return b.String()
+}
+
+// withName کپی رکورد با نام درخواست
+func withName(rr dns.RR, name string) dns.RR {
+	rr = dns.Copy(rr)
+	rr.Header().Name = name
+	return rr
+}
@@ -0,0 +1,247 @@
+package localzone
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func loadTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Load(Config{
+		HostsTTL: time.Minute,
+		Hosts:    []string{"testdata/hosts"},
+		Zones:    []ZoneConfig{{File: "testdata/corp.zone"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// rrStrings نمایش فشرده رکوردها: "name type data"
+func rrStrings(rrs []dns.RR) []string {
+	var out []string
+	for _, rr := range rrs {
+		fields := strings.Fields(rr.String())
+		out = append(out, fields[0]+" "+fields[3]+" "+strings.Join(fields[4:], " "))
+	}
+	return out
+}
+
+func TestAnswer(t *testing.T) {
+	s := loadTestStore(t)
+
+	tests := []struct {
+		name   string
+		qname  string
+		qtype  uint16
+		rcode  int
+		answer []string
+		// soa یعنی SOA در بخش authority انتظار می‌رود
+		soa    bool
+		source string
+		chase  string
+	}{
+		{"address", "www.corp.example.", dns.TypeA, dns.RcodeSuccess,
+			[]string{"www.corp.example. A 10.0.0.10"}, false, "corp.example", ""},
+		{"case preserved", "WWW.Corp.Example.", dns.TypeAAAA, dns.RcodeSuccess,
+			[]string{"WWW.Corp.Example. AAAA fd00::10"}, false, "corp.example", ""},
+		{"any", "www.corp.example.", dns.TypeANY, dns.RcodeSuccess,
+			[]string{"www.corp.example. A 10.0.0.10", "www.corp.example. AAAA fd00::10"}, false, "corp.example", ""},
+		{"nodata", "www.corp.example.", dns.TypeTXT, dns.RcodeSuccess, nil, true, "corp.example", ""},
+		{"nxdomain", "missing.corp.example.", dns.TypeA, dns.RcodeNameError, nil, true, "corp.example", ""},
+		{"nxdomain below name", "x.www.corp.example.", dns.TypeA, dns.RcodeNameError, nil, true, "corp.example", ""},
+		{"empty non-terminal", "deep.corp.example.", dns.TypeA, dns.RcodeSuccess, nil, true, "corp.example", ""},
+		{"nested empty non-terminal", "b.deep.corp.example.", dns.TypeA, dns.RcodeSuccess, nil, true, "corp.example", ""},
+		{"apex", "corp.example.", dns.TypeNS, dns.RcodeSuccess,
+			[]string{"corp.example. NS ns.corp.example."}, false, "corp.example", ""},
+
+		// RFC 4592: wildcard فقط برای نام‌های ناموجود زیر نزدیک‌ترین encloser
+		{"wildcard", "x.apps.corp.example.", dns.TypeA, dns.RcodeSuccess,
+			[]string{"x.apps.corp.example. A 10.0.1.1"}, false, "corp.example", ""},
+		{"wildcard deeper", "y.x.apps.corp.example.", dns.TypeA, dns.RcodeSuccess,
+			[]string{"y.x.apps.corp.example. A 10.0.1.1"}, false, "corp.example", ""},
+		{"wildcard nodata", "x.apps.corp.example.", dns.TypeTXT, dns.RcodeSuccess, nil, true, "corp.example", ""},
+		{"existing name blocks wildcard", "exact.apps.corp.example.", dns.TypeA, dns.RcodeSuccess, nil, true, "corp.example", ""},
+		{"wildcard parent", "apps.corp.example.", dns.TypeA, dns.RcodeSuccess, nil, true, "corp.example", ""},
+		{"no wildcard at encloser", "x.deep.corp.example.", dns.TypeA, dns.RcodeNameError, nil, true, "corp.example", ""},
+
+		{"cname chain", "alias.corp.example.", dns.TypeA, dns.RcodeSuccess,
+			[]string{"alias.corp.example. CNAME www.corp.example.", "www.corp.example. A 10.0.0.10"}, false, "corp.example", ""},
+		{"cname query", "alias.corp.example.", dns.TypeCNAME, dns.RcodeSuccess,
+			[]string{"alias.corp.example. CNAME www.corp.example."}, false, "corp.example", ""},
+		{"wildcard cname", "q.wild.corp.example.", dns.TypeA, dns.RcodeSuccess,
+			[]string{"q.wild.corp.example. CNAME www.corp.example.", "www.corp.example. A 10.0.0.10"}, false, "corp.example", ""},
+		{"cname outside", "outside.corp.example.", dns.TypeA, dns.RcodeSuccess,
+			[]string{"outside.corp.example. CNAME www.public.example."}, false, "corp.example", "www.public.example."},
+		{"cname loop", "loop1.corp.example.", dns.TypeA, dns.RcodeServerFailure,
+			[]string{
+				"loop1.corp.example. CNAME loop2.corp.example.", "loop2.corp.example. CNAME loop1.corp.example.",
+				"loop1.corp.example. CNAME loop2.corp.example.", "loop2.corp.example. CNAME loop1.corp.example.",
+				"loop1.corp.example. CNAME loop2.corp.example.", "loop2.corp.example. CNAME loop1.corp.example.",
+				"loop1.corp.example. CNAME loop2.corp.example.", "loop2.corp.example. CNAME loop1.corp.example.",
+			}, false, "corp.example", ""},
+
+		{"hosts address", "nas.home.", dns.TypeA, dns.RcodeSuccess,
+			[]string{"nas.home. A 10.1.0.5"}, false, SourceHosts, ""},
+		{"hosts alias", "NAS.", dns.TypeA, dns.RcodeSuccess,
+			[]string{"NAS. A 10.1.0.5"}, false, SourceHosts, ""},
+		{"hosts ipv6", "nas.home.", dns.TypeAAAA, dns.RcodeSuccess,
+			[]string{"nas.home. AAAA fd00::5"}, false, SourceHosts, ""},
+		{"hosts missing family", "printer.home.", dns.TypeAAAA, dns.RcodeSuccess, nil, false, SourceHosts, ""},
+		{"hosts over zone", "mx.corp.example.", dns.TypeA, dns.RcodeSuccess,
+			[]string{"mx.corp.example. A 10.1.0.6"}, false, SourceHosts, ""},
+		{"hosts ptr first name", "5.0.1.10.in-addr.arpa.", dns.TypePTR, dns.RcodeSuccess,
+			[]string{"5.0.1.10.in-addr.arpa. PTR nas.home."}, false, SourceHosts, ""},
+		{"hosts ptr ipv6", "5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa.", dns.TypePTR, dns.RcodeSuccess,
+			[]string{"5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa. PTR nas.home."}, false, SourceHosts, ""},
+		{"hosts ptr other type", "5.0.1.10.in-addr.arpa.", dns.TypeA, dns.RcodeSuccess, nil, false, SourceHosts, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := new(dns.Msg)
+			r.SetQuestion(tt.qname, tt.qtype)
+			m, source, chase := s.Answer(r)
+			if m == nil {
+				t.Fatal("no local answer")
+			}
+			if !m.Authoritative {
+				t.Error("AA not set")
+			}
+			if m.Rcode != tt.rcode {
+				t.Errorf("rcode = %s, want %s", dns.RcodeToString[m.Rcode], dns.RcodeToString[tt.rcode])
+			}
+			if got := rrStrings(m.Answer); strings.Join(got, "\n") != strings.Join(tt.answer, "\n") {
+				// ترتیب رکوردهای هم‌نام (مثلاً ANY) ثابت نیست
+				if len(got) != len(tt.answer) || !sameSet(got, tt.answer) {
+					t.Errorf("answer = %q, want %q", got, tt.answer)
+				}
+			}
+			hasSOA := len(m.Ns) == 1 && m.Ns[0].Header().Rrtype == dns.TypeSOA
+			if hasSOA != tt.soa {
+				t.Errorf("authority = %v, want SOA %v", m.Ns, tt.soa)
+			}
+			if hasSOA && m.Ns[0].Header().Ttl != 300 {
+				t.Errorf("negative TTL = %d, want SOA minimum 300", m.Ns[0].Header().Ttl)
+			}
+			if source != tt.source || chase != tt.chase {
+				t.Errorf("source/chase = %q/%q, want %q/%q", source, chase, tt.source, tt.chase)
+			}
+		})
+	}
+}
+
+func sameSet(a, b []string) bool {
+	seen := make(map[string]int)
+	for _, s := range a {
+		seen[s]++
+	}
+	for _, s := range b {
+		seen[s]--
+	}
+	for _, n := range seen {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAnswerNotLocal(t *testing.T) {
+	s := loadTestStore(t)
+	tests := []struct {
+		name  string
+		qname string
+		class uint16
+	}{
+		{"outside zones", "www.public.example.", dns.ClassINET},
+		{"delegation point", "sub.corp.example.", dns.ClassINET},
+		{"below delegation", "host.sub.corp.example.", dns.ClassINET},
+		{"glue below delegation", "ns.sub.corp.example.", dns.ClassINET},
+		{"zone-scoped hosts address", "link-local.home.", dns.ClassINET},
+		{"chaos class", "www.corp.example.", dns.ClassCHAOS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := new(dns.Msg)
+			r.SetQuestion(tt.qname, dns.TypeA)
+			r.Question[0].Qclass = tt.class
+			if m, _, _ := s.Answer(r); m != nil {
+				t.Fatalf("got local answer %v", m)
+			}
+		})
+	}
+
+	var nilStore *Store
+	r := new(dns.Msg)
+	r.SetQuestion("www.corp.example.", dns.TypeA)
+	if m, _, _ := nilStore.Answer(r); m != nil {
+		t.Fatal("nil store answered")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	s := loadTestStore(t)
+	zones := s.Zones()
+	if len(zones) != 1 || zones[0].Origin != "corp.example" || zones[0].Serial != 42 || zones[0].Records != 17 {
+		t.Fatalf("zones = %+v", zones)
+	}
+	if n := s.HostsEntries(); n != 5 {
+		t.Fatalf("hosts entries = %d, want 5", n)
+	}
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"duplicate zone", Config{Zones: []ZoneConfig{{File: "testdata/corp.zone"}, {File: "testdata/corp.zone"}}}},
+		{"no soa", Config{Zones: []ZoneConfig{{File: write("nosoa.zone", "www 60 A 10.0.0.1\n"), Origin: "x.example"}}}},
+		{"cname and other data", Config{Zones: []ZoneConfig{{File: write("cname.zone",
+			"@ 60 SOA ns. admin. 1 1 1 1 1\nwww 60 CNAME a\nwww 60 A 10.0.0.1\n"), Origin: "x.example"}}}},
+		{"record outside zone", Config{Zones: []ZoneConfig{{File: write("outside.zone",
+			"@ 60 SOA ns. admin. 1 1 1 1 1\nwww.other.example. 60 A 10.0.0.1\n"), Origin: "x.example"}}}},
+		{"invalid hosts address", Config{Hosts: []string{write("bad-hosts", "10.0.0.300 host\n")}}},
+		{"missing file", Config{Hosts: []string{filepath.Join(dir, "missing")}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.cfg); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	cfg := Config{Hosts: []string{path}}
+	missing := Snapshot(cfg)
+	if err := os.WriteFile(path, []byte("10.0.0.1 a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	written := Snapshot(cfg)
+	if written == missing {
+		t.Fatal("snapshot unchanged after file creation")
+	}
+	if err := os.WriteFile(path, []byte("10.0.0.1 a b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if Snapshot(cfg) == written {
+		t.Fatal("snapshot unchanged after size change")
+	}
+}
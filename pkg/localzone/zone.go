@@ -0,0 +1,150 @@
+package localzone
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// zone یک فایل zone بارگذاری‌شده
+type zone struct {
+	origin  string
+	soa     *dns.SOA
+	records int
+	// nodes رکوردهای هر نام به تفکیک نوع؛ نام‌های میانی بدون رکورد هم
+	// (empty non-terminal) وجود دارند تا پاسخ آن‌ها NODATA باشد نه NXDOMAIN
+	nodes map[string]map[uint16][]dns.RR
+}
+
+// loadZone خواندن یک فایل zone با قالب RFC 1035
+func loadZone(cfg ZoneConfig) (*zone, error) {
+	f, err := os.Open(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	origin := ""
+	if cfg.Origin != "" {
+		origin = strings.ToLower(dns.Fqdn(cfg.Origin))
+	}
+	z := &zone{nodes: make(map[string]map[uint16][]dns.RR)}
+
+	zp := dns.NewZoneParser(f, origin, cfg.File)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		hdr := rr.Header()
+		hdr.Name = strings.ToLower(hdr.Name)
+		if soa, isSOA := rr.(*dns.SOA); isSOA && z.soa == nil {
+			if origin == "" {
+				origin = hdr.Name
+			}
+			if hdr.Name == origin {
+				z.soa = soa
+			}
+		}
+		if origin == "" {
+			return nil, fmt.Errorf("%s: zone origin unknown: set origin or start the file with SOA", cfg.File)
+		}
+		if !dns.IsSubDomain(origin, hdr.Name) {
+			return nil, fmt.Errorf("%s: record %s outside zone %s", cfg.File, hdr.Name, origin)
+		}
+		z.add(rr, origin)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	if z.soa == nil {
+		return nil, fmt.Errorf("%s: zone %s has no SOA record", cfg.File, origin)
+	}
+	for name, node := range z.nodes {
+		if len(node[dns.TypeCNAME]) > 0 && len(node) > 1 {
+			return nil, fmt.Errorf("%s: %s has CNAME and other data", cfg.File, name)
+		}
+	}
+	z.origin = origin
+	return z, nil
+}
+
+// add افزودن رکورد و نام‌های میانی تا apex
+func (z *zone) add(rr dns.RR, origin string) {
+	name := rr.Header().Name
+	node := z.nodes[name]
+	if node == nil {
+		node = make(map[uint16][]dns.RR)
+		z.nodes[name] = node
+	}
+	node[rr.Header().Rrtype] = append(node[rr.Header().Rrtype], rr)
+	z.records++
+
+	for name != origin {
+		name = parent(name)
+		if _, ok := z.nodes[name]; !ok {
+			z.nodes[name] = make(map[uint16][]dns.RR)
+		}
+	}
+}
+
+// lookup پاسخ نام داخل zone؛ nil اگر نام زیر یک delegation باشد
+//
+// key شکل کوچک‌شده name است؛ رکوردهای پاسخ با نام درخواست برگردانده می‌شوند.
+func (z *zone) lookup(key, name string, qtype uint16) *result {
+	// zone های واگذارشده (NS زیر apex) محلی نیستند و از تانل پرسیده می‌شوند
+	for n := key; n != z.origin; n = parent(n) {
+		if len(z.nodes[n][dns.TypeNS]) > 0 {
+			return nil
+		}
+	}
+
+	node, ok := z.nodes[key]
+	if !ok {
+		// wildcard در نزدیک‌ترین نام موجود (RFC 4592)
+		encloser := parent(key)
+		for encloser != z.origin {
+			if _, exists := z.nodes[encloser]; exists {
+				break
+			}
+			encloser = parent(encloser)
+		}
+		if node, ok = z.nodes["*."+encloser]; !ok {
+			return &result{rcode: dns.RcodeNameError, ns: z.negative()}
+		}
+	}
+
+	res := &result{rcode: dns.RcodeSuccess}
+	for rrtype, rrs := range node {
+		if rrtype == qtype || (qtype == dns.TypeANY && rrtype != dns.TypeCNAME) {
+			for _, rr := range rrs {
+				res.answer = append(res.answer, withName(rr, name))
+			}
+		}
+	}
+	if len(res.answer) > 0 {
+		return res
+	}
+	if cname := node[dns.TypeCNAME]; len(cname) > 0 && qtype != dns.TypeCNAME {
+		res.answer = []dns.RR{withName(cname[0], name)}
+		res.cname = cname[0].(*dns.CNAME).Target
+		return res
+	}
+	res.ns = z.negative()
+	return res
+}
+
+// negative رکورد SOA بخش authority پاسخ‌های منفی با TTL حداقل (RFC 2308)
+func (z *zone) negative() []dns.RR {
+	soa := dns.Copy(z.soa).(*dns.SOA)
+	if soa.Minttl < soa.Hdr.Ttl {
+		soa.Hdr.Ttl = soa.Minttl
+	}
+	return []dns.RR{soa}
+}
+
+// parent حذف اولین برچسب نام
+func parent(name string) string {
+	if i := strings.IndexByte(name, '.'); i >= 0 && i < len(name)-1 {
+		return name[i+1:]
+	}
+	return "."
+}
@@ -0,0 +1,213 @@
+// Package logging لاگ ساخت‌یافته مبتنی بر log/slog با سطح‌بندی و لاگ‌گرهای هر بخش
+//
+// لاگ‌گرهای بخش‌ها (Component) را می‌توان پیش از Setup به صورت متغیر سراسری
+// ساخت؛ هر رکورد هنگام ثبت به handler فعلی سپرده می‌شود، پس تغییر خروجی یا
+// سطح پس از شروع برنامه روی همه آن‌ها اثر دارد.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Config تنظیمات یک خروجی لاگ
+type Config struct {
+	// Level یکی از debug، info، warn یا error
+	Level string `yaml:"level"`
+	// Format یکی از text یا json
+	Format string `yaml:"format"`
+	// Output یکی از stderr، stdout یا مسیر فایل
+	Output string `yaml:"output"`
+}
+
+var (
+	level slog.LevelVar
+	root  atomic.Pointer[rootHandler]
+
+	filesMu sync.Mutex
+	// files فایل‌های خروجی باز شده برای Sync
+	files []*os.File
+)
+
+// rootHandler نگه‌دارنده handler فعلی برای تشخیص تغییر آن
+type rootHandler struct {
+	handler slog.Handler
+}
+
+func init() {
+	root.Store(&rootHandler{handler: slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: &level})})
+	slog.SetDefault(slog.New(&componentHandler{}))
+}
+
+// Setup تنظیم خروجی و سطح لاگ‌های تشخیصی
+func Setup(cfg Config) error {
+	if err := SetLevel(cfg.Level); err != nil {
+		return err
+	}
+
+	w, err := openOutput(cfg.Output)
+	if err != nil {
+		return err
+	}
+	handler, err := newHandler(w, cfg.Format, &level)
+	if err != nil {
+		return err
+	}
+
+	root.Store(&rootHandler{handler: handler})
+	return nil
+}
+
+// SetLevel تغییر سطح لاگ‌های تشخیصی
+func SetLevel(name string) error {
+	l, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+// ParseLevel خواندن نام سطح لاگ؛ خالی یعنی info
+func ParseLevel(name string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(defaultString(name, "info"))); err != nil {
+		return l, fmt.Errorf("invalid log level %q", name)
+	}
+	return l, nil
+}
+
+// Component لاگ‌گر یک بخش برنامه با فیلد component
+func Component(name string) *slog.Logger {
+	return slog.New(&componentHandler{ops: []handlerOp{{attrs: []slog.Attr{slog.String("component", name)}}}})
+}
+
+// Fatal ثبت خطا و خروج از برنامه
+func Fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// openOutput باز کردن خروجی لاگ
+func openOutput(output string) (io.Writer, error) {
+	switch output {
+	case "", "stderr":
+		return os.Stderr, nil
+	case "stdout":
+		return os.Stdout, nil
+	}
+	f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	filesMu.Lock()
+	files = append(files, f)
+	filesMu.Unlock()
+	return f, nil
+}
+
+// Sync نوشتن محتوای فایل‌های لاگ روی دیسک؛ هنگام خروج صدا زده می‌شود
+func Sync() error {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+
+	var first error
+	for _, f := range files {
+		if err := f.Sync(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// newHandler ساخت handler متنی یا JSON
+func newHandler(w io.Writer, format string, leveler slog.Leveler) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: leveler}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q", format)
+}
+
+func defaultString(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// componentHandler هر رکورد را با فیلدها و گروه‌های خود به handler فعلی می‌سپارد
+type componentHandler struct {
+	// ops فراخوانی‌های WithAttrs و WithGroup به ترتیب، تا روی هر handler
+	// فعلی با همان تودرتویی دوباره اعمال شوند
+	ops []handlerOp
+
+	cache atomic.Pointer[derivedHandler]
+}
+
+// handlerOp یک فراخوانی WithAttrs (attrs) یا WithGroup (group)
+type handlerOp struct {
+	attrs []slog.Attr
+	group string
+}
+
+// derivedHandler handler ساخته‌شده از یک rootHandler مشخص
+type derivedHandler struct {
+	root    *rootHandler
+	handler slog.Handler
+}
+
+func (h *componentHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= level.Level()
+}
+
+func (h *componentHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.current().Handle(ctx, r)
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(handlerOp{attrs: append([]slog.Attr{}, attrs...)})
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(handlerOp{group: name})
+}
+
+func (h *componentHandler) with(op handlerOp) *componentHandler {
+	ops := make([]handlerOp, 0, len(h.ops)+1)
+	return &componentHandler{ops: append(append(ops, h.ops...), op)}
+}
+
+// current ساخت (یا استفاده دوباره از) handler مشتق از handler فعلی
+func (h *componentHandler) current() slog.Handler {
+	r := root.Load()
+	if d := h.cache.Load(); d != nil && d.root == r {
+		return d.handler
+	}
+
+	handler := r.handler
+	for _, op := range h.ops {
+		if op.group != "" {
+			handler = handler.WithGroup(op.group)
+		} else {
+			handler = handler.WithAttrs(op.attrs)
+		}
+	}
+	h.cache.Store(&derivedHandler{root: r, handler: handler})
+	return handler
+}
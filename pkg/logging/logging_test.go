@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+// captureJSON هدایت لاگ‌ها به بافر JSON تا پایان آزمون
+func captureJSON(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := root.Load()
+	root.Store(&rootHandler{handler: slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: &level})})
+	t.Cleanup(func() { root.Store(previous) })
+	return &buf
+}
+
+func TestComponentGroups(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func(l *slog.Logger)
+		want map[string]any
+	}{
+		{
+			"attrs",
+			func(l *slog.Logger) { l.With("user", "u1").Info("m", "n", 1) },
+			map[string]any{"user": "u1", "n": 1.0},
+		},
+		{
+			"attrs after group stay in group",
+			func(l *slog.Logger) { l.WithGroup("g").With("a", 1).Info("m", "b", 2) },
+			map[string]any{"g": map[string]any{"a": 1.0, "b": 2.0}},
+		},
+		{
+			"nested groups",
+			func(l *slog.Logger) { l.WithGroup("g").WithGroup("h").With("a", 1).Info("m", "b", 2) },
+			map[string]any{"g": map[string]any{"h": map[string]any{"a": 1.0, "b": 2.0}}},
+		},
+		{
+			"attrs at each level",
+			func(l *slog.Logger) { l.With("a", 1).WithGroup("g").With("b", 2).WithGroup("h").Info("m", "c", 3) },
+			map[string]any{"a": 1.0, "g": map[string]any{"b": 2.0, "h": map[string]any{"c": 3.0}}},
+		},
+		{
+			"empty group elided",
+			func(l *slog.Logger) { l.WithGroup("g").Info("m") },
+			map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureJSON(t)
+			tt.log(Component("test"))
+
+			var got map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("%v: %s", err, buf)
+			}
+			if got["component"] != "test" || got["msg"] != "m" {
+				t.Fatalf("got %s", buf)
+			}
+			for _, k := range []string{"time", "level", "msg", "component"} {
+				delete(got, k)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComponentFollowsSetup(t *testing.T) {
+	logger := Component("test").With("a", 1)
+
+	first := captureJSON(t)
+	logger.Info("first")
+	second := captureJSON(t)
+	logger.Info("second")
+
+	if !bytes.Contains(first.Bytes(), []byte(`"msg":"first"`)) || bytes.Contains(first.Bytes(), []byte("second")) {
+		t.Fatalf("first handler got %s", first)
+	}
+	if !bytes.Contains(second.Bytes(), []byte(`"msg":"second","component":"test","a":1`)) {
+		t.Fatalf("second handler got %s", second)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"", slog.LevelInfo, false},
+		{"debug", slog.LevelDebug, false},
+		{"WARN", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"verbose", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLevel(tt.name)
+			if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+				t.Fatalf("ParseLevel(%q) = %v, %v", tt.name, got, err)
+			}
+		})
+	}
+}
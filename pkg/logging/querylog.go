@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Query یک رکورد لاگ درخواست DNS
+type Query struct {
+	User     string
+	Client   string
+	QName    string
+	QType    string
+	RCode    string
+	Cache    string
+	Route    string
+	Upstream string
+	Latency  time.Duration
+}
+
+// NewQuery رکورد لاگ با نام و نوع سؤال درخواست
+func NewQuery(r *dns.Msg) Query {
+	var e Query
+	if len(r.Question) > 0 {
+		e.QName = r.Question[0].Name
+		e.QType = dns.TypeToString[r.Question[0].Qtype]
+	}
+	return e
+}
+
+// QueryLogConfig تنظیمات لاگ درخواست‌ها
+type QueryLogConfig struct {
+	Enabled bool `yaml:"enabled"`
+	Config  `yaml:",inline"`
+}
+
+// QueryLog خروجی جداگانه لاگ درخواست‌ها
+//
+// مقدار nil یعنی لاگ درخواست‌ها غیرفعال است و Log کاری انجام نمی‌دهد.
+type QueryLog struct {
+	logger *slog.Logger
+}
+
+// NewQueryLog ساخت لاگ درخواست‌ها با خروجی و قالب مستقل از لاگ تشخیصی
+func NewQueryLog(cfg Config) (*QueryLog, error) {
+	w, err := openOutput(cfg.Output)
+	if err != nil {
+		return nil, err
+	}
+	handler, err := newHandler(w, cfg.Format, slog.LevelInfo)
+	if err != nil {
+		return nil, err
+	}
+	return &QueryLog{logger: slog.New(handler)}, nil
+}
+
+// OpenQueryLog ساخت لاگ درخواست‌ها از تنظیمات؛ برای تنظیمات غیرفعال nil برمی‌گرداند
+func OpenQueryLog(cfg QueryLogConfig) (*QueryLog, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	return NewQueryLog(cfg.Config)
+}
+
+// Log ثبت یک درخواست؛ فیلدهای خالی حذف می‌شوند
+func (q *QueryLog) Log(e Query) {
+	if q == nil {
+		return
+	}
+
+	attrs := make([]slog.Attr, 0, 9)
+	add := func(key, value string) {
+		if value != "" {
+			attrs = append(attrs, slog.String(key, value))
+		}
+	}
+	add("user", e.User)
+	add("client", e.Client)
+	add("qname", e.QName)
+	add("qtype", e.QType)
+	add("rcode", e.RCode)
+	add("cache", e.Cache)
+	add("route", e.Route)
+	add("upstream", e.Upstream)
+	attrs = append(attrs, slog.Duration("latency", e.Latency))
+
+	q.logger.LogAttrs(context.Background(), slog.LevelInfo, "query", attrs...)
+}
@@ -0,0 +1,506 @@
+// Package mux چندگانه‌سازی جریان‌های TCP روی یک اتصال تانل
+//
+// هر جریان با RequestID پیام‌ها شناسایی می‌شود. کلاینت جریان را با
+// TypeStreamOpen باز می‌کند و سرور با اولین TypeStreamWindow آن را تایید
+// یا با TypeStreamClose رد می‌کند. هر طرف فقط به اندازه اعتبار دریافتی از
+// طرف مقابل داده می‌فرستد و پس از مصرف نیمی از پنجره اعتبار تازه می‌دهد.
+// پیام‌های داده شماره ترتیب دارند و گیرنده آن‌ها را مرتب می‌کند، پس جریان‌ها
+// روی انتقال‌هایی که ترتیب فریم‌ها را حفظ نمی‌کنند (QUIC) هم درست کار می‌کنند.
+package mux
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dns-forwarder/pkg/protocol"
+)
+
+var (
+	// ErrClosed جریان یا تانل بسته شده است
+	ErrClosed = errors.New("stream closed")
+	// ErrTimeout سرور در زمان مقرر به درخواست باز کردن جریان پاسخ نداد
+	ErrTimeout = errors.New("stream open timeout")
+)
+
+// دلایل رایج رد جریان توسط سرور
+const (
+	ReasonDisabled    = "disabled"
+	ReasonNotAllowed  = "not allowed"
+	ReasonUnreachable = "unreachable"
+	ReasonLimit       = "limit"
+)
+
+// ResetError قطع جریان از طرف مقابل
+type ResetError struct {
+	Reason string
+}
+
+func (e *ResetError) Error() string {
+	return "stream reset: " + e.Reason
+}
+
+// SendFunc ارسال یک پیام روی تانل
+type SendFunc func(msg *protocol.Message) error
+
+// AcceptFunc پردازش درخواست باز کردن جریان در سمت سرور
+//
+// در goroutine جداگانه اجرا می‌شود و باید Accept یا Reject جریان را صدا بزند.
+type AcceptFunc func(s *Stream, addr string)
+
+// Mux جریان‌های یک اتصال تانل
+type Mux struct {
+	send   SendFunc
+	accept AcceptFunc
+	window uint32
+
+	mu      sync.Mutex
+	streams map[uint32]*Stream
+	nextID  uint32
+	closed  bool
+}
+
+// New ایجاد Mux؛ accept فقط در سمت سرور مقدار دارد
+func New(send SendFunc, window uint32, accept AcceptFunc) *Mux {
+	if window == 0 {
+		window = protocol.DefaultStreamWindow
+	}
+	return &Mux{
+		send:    send,
+		accept:  accept,
+		window:  window,
+		streams: make(map[uint32]*Stream),
+	}
+}
+
+// Open باز کردن جریان به مقصد host:port و انتظار برای تایید سرور
+func (m *Mux) Open(addr string, timeout time.Duration) (*Stream, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrClosed
+	}
+	m.nextID++
+	s := newStream(m, m.nextID, addr, 0)
+	m.streams[s.id] = s
+	m.mu.Unlock()
+
+	if err := m.send(protocol.NewStreamOpen(s.id, m.window, addr)); err != nil {
+		m.remove(s.id)
+		return nil, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-s.opened:
+	case <-timer.C:
+		s.Close()
+		return nil, ErrTimeout
+	}
+
+	s.mu.Lock()
+	err := s.err
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Handle پردازش یک پیام جریان دریافتی از تانل
+func (m *Mux) Handle(msg *protocol.Message) {
+	if msg.Type == protocol.TypeStreamOpen {
+		m.handleOpen(msg)
+		return
+	}
+
+	m.mu.Lock()
+	s := m.streams[msg.RequestID]
+	m.mu.Unlock()
+	if s == nil {
+		return
+	}
+
+	switch msg.Type {
+	case protocol.TypeStreamData:
+		seq, data, err := protocol.DecodeStreamData(msg.Payload)
+		if err != nil {
+			s.Close()
+			return
+		}
+		s.receive(seq, data)
+
+	case protocol.TypeStreamWindow:
+		increment, err := protocol.DecodeStreamWindow(msg.Payload)
+		if err != nil {
+			s.Close()
+			return
+		}
+		s.grant(increment)
+
+	case protocol.TypeStreamClose:
+		flag, seq, reason, err := protocol.DecodeStreamClose(msg.Payload)
+		if err != nil || flag == protocol.CloseReset {
+			s.fail(resetError(reason))
+			m.remove(s.id)
+			return
+		}
+		s.remoteFin(seq)
+	}
+}
+
+// handleOpen ثبت جریان درخواستی کلاینت و سپردن آن به AcceptFunc
+func (m *Mux) handleOpen(msg *protocol.Message) {
+	window, addr, err := protocol.DecodeStreamOpen(msg.Payload)
+
+	m.mu.Lock()
+	if m.accept == nil || m.closed || err != nil || m.streams[msg.RequestID] != nil {
+		m.mu.Unlock()
+		m.send(protocol.NewStreamReset(msg.RequestID, "rejected"))
+		return
+	}
+	s := newStream(m, msg.RequestID, addr, window)
+	m.streams[s.id] = s
+	m.mu.Unlock()
+
+	go m.accept(s, addr)
+}
+
+// remove حذف جریان از جدول
+func (m *Mux) remove(id uint32) {
+	m.mu.Lock()
+	delete(m.streams, id)
+	m.mu.Unlock()
+}
+
+// Len تعداد جریان‌های باز
+func (m *Mux) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.streams)
+}
+
+// Close بستن همه جریان‌ها پس از قطع تانل
+func (m *Mux) Close() {
+	m.mu.Lock()
+	m.closed = true
+	streams := m.streams
+	m.streams = make(map[uint32]*Stream)
+	m.mu.Unlock()
+
+	for _, s := range streams {
+		s.fail(ErrClosed)
+	}
+}
+
+// resetError خطای قطع جریان از طرف مقابل
+func resetError(reason string) error {
+	if reason == "" {
+		reason = "reset"
+	}
+	return &ResetError{Reason: reason}
+}
+
+// Stream یک جریان دوطرفه روی تانل
+type Stream struct {
+	mux  *Mux
+	id   uint32
+	addr string
+
+	mu          sync.Mutex
+	cond        *sync.Cond
+	buf         []byte
+	credit      uint32
+	consumed    uint32
+	sendSeq     uint32
+	recvSeq     uint32
+	pending     map[uint32][]byte
+	pendingSize int
+	finSeq      uint32
+	finReceived bool
+	established bool
+	opened      chan struct{}
+	readClosed  bool
+	writeClosed bool
+	err         error
+
+	bytesIn  uint64
+	bytesOut uint64
+}
+
+func newStream(m *Mux, id uint32, addr string, credit uint32) *Stream {
+	s := &Stream{
+		mux:    m,
+		id:     id,
+		addr:   addr,
+		credit: credit,
+		opened: make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// ID شناسه جریان
+func (s *Stream) ID() uint32 {
+	return s.id
+}
+
+// Addr مقصد درخواستی جریان
+func (s *Stream) Addr() string {
+	return s.addr
+}
+
+// Bytes حجم داده دریافتی و ارسالی جریان
+func (s *Stream) Bytes() (in, out uint64) {
+	return atomic.LoadUint64(&s.bytesIn), atomic.LoadUint64(&s.bytesOut)
+}
+
+// Accept تایید جریان در سمت سرور پس از اتصال به مقصد
+func (s *Stream) Accept() error {
+	s.mu.Lock()
+	s.established = true
+	s.mu.Unlock()
+	return s.mux.send(protocol.NewStreamWindow(s.id, s.mux.window))
+}
+
+// Reject رد جریان در سمت سرور به همراه دلیل
+func (s *Stream) Reject(reason string) {
+	s.fail(ErrClosed)
+	s.mux.remove(s.id)
+	s.mux.send(protocol.NewStreamReset(s.id, reason))
+}
+
+// Read خواندن داده دریافتی؛ پس از پایان ارسال طرف مقابل io.EOF برمی‌گرداند
+func (s *Stream) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	for len(s.buf) == 0 && !s.readClosed && s.err == nil {
+		s.cond.Wait()
+	}
+
+	if len(s.buf) == 0 {
+		defer s.mu.Unlock()
+		if s.err != nil {
+			return 0, s.err
+		}
+		return 0, io.EOF
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	s.consumed += uint32(n)
+
+	// اعتبار تازه پس از مصرف نیمی از پنجره
+	var increment uint32
+	if s.consumed >= s.mux.window/2 {
+		increment = s.consumed
+		s.consumed = 0
+	}
+	s.mu.Unlock()
+
+	if increment > 0 {
+		s.mux.send(protocol.NewStreamWindow(s.id, increment))
+	}
+	return n, nil
+}
+
+// Write ارسال داده در حد اعتبار دریافتی از طرف مقابل
+func (s *Stream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		s.mu.Lock()
+		for s.credit == 0 && s.err == nil && !s.writeClosed {
+			s.cond.Wait()
+		}
+		if s.err != nil {
+			err := s.err
+			s.mu.Unlock()
+			return written, err
+		}
+		if s.writeClosed {
+			s.mu.Unlock()
+			return written, ErrClosed
+		}
+
+		n := len(p)
+		if n > int(s.credit) {
+			n = int(s.credit)
+		}
+		if n > protocol.MaxStreamChunk {
+			n = protocol.MaxStreamChunk
+		}
+		s.credit -= uint32(n)
+		seq := s.sendSeq
+		s.sendSeq++
+		s.mu.Unlock()
+
+		if err := s.mux.send(protocol.NewStreamData(s.id, seq, p[:n])); err != nil {
+			return written, err
+		}
+
+		atomic.AddUint64(&s.bytesOut, uint64(n))
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// CloseWrite اعلام پایان ارسال به طرف مقابل (نیمه‌بسته)
+func (s *Stream) CloseWrite() error {
+	s.mu.Lock()
+	if s.writeClosed || s.err != nil {
+		s.mu.Unlock()
+		return nil
+	}
+	s.writeClosed = true
+	done := s.readClosed
+	seq := s.sendSeq
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	if done {
+		s.mux.remove(s.id)
+	}
+	return s.mux.send(protocol.NewStreamFin(s.id, seq))
+}
+
+// Close بستن جریان؛ اگر هر دو طرف پایان را اعلام نکرده باشند جریان قطع می‌شود
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	reset := s.err == nil && !(s.readClosed && s.writeClosed)
+	if s.err == nil {
+		s.err = ErrClosed
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	s.mux.remove(s.id)
+	if reset {
+		return s.mux.send(protocol.NewStreamReset(s.id, "closed"))
+	}
+	return nil
+}
+
+// receive افزودن داده دریافتی به بافر به ترتیب شماره پیام‌ها
+func (s *Stream) receive(seq uint32, data []byte) {
+	s.mu.Lock()
+	// طرف مقابل نباید بیش از پنجره اعلام‌شده بفرستد
+	if len(s.buf)+s.pendingSize+len(data) > int(s.mux.window) || seq-s.recvSeq > s.mux.window {
+		s.mu.Unlock()
+		s.Close()
+		return
+	}
+	atomic.AddUint64(&s.bytesIn, uint64(len(data)))
+
+	if seq != s.recvSeq {
+		if s.pending == nil {
+			s.pending = make(map[uint32][]byte)
+		}
+		s.pending[seq] = data
+		s.pendingSize += len(data)
+		s.mu.Unlock()
+		return
+	}
+
+	s.buf = append(s.buf, data...)
+	s.recvSeq++
+	for {
+		next, ok := s.pending[s.recvSeq]
+		if !ok {
+			break
+		}
+		delete(s.pending, s.recvSeq)
+		s.pendingSize -= len(next)
+		s.buf = append(s.buf, next...)
+		s.recvSeq++
+	}
+	if s.finReceived && s.recvSeq == s.finSeq {
+		s.readClosed = true
+	}
+	done := s.readClosed && s.writeClosed
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	if done {
+		s.mux.remove(s.id)
+	}
+}
+
+// grant افزایش اعتبار ارسال؛ اولین اعتبار در سمت کلاینت تایید باز شدن جریان است
+func (s *Stream) grant(increment uint32) {
+	s.mu.Lock()
+	s.credit += increment
+	if !s.established {
+		s.established = true
+		close(s.opened)
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+// remoteFin پایان ارسال از طرف مقابل پس از seq پیام داده
+func (s *Stream) remoteFin(seq uint32) {
+	s.mu.Lock()
+	s.finSeq = seq
+	s.finReceived = true
+	if s.recvSeq == seq {
+		s.readClosed = true
+	}
+	done := s.readClosed && s.writeClosed
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	if done {
+		s.mux.remove(s.id)
+	}
+}
+
+// fail قطع جریان با خطا و بیدار کردن منتظرها
+func (s *Stream) fail(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	if !s.established {
+		s.established = true
+		close(s.opened)
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+// Relay جابه‌جایی داده بین جریان و یک اتصال محلی تا بسته شدن هر دو جهت
+func Relay(s *Stream, conn net.Conn) {
+	done := make(chan struct{})
+
+	// جریان ← اتصال محلی
+	go func() {
+		defer close(done)
+		if _, err := io.Copy(conn, s); err != nil {
+			s.Close()
+			conn.Close()
+			return
+		}
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			conn.Close()
+		}
+	}()
+
+	// اتصال محلی ← جریان
+	if _, err := io.Copy(s, conn); err != nil {
+		s.Close()
+		conn.Close()
+	} else {
+		s.CloseWrite()
+	}
+
+	<-done
+	s.Close()
+	conn.Close()
+}
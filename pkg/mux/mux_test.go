@@ -0,0 +1,277 @@
+package mux
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dns-forwarder/pkg/protocol"
+)
+
+// link تحویل پیام‌ها به Mux طرف مقابل به ترتیب ارسال، مانند یک اتصال تانل
+type link struct {
+	ch chan []byte
+}
+
+func newLink(to func() *Mux) *link {
+	l := &link{ch: make(chan []byte, 1024)}
+	go func() {
+		for data := range l.ch {
+			msg, err := protocol.Decode(data)
+			if err != nil {
+				panic(err)
+			}
+			to().Handle(msg)
+		}
+	}()
+	return l
+}
+
+func (l *link) send(msg *protocol.Message) error {
+	l.ch <- msg.Encode()
+	return nil
+}
+
+// pair ساخت کلاینت و سرور متصل؛ accept جریان‌های سرور را پردازش می‌کند
+func pair(t *testing.T, window uint32, accept AcceptFunc) (client, server *Mux) {
+	t.Helper()
+	toServer := newLink(func() *Mux { return server })
+	toClient := newLink(func() *Mux { return client })
+	client = New(toServer.send, window, nil)
+	server = New(toClient.send, window, accept)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+		close(toServer.ch)
+		close(toClient.ch)
+	})
+	return client, server
+}
+
+// echo بازگرداندن داده جریان تا پایان ارسال کلاینت
+func echo(s *Stream, addr string) {
+	if err := s.Accept(); err != nil {
+		return
+	}
+	io.Copy(s, s)
+	s.CloseWrite()
+}
+
+func TestStreamEcho(t *testing.T) {
+	// داده بیش از پنجره تا کنترل جریان و اعتباردهی دوباره آزموده شود
+	client, server := pair(t, 64*1024, echo)
+
+	s, err := client.Open("example.com:443", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Addr() != "example.com:443" {
+		t.Fatalf("Addr() = %q", s.Addr())
+	}
+
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := s.Write(data)
+		if err == nil {
+			err = s.CloseWrite()
+		}
+		errc <- err
+	}()
+
+	got, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("echoed %d bytes, want %d", len(got), len(data))
+	}
+	in, out := s.Bytes()
+	if in != uint64(len(data)) || out != uint64(len(data)) {
+		t.Fatalf("Bytes() = %d/%d", in, out)
+	}
+
+	// جریان پس از نیمه‌بسته شدن هر دو طرف از جدول حذف می‌شود
+	deadline := time.Now().Add(time.Second)
+	for client.Len()+server.Len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("streams left open: client %d, server %d", client.Len(), server.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOpenRejected(t *testing.T) {
+	client, _ := pair(t, 0, func(s *Stream, addr string) {
+		s.Reject(ReasonNotAllowed)
+	})
+
+	_, err := client.Open("10.0.0.1:22", time.Second)
+	var reset *ResetError
+	if !errors.As(err, &reset) || reset.Reason != ReasonNotAllowed {
+		t.Fatalf("got %v, want reset %q", err, ReasonNotAllowed)
+	}
+	if client.Len() != 0 {
+		t.Fatalf("rejected stream left open")
+	}
+}
+
+func TestOpenTimeout(t *testing.T) {
+	var sent []*protocol.Message
+	m := New(func(msg *protocol.Message) error {
+		sent = append(sent, msg)
+		return nil
+	}, 0, nil)
+
+	if _, err := m.Open("example.com:80", 10*time.Millisecond); err != ErrTimeout {
+		t.Fatalf("got %v, want ErrTimeout", err)
+	}
+	if m.Len() != 0 {
+		t.Fatal("timed out stream left open")
+	}
+	// درخواست باز کردن و سپس قطع جریان
+	if len(sent) != 2 || sent[0].Type != protocol.TypeStreamOpen || sent[1].Type != protocol.TypeStreamClose {
+		t.Fatalf("sent %d messages", len(sent))
+	}
+}
+
+func TestOpenWithoutAccept(t *testing.T) {
+	var sent []*protocol.Message
+	m := New(func(msg *protocol.Message) error {
+		sent = append(sent, msg)
+		return nil
+	}, 0, nil)
+
+	// کلاینت درخواست باز کردن جریان را نمی‌پذیرد
+	m.Handle(protocol.NewStreamOpen(1, 1024, "example.com:80"))
+	if len(sent) != 1 || sent[0].Type != protocol.TypeStreamClose {
+		t.Fatalf("got %v, want reset", sent)
+	}
+	flag, _, _, err := protocol.DecodeStreamClose(sent[0].Payload)
+	if err != nil || flag != protocol.CloseReset {
+		t.Fatalf("got flag %d, %v", flag, err)
+	}
+	if m.Len() != 0 {
+		t.Fatal("stream registered without accept")
+	}
+}
+
+// testStream جریان ثبت‌شده در Mux با پیام‌های ارسالی ثبت‌شده
+func testStream(t *testing.T, window uint32) (*Stream, *[]*protocol.Message) {
+	t.Helper()
+	var mu sync.Mutex
+	sent := new([]*protocol.Message)
+	m := New(func(msg *protocol.Message) error {
+		mu.Lock()
+		*sent = append(*sent, msg)
+		mu.Unlock()
+		return nil
+	}, window, nil)
+	s := newStream(m, 1, "example.com:80", 0)
+	m.streams[s.id] = s
+	return s, sent
+}
+
+func TestReceiveOutOfOrder(t *testing.T) {
+	s, _ := testStream(t, 1024)
+
+	// ترتیب پیام‌ها روی QUIC حفظ نمی‌شود
+	s.mux.Handle(protocol.NewStreamFin(1, 3))
+	s.mux.Handle(protocol.NewStreamData(1, 2, []byte("c")))
+	s.mux.Handle(protocol.NewStreamData(1, 0, []byte("a")))
+	s.mux.Handle(protocol.NewStreamData(1, 1, []byte("b")))
+
+	got, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "abc" {
+		t.Fatalf("got %q, want abc", got)
+	}
+}
+
+func TestReceiveOverWindow(t *testing.T) {
+	s, sent := testStream(t, 16)
+
+	s.mux.Handle(protocol.NewStreamData(1, 0, make([]byte, 10)))
+	s.mux.Handle(protocol.NewStreamData(1, 1, make([]byte, 10)))
+
+	// داده پیش از قطع هنوز خواندنی است
+	if _, err := io.ReadAll(s); err != ErrClosed {
+		t.Fatalf("got %v, want ErrClosed", err)
+	}
+	if s.mux.Len() != 0 {
+		t.Fatal("stream not removed")
+	}
+	reset := false
+	for _, msg := range *sent {
+		if msg.Type == protocol.TypeStreamClose {
+			flag, _, _, _ := protocol.DecodeStreamClose(msg.Payload)
+			reset = flag == protocol.CloseReset
+		}
+	}
+	if !reset {
+		t.Fatal("stream not reset")
+	}
+}
+
+func TestWriteCredit(t *testing.T) {
+	s, sent := testStream(t, 0)
+	s.grant(100)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Write(make([]byte, 250))
+		done <- err
+	}()
+
+	// پس از مصرف اعتبار، Write تا اعتبار بعدی منتظر می‌ماند
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("write finished without credit: %v", err)
+	default:
+	}
+	s.mux.Handle(protocol.NewStreamWindow(1, 200))
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	var sizes []int
+	for _, msg := range *sent {
+		if msg.Type == protocol.TypeStreamData {
+			seq, data, _ := protocol.DecodeStreamData(msg.Payload)
+			if int(seq) != len(sizes) {
+				t.Fatalf("seq %d, want %d", seq, len(sizes))
+			}
+			sizes = append(sizes, len(data))
+		}
+	}
+	if len(sizes) != 2 || sizes[0] != 100 || sizes[1] != 150 {
+		t.Fatalf("chunks %v, want [100 150]", sizes)
+	}
+}
+
+func TestCloseFailsStreams(t *testing.T) {
+	s, _ := testStream(t, 0)
+	s.mux.Close()
+
+	if _, err := s.Read(make([]byte, 1)); err != ErrClosed {
+		t.Fatalf("Read = %v, want ErrClosed", err)
+	}
+	if _, err := s.Write([]byte("x")); err != ErrClosed {
+		t.Fatalf("Write = %v, want ErrClosed", err)
+	}
+	if _, err := s.mux.Open("example.com:80", time.Second); err != ErrClosed {
+		t.Fatalf("Open = %v, want ErrClosed", err)
+	}
+}
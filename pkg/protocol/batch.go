@@ -0,0 +1,136 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+)
+
+// NewBatch ایجاد پیام دسته‌ای از چند پیام
+//
+// Payload: تکرار [Len(4) + پیام کدشده]
+func NewBatch(msgs []*Message) *Message {
+	size := 0
+	encoded := make([][]byte, len(msgs))
+	for i, msg := range msgs {
+		encoded[i] = msg.Encode()
+		size += 4 + len(encoded[i])
+	}
+
+	payload := make([]byte, 0, size)
+	for _, data := range encoded {
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(data)))
+		payload = append(payload, data...)
+	}
+
+	return &Message{
+		Type:      TypeBatch,
+		RequestID: 0,
+		Timestamp: time.Now().UnixNano(),
+		Payload:   payload,
+	}
+}
+
+// DecodeBatch باز کردن پیام‌های داخل یک پیام دسته‌ای
+func DecodeBatch(payload []byte) ([]*Message, error) {
+	var msgs []*Message
+
+	for len(payload) > 0 {
+		if len(payload) < 4 {
+			return nil, errors.New("batch entry truncated")
+		}
+		size := binary.BigEndian.Uint32(payload[:4])
+		if uint32(len(payload)-4) < size {
+			return nil, errors.New("batch entry incomplete")
+		}
+
+		msg, err := Decode(payload[4 : 4+size])
+		if err != nil {
+			return nil, err
+		}
+		if msg.Type == TypeBatch {
+			return nil, errors.New("nested batch")
+		}
+
+		msgs = append(msgs, msg)
+		payload = payload[4+size:]
+	}
+
+	return msgs, nil
+}
+
+// Batcher جمع کردن پیام‌ها و ارسال آنها در یک فریم
+//
+// پیام‌ها پس از delay یا رسیدن به maxBytes ارسال می‌شوند. اگر فقط یک پیام
+// در صف باشد بدون پوشش دسته‌ای ارسال می‌شود.
+type Batcher struct {
+	delay    time.Duration
+	maxBytes int
+	flush    func(*Message)
+
+	mutex   sync.Mutex
+	pending []*Message
+	size    int
+	timer   *time.Timer
+}
+
+// NewBatcher ایجاد batcher با تابع ارسال
+func NewBatcher(delay time.Duration, maxBytes int, flush func(*Message)) *Batcher {
+	return &Batcher{
+		delay:    delay,
+		maxBytes: maxBytes,
+		flush:    flush,
+	}
+}
+
+// Add افزودن پیام به صف
+func (b *Batcher) Add(msg *Message) {
+	b.mutex.Lock()
+
+	b.pending = append(b.pending, msg)
+	b.size += 4 + 17 + len(msg.Payload)
+
+	if b.size >= b.maxBytes {
+		msgs := b.take()
+		b.mutex.Unlock()
+		b.send(msgs)
+		return
+	}
+
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.delay, b.Flush)
+	}
+	b.mutex.Unlock()
+}
+
+// Flush ارسال فوری پیام‌های صف
+func (b *Batcher) Flush() {
+	b.mutex.Lock()
+	msgs := b.take()
+	b.mutex.Unlock()
+
+	b.send(msgs)
+}
+
+// take برداشتن صف؛ باید با قفل فراخوانی شود
+func (b *Batcher) take() []*Message {
+	msgs := b.pending
+	b.pending = nil
+	b.size = 0
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	return msgs
+}
+
+func (b *Batcher) send(msgs []*Message) {
+	switch len(msgs) {
+	case 0:
+	case 1:
+		b.flush(msgs[0])
+	default:
+		b.flush(NewBatch(msgs))
+	}
+}
@@ -0,0 +1,155 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchRoundTrip(t *testing.T) {
+	msgs := []*Message{
+		NewDNSQuery(1, []byte("first")),
+		NewDNSQuery(2, nil),
+		{Type: TypeDNSResponse, RequestID: 3, Payload: bytes.Repeat([]byte{0xEE}, 1000), Trace: []byte{9, 9}},
+	}
+	batch := NewBatch(msgs)
+	if batch.Type != TypeBatch {
+		t.Fatalf("type = %d", batch.Type)
+	}
+
+	// پیام دسته‌ای مانند هر پیام دیگر کد می‌شود
+	decoded, err := Decode(batch.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeBatch(decoded.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(msgs) {
+		t.Fatalf("got %d messages, want %d", len(got), len(msgs))
+	}
+	for i := range msgs {
+		if got[i].Type != msgs[i].Type || got[i].RequestID != msgs[i].RequestID ||
+			!bytes.Equal(got[i].Payload, msgs[i].Payload) || !bytes.Equal(got[i].Trace, msgs[i].Trace) {
+			t.Fatalf("message %d = %+v, want %+v", i, got[i], msgs[i])
+		}
+	}
+
+	if got, err := DecodeBatch(nil); err != nil || len(got) != 0 {
+		t.Fatalf("empty batch = %v, %v", got, err)
+	}
+}
+
+func TestDecodeBatchErrors(t *testing.T) {
+	entry := func(data []byte) []byte {
+		return append(binary.BigEndian.AppendUint32(nil, uint32(len(data))), data...)
+	}
+	query := NewDNSQuery(1, []byte("q")).Encode()
+
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"truncated length", []byte{0, 0}},
+		{"incomplete entry", entry(query)[:len(query)]},
+		{"invalid message", entry([]byte{1, 2, 3})},
+		{"nested batch", entry(NewBatch([]*Message{NewHeartbeat()}).Encode())},
+		{"trailing garbage", append(entry(query), 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeBatch(tt.payload); err == nil {
+				t.Fatal("want error")
+			}
+		})
+	}
+}
+
+// flushRecorder جمع‌آوری پیام‌های ارسالی Batcher
+type flushRecorder struct {
+	mu   sync.Mutex
+	sent []*Message
+	done chan struct{}
+}
+
+func newFlushRecorder() *flushRecorder {
+	return &flushRecorder{done: make(chan struct{}, 16)}
+}
+
+func (r *flushRecorder) flush(m *Message) {
+	r.mu.Lock()
+	r.sent = append(r.sent, m)
+	r.mu.Unlock()
+	r.done <- struct{}{}
+}
+
+func (r *flushRecorder) messages() []*Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Message(nil), r.sent...)
+}
+
+func TestBatcher(t *testing.T) {
+	t.Run("single message sent unwrapped", func(t *testing.T) {
+		r := newFlushRecorder()
+		b := NewBatcher(10*time.Millisecond, 1<<16, r.flush)
+		b.Add(NewDNSQuery(1, []byte("q")))
+		<-r.done
+		if sent := r.messages(); len(sent) != 1 || sent[0].Type != TypeDNSQuery {
+			t.Fatalf("got %v", sent)
+		}
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		r := newFlushRecorder()
+		b := NewBatcher(20*time.Millisecond, 1<<16, r.flush)
+		for i := uint32(1); i <= 3; i++ {
+			b.Add(NewDNSQuery(i, []byte("q")))
+		}
+		<-r.done
+		sent := r.messages()
+		if len(sent) != 1 || sent[0].Type != TypeBatch {
+			t.Fatalf("got %v", sent)
+		}
+		msgs, err := DecodeBatch(sent[0].Payload)
+		if err != nil || len(msgs) != 3 || msgs[2].RequestID != 3 {
+			t.Fatalf("got %v, %v", msgs, err)
+		}
+	})
+
+	t.Run("max bytes", func(t *testing.T) {
+		r := newFlushRecorder()
+		// هر پیام ۴+۱۷+۱۰ بایت حساب می‌شود؛ پیام دوم از سقف می‌گذرد
+		b := NewBatcher(time.Hour, 60, r.flush)
+		b.Add(NewDNSQuery(1, make([]byte, 10)))
+		if len(r.messages()) != 0 {
+			t.Fatal("flushed before max bytes")
+		}
+		b.Add(NewDNSQuery(2, make([]byte, 10)))
+		if sent := r.messages(); len(sent) != 1 || sent[0].Type != TypeBatch {
+			t.Fatalf("got %v", sent)
+		}
+		// صف خالی و زمان‌سنج متوقف شده است
+		b.Flush()
+		if len(r.messages()) != 1 {
+			t.Fatal("empty queue flushed")
+		}
+	})
+}
+
+func TestOptionsBatchNegotiation(t *testing.T) {
+	offer := Options{Batch: true}
+	if got := offer.Negotiate(Policy{AllowBatch: true}); !got.Batch {
+		t.Fatal("batch refused by permissive policy")
+	}
+	if got := offer.Negotiate(Policy{}); got.Batch {
+		t.Fatal("batch accepted by restrictive policy")
+	}
+	got, err := DecodeOptions(offer.Encode())
+	if err != nil || !got.Batch {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,102 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"sync"
+)
+
+// CompressionMode الگوریتم فشرده‌سازی فریم‌ها
+type CompressionMode byte
+
+const (
+	// CompressionNone بدون فشرده‌سازی
+	CompressionNone CompressionMode = 0
+	// CompressionDeflate deflate با دیکشنری مخصوص DNS
+	CompressionDeflate CompressionMode = 1
+)
+
+const (
+	// flagCompressed فشرده بودن بدنه فریم پوشش‌دار
+	flagCompressed byte = 0x01
+	// minCompressSize فریم‌های کوچک‌تر فشرده نمی‌شوند
+	minCompressSize = 64
+	// maxDecompressedSize سقف اندازه بدنه پس از باز کردن
+	maxDecompressedSize = 1 << 20
+)
+
+// dnsDictionary دیکشنری deflate شامل الگوهای پرتکرار پیام‌های DNS
+//
+// انتهای دیکشنری بیشترین وزن را دارد، پس رایج‌ترین الگوها در انتها آمده‌اند.
+var dnsDictionary = []byte(
+	"\x03cdn\x06akamai\x09akamaiedge\x0aakamaized\x09edgesuite\x0acloudfront\x09amazonaws" +
+		"\x06fastly\x0acloudflare\x05azure\x09microsoft\x05apple\x06icloud\x08facebook" +
+		"\x09instagram\x08whatsapp\x07youtube\x0agoogleapis\x05gstatic\x06google" +
+		"\x02co\x02uk\x02de\x02ru\x02ir\x02io\x03org\x03net\x03com\x00" +
+		"\x00\x05\x00\x01\x00\x00\x0e\x10" + // CNAME IN
+		"\x00\x1c\x00\x01\x00\x00\x01\x2c\x00\x10" + // AAAA IN
+		"\x00\x29\x10\x00\x00\x00\x00\x00\x00\x00" + // OPT
+		"\x81\x80\x00\x01\x00\x01\x00\x00\x00\x01" + // header پاسخ
+		"\x01\x00\x00\x01\x00\x00\x00\x00\x00\x01" + // header درخواست
+		"\x03www\x03com\x00\x00\x01\x00\x01" +
+		"\xc0\x0c\x00\x01\x00\x01\x00\x00\x01\x2c\x00\x04" + // A IN
+		"\xc0\x0c\x00\x05\x00\x01\x00\x00\x01\x2c",
+)
+
+var (
+	flateWriters = sync.Pool{
+		New: func() any {
+			w, _ := flate.NewWriterDict(nil, flate.BestCompression, dnsDictionary)
+			return w
+		},
+	}
+	flateReaders = sync.Pool{
+		New: func() any {
+			return flate.NewReaderDict(nil, dnsDictionary)
+		},
+	}
+)
+
+// compress فشرده‌سازی داده؛ اگر کوچک‌تر نشود ok برابر false است
+func compress(data []byte) ([]byte, bool) {
+	if len(data) < minCompressSize {
+		return nil, false
+	}
+
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+
+	w.Reset(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, false
+	}
+	if err := w.Close(); err != nil {
+		return nil, false
+	}
+
+	if buf.Len() >= len(data) {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// decompress باز کردن داده فشرده با سقف اندازه
+func decompress(data []byte) ([]byte, error) {
+	r := flateReaders.Get().(io.ReadCloser)
+	defer flateReaders.Put(r)
+
+	if err := r.(flate.Resetter).Reset(bytes.NewReader(data), dnsDictionary); err != nil {
+		return nil, err
+	}
+
+	out, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxDecompressedSize {
+		return nil, io.ErrShortBuffer
+	}
+	return out, nil
+}
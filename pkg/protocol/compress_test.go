@@ -0,0 +1,155 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// dnsResponse پاسخ DNS نمونه با چند رکورد
+func dnsResponse(t *testing.T) []byte {
+	t.Helper()
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.com.", dns.TypeA)
+	m.Response = true
+	for _, s := range []string{
+		"www.example.com. 300 IN CNAME www.example.com.cdn.cloudflare.net.",
+		"www.example.com.cdn.cloudflare.net. 300 IN A 104.16.1.1",
+		"www.example.com.cdn.cloudflare.net. 300 IN A 104.16.2.2",
+	} {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Answer = append(m.Answer, rr)
+	}
+	data, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	response := dnsResponse(t)
+	tests := []struct {
+		name       string
+		data       []byte
+		compressed bool
+	}{
+		{"small", []byte("short"), false},
+		{"dns response", response, true},
+		{"repetitive", bytes.Repeat([]byte("abc"), 1000), true},
+		{"random", func() []byte { b := make([]byte, 512); rand.Read(b); return b }(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, ok := compress(tt.data)
+			if ok != tt.compressed {
+				t.Fatalf("compressed = %v, want %v", ok, tt.compressed)
+			}
+			if !ok {
+				return
+			}
+			if len(out) >= len(tt.data) {
+				t.Fatalf("compressed %d bytes to %d", len(tt.data), len(out))
+			}
+			got, err := decompress(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Fatal("round trip mismatch")
+			}
+		})
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriterDict(&buf, flate.BestCompression, dnsDictionary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(make([]byte, maxDecompressedSize+1))
+	w.Close()
+
+	if _, err := decompress(buf.Bytes()); err == nil {
+		t.Fatal("oversized body accepted")
+	}
+	if _, err := decompress([]byte{0xFF, 0xFF, 0xFF}); err == nil {
+		t.Fatal("corrupt body accepted")
+	}
+}
+
+func TestWrapCompressed(t *testing.T) {
+	response := dnsResponse(t)
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"compression only", Options{Compression: CompressionDeflate}},
+		{"bucket", Options{Compression: CompressionDeflate, Padding: PaddingBucket, PaddingSize: 128}},
+		{"random", Options{Compression: CompressionDeflate, Padding: PaddingRandom, PaddingSize: 64}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCodec(tt.opts)
+			frames := c.Wrap(response)
+			if len(frames) != 1 {
+				t.Fatalf("got %d frames", len(frames))
+			}
+			if frames[0][0]&flagCompressed == 0 {
+				t.Fatal("frame not compressed")
+			}
+			got, err := Unwrap(frames[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, response) {
+				t.Fatal("round trip mismatch")
+			}
+			raw, compressed := c.CompressionRatio()
+			if raw != uint64(len(response)) || compressed >= raw {
+				t.Fatalf("ratio = %d/%d", compressed, raw)
+			}
+		})
+	}
+
+	// پیام کوچک بدون پرچم فشرده‌سازی ارسال می‌شود
+	frames := NewCodec(Options{Compression: CompressionDeflate}).Wrap([]byte("tiny"))
+	if frames[0][0]&flagCompressed != 0 {
+		t.Fatal("small message compressed")
+	}
+	if got, err := Unwrap(frames[0]); err != nil || string(got) != "tiny" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+}
+
+func TestNegotiateCompression(t *testing.T) {
+	tests := []struct {
+		name   string
+		offer  CompressionMode
+		policy Policy
+		want   CompressionMode
+	}{
+		{"allowed", CompressionDeflate, Policy{AllowCompression: true}, CompressionDeflate},
+		{"refused", CompressionDeflate, Policy{}, CompressionNone},
+		{"unknown mode", CompressionMode(9), Policy{AllowCompression: true}, CompressionNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offer := Options{Compression: tt.offer}
+			decoded, err := DecodeOptions(offer.Encode())
+			if err != nil || decoded.Compression != tt.offer {
+				t.Fatalf("decoded %+v, %v", decoded, err)
+			}
+			if got := decoded.Negotiate(tt.policy).Compression; got != tt.want {
+				t.Fatalf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
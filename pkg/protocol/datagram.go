@@ -0,0 +1,51 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// MaxDatagramSize حداکثر داده یک بسته UDP
+const MaxDatagramSize = 65507
+
+// NewDatagram ایجاد پیام بسته UDP؛ RequestID شناسه association است
+//
+// Payload: AddrLen(2) + آدرس به شکل host:port + داده. در جهت کلاینت به سرور
+// آدرس مقصد و در جهت برگشت آدرس فرستنده پاسخ است. طول دو بایتی است چون
+// دامنه SOCKS5 به تنهایی تا 255 بایت است و ":port" به آن اضافه می‌شود.
+func NewDatagram(assocID uint32, addr string, data []byte) *Message {
+	payload := make([]byte, 0, 2+len(addr)+len(data))
+	payload = binary.BigEndian.AppendUint16(payload, uint16(len(addr)))
+	payload = append(payload, addr...)
+	payload = append(payload, data...)
+
+	return &Message{
+		Type:      TypeDatagram,
+		RequestID: assocID,
+		Timestamp: time.Now().UnixNano(),
+		Payload:   payload,
+	}
+}
+
+// DecodeDatagram خواندن آدرس و داده بسته UDP
+func DecodeDatagram(payload []byte) (string, []byte, error) {
+	if len(payload) < 2 {
+		return "", nil, errors.New("datagram too short")
+	}
+	size := int(binary.BigEndian.Uint16(payload))
+	if size == 0 || len(payload) < 2+size {
+		return "", nil, errors.New("datagram address incomplete")
+	}
+	return string(payload[2 : 2+size]), payload[2+size:], nil
+}
+
+// NewDatagramClose ایجاد پیام پایان association به همراه دلیل
+func NewDatagramClose(assocID uint32, reason string) *Message {
+	return &Message{
+		Type:      TypeDatagramClose,
+		RequestID: assocID,
+		Timestamp: time.Now().UnixNano(),
+		Payload:   []byte(reason),
+	}
+}
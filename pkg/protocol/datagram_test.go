@@ -0,0 +1,60 @@
+package protocol
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDatagramRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		addr string
+		data []byte
+	}{
+		{"ipv4", "8.8.8.8:53", []byte("query")},
+		{"ipv6", "[2001:db8::1]:443", []byte{0, 1, 2}},
+		{"empty data", "1.1.1.1:53", nil},
+		// دامنه 255 بایتی SOCKS5 همراه با پورت از 255 بایت بیشتر می‌شود
+		{"long domain", strings.Repeat("a", 255) + ":65535", []byte("payload")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := NewDatagram(7, tt.addr, tt.data)
+			decoded, err := Decode(msg.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Type != TypeDatagram || decoded.RequestID != 7 {
+				t.Fatalf("got type %d id %d", decoded.Type, decoded.RequestID)
+			}
+			addr, data, err := DecodeDatagram(decoded.Payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if addr != tt.addr || !bytes.Equal(data, tt.data) {
+				t.Fatalf("got %q/%q, want %q/%q", addr, data, tt.addr, tt.data)
+			}
+		})
+	}
+}
+
+func TestDecodeDatagramInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"empty", nil},
+		{"short length", []byte{0}},
+		{"zero address", []byte{0, 0, 'x'}},
+		{"truncated address", []byte{0, 10, '1', '.', '1'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := DecodeDatagram(tt.payload); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
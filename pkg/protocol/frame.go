@@ -0,0 +1,335 @@
+package protocol
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"sync"
+	"sync/atomic"
+)
+
+// FrameMarker بیت نشان‌دهنده فریم پوشش‌دار
+//
+// نوع پیام‌های خام همیشه کمتر از 0x80 است، پس گیرنده بدون مذاکره هم
+// می‌تواند فریم خام و پوشش‌دار را از هم تشخیص دهد.
+const FrameMarker byte = 0x80
+
+// frameHeaderSize اندازه هدر فریم پوشش‌دار: Flags(1) + BodyLen(4)
+const frameHeaderSize = 5
+
+const (
+	// flagFragment فریم حامل یک قطعه از پیامی بزرگ‌تر از اندازه ثابت فریم
+	flagFragment byte = 0x02
+	// fragmentHeaderSize هدر قطعه پس از هدر فریم: FragID(4) + Index(2) + Count(2)
+	fragmentHeaderSize = 8
+	// MinFixedPaddingSize کوچک‌ترین اندازه فریم در حالت fixed
+	MinFixedPaddingSize = 64
+	// maxPartials حداکثر پیام‌های نیمه‌کاره در انتظار قطعه‌های باقی‌مانده
+	maxPartials = 64
+	// maxReassembledSize سقف اندازه پیام بازسازی‌شده از قطعه‌ها
+	maxReassembledSize = 1 << 20
+)
+
+// PaddingMode نوع padding فریم‌ها
+type PaddingMode byte
+
+const (
+	// PaddingNone بدون padding
+	PaddingNone PaddingMode = 0
+	// PaddingRandom طول تصادفی بین صفر و PaddingSize
+	PaddingRandom PaddingMode = 1
+	// PaddingBucket گرد کردن طول به مضرب PaddingSize
+	PaddingBucket PaddingMode = 2
+	// PaddingFixed همه فریم‌ها دقیقاً با طول PaddingSize؛ پیام‌های بزرگ‌تر قطعه‌قطعه می‌شوند
+	PaddingFixed PaddingMode = 3
+)
+
+// ParsePaddingMode تبدیل نام به نوع padding
+func ParsePaddingMode(name string) (PaddingMode, error) {
+	switch name {
+	case "", "none":
+		return PaddingNone, nil
+	case "random":
+		return PaddingRandom, nil
+	case "bucket":
+		return PaddingBucket, nil
+	case "fixed":
+		return PaddingFixed, nil
+	}
+	return PaddingNone, errors.New("unknown padding mode: " + name)
+}
+
+// Codec پوشش و بازکردن فریم‌ها بر اساس گزینه‌های مذاکره‌شده یک نشست
+type Codec struct {
+	opts Options
+
+	payloadBytes uint64
+	paddingBytes uint64
+
+	rawBytes        uint64
+	compressedBytes uint64
+
+	fragmentID uint32
+}
+
+// NewCodec ایجاد codec با گزینه‌های مذاکره‌شده
+func NewCodec(opts Options) *Codec {
+	return &Codec{opts: opts}
+}
+
+// Options گزینه‌های مذاکره‌شده
+func (c *Codec) Options() Options {
+	if c == nil {
+		return Options{}
+	}
+	return c.opts
+}
+
+// Wrap پوشاندن پیام کدشده با فشرده‌سازی و padding؛ بدون گزینه فعال، همان داده برگردانده می‌شود
+//
+// padding پس از فشرده‌سازی اضافه می‌شود تا طول فشرده‌شده را پنهان کند. در حالت
+// fixed پیامی که در یک فریم جا نشود به چند فریم هم‌اندازه تقسیم می‌شود.
+func (c *Codec) Wrap(data []byte) [][]byte {
+	if c == nil || !c.opts.framed() {
+		return [][]byte{data}
+	}
+
+	flags := FrameMarker
+	if c.opts.Compression == CompressionDeflate {
+		atomic.AddUint64(&c.rawBytes, uint64(len(data)))
+		if compressed, ok := compress(data); ok {
+			data = compressed
+			flags |= flagCompressed
+		}
+		atomic.AddUint64(&c.compressedBytes, uint64(len(data)))
+	}
+
+	if c.fixed() && frameHeaderSize+len(data) > int(c.opts.PaddingSize) {
+		return c.fragment(flags, data)
+	}
+
+	padLen := c.paddingFor(frameHeaderSize + len(data))
+
+	frame := make([]byte, frameHeaderSize+len(data)+padLen)
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(data)))
+	copy(frame[frameHeaderSize:], data)
+
+	atomic.AddUint64(&c.payloadBytes, uint64(len(data)))
+	atomic.AddUint64(&c.paddingBytes, uint64(frameHeaderSize+padLen))
+
+	return [][]byte{frame}
+}
+
+// fixed بررسی حالت فریم‌های هم‌اندازه
+func (c *Codec) fixed() bool {
+	return c.opts.Padding == PaddingFixed && c.opts.PaddingSize >= MinFixedPaddingSize
+}
+
+// fragment تقسیم بدنه به فریم‌هایی دقیقاً به طول PaddingSize
+//
+// پرچم فشرده‌سازی روی کل پیام است و پس از بازسازی اعمال می‌شود.
+func (c *Codec) fragment(flags byte, data []byte) [][]byte {
+	size := int(c.opts.PaddingSize)
+	chunk := size - frameHeaderSize - fragmentHeaderSize
+	count := (len(data) + chunk - 1) / chunk
+	id := atomic.AddUint32(&c.fragmentID, 1)
+
+	frames := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		part := data[i*chunk:]
+		if len(part) > chunk {
+			part = part[:chunk]
+		}
+		frame := make([]byte, size)
+		frame[0] = flags | flagFragment
+		binary.BigEndian.PutUint32(frame[1:5], uint32(len(part)))
+		binary.BigEndian.PutUint32(frame[5:9], id)
+		binary.BigEndian.PutUint16(frame[9:11], uint16(i))
+		binary.BigEndian.PutUint16(frame[11:13], uint16(count))
+		copy(frame[frameHeaderSize+fragmentHeaderSize:], part)
+		frames = append(frames, frame)
+	}
+
+	atomic.AddUint64(&c.payloadBytes, uint64(len(data)))
+	atomic.AddUint64(&c.paddingBytes, uint64(count*size-len(data)))
+
+	return frames
+}
+
+// Unwrap بازکردن فریم (و باز کردن فشرده‌سازی)؛ فریم‌های خام بدون تغییر برگردانده می‌شوند
+//
+// فریم‌های قطعه‌ای فقط با Reassembler باز می‌شوند.
+func Unwrap(frame []byte) ([]byte, error) {
+	if len(frame) == 0 {
+		return nil, errors.New("empty frame")
+	}
+	if frame[0]&FrameMarker == 0 {
+		return frame, nil
+	}
+	if frame[0]&flagFragment != 0 {
+		return nil, errors.New("fragmented frame without reassembler")
+	}
+
+	if len(frame) < frameHeaderSize {
+		return nil, errors.New("frame too short")
+	}
+
+	bodyLen := binary.BigEndian.Uint32(frame[1:5])
+	if len(frame) < frameHeaderSize+int(bodyLen) {
+		return nil, errors.New("frame body incomplete")
+	}
+
+	body := frame[frameHeaderSize : frameHeaderSize+int(bodyLen)]
+	if frame[0]&flagCompressed != 0 {
+		return decompress(body)
+	}
+	return body, nil
+}
+
+// Reassembler بازکردن فریم‌ها همراه با جمع کردن قطعه‌های حالت fixed
+//
+// برای هر اتصال یک نمونه لازم است؛ مقدار صفر آماده استفاده است. قطعه‌ها
+// می‌توانند نامرتب برسند (جریان‌های جدای QUIC).
+type Reassembler struct {
+	mu    sync.Mutex
+	parts map[uint32]*partial
+	// order ترتیب شروع پیام‌های نیمه‌کاره برای کنار گذاشتن قدیمی‌ترین
+	order []uint32
+}
+
+// partial قطعه‌های رسیده یک پیام
+type partial struct {
+	chunks   [][]byte
+	received int
+	size     int
+	flags    byte
+}
+
+// Unwrap مانند Unwrap؛ برای قطعه‌ای که پیامش هنوز کامل نشده nil بدون خطا برمی‌گرداند
+func (r *Reassembler) Unwrap(frame []byte) ([]byte, error) {
+	if len(frame) == 0 || frame[0]&FrameMarker == 0 || frame[0]&flagFragment == 0 {
+		return Unwrap(frame)
+	}
+	if len(frame) < frameHeaderSize+fragmentHeaderSize {
+		return nil, errors.New("fragment too short")
+	}
+
+	bodyLen := int(binary.BigEndian.Uint32(frame[1:5]))
+	if len(frame) < frameHeaderSize+fragmentHeaderSize+bodyLen {
+		return nil, errors.New("fragment body incomplete")
+	}
+	id := binary.BigEndian.Uint32(frame[5:9])
+	index := int(binary.BigEndian.Uint16(frame[9:11]))
+	count := int(binary.BigEndian.Uint16(frame[11:13]))
+	if count == 0 || index >= count {
+		return nil, errors.New("invalid fragment index")
+	}
+	body := frame[frameHeaderSize+fragmentHeaderSize : frameHeaderSize+fragmentHeaderSize+bodyLen]
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.parts == nil {
+		r.parts = make(map[uint32]*partial)
+	}
+	p := r.parts[id]
+	if p == nil {
+		if len(r.order) >= maxPartials {
+			delete(r.parts, r.order[0])
+			r.order = r.order[1:]
+		}
+		p = &partial{chunks: make([][]byte, count), flags: frame[0]}
+		r.parts[id] = p
+		r.order = append(r.order, id)
+	}
+	if len(p.chunks) != count {
+		r.drop(id)
+		return nil, errors.New("inconsistent fragment count")
+	}
+	if p.chunks[index] != nil {
+		return nil, nil
+	}
+	p.size += bodyLen
+	if p.size > maxReassembledSize {
+		r.drop(id)
+		return nil, errors.New("reassembled message too large")
+	}
+	p.chunks[index] = append([]byte(nil), body...)
+	p.received++
+	if p.received < count {
+		return nil, nil
+	}
+
+	r.drop(id)
+	data := make([]byte, 0, p.size)
+	for _, chunk := range p.chunks {
+		data = append(data, chunk...)
+	}
+	if p.flags&flagCompressed != 0 {
+		return decompress(data)
+	}
+	return data, nil
+}
+
+// drop حذف پیام نیمه‌کاره
+func (r *Reassembler) drop(id uint32) {
+	delete(r.parts, id)
+	for i, v := range r.order {
+		if v == id {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Overhead حجم داده مفید و حجم سربار (هدر و padding) ارسال‌شده
+func (c *Codec) Overhead() (payload, overhead uint64) {
+	if c == nil {
+		return 0, 0
+	}
+	return atomic.LoadUint64(&c.payloadBytes), atomic.LoadUint64(&c.paddingBytes)
+}
+
+// CompressionRatio حجم قبل و بعد از فشرده‌سازی
+func (c *Codec) CompressionRatio() (raw, compressed uint64) {
+	if c == nil {
+		return 0, 0
+	}
+	return atomic.LoadUint64(&c.rawBytes), atomic.LoadUint64(&c.compressedBytes)
+}
+
+// paddingFor طول padding برای فریمی با طول size
+func (c *Codec) paddingFor(size int) int {
+	step := int(c.opts.PaddingSize)
+	if step <= 0 {
+		return 0
+	}
+
+	switch c.opts.Padding {
+	case PaddingRandom:
+		return RandomInt(step + 1)
+	case PaddingFixed:
+		if size < step {
+			return step - size
+		}
+	case PaddingBucket:
+		if rem := size % step; rem != 0 {
+			return step - rem
+		}
+	}
+	return 0
+}
+
+// RandomInt عدد تصادفی امن در بازه [0, n)
+func RandomInt(n int) int {
+	if n <= 1 {
+		return 0
+	}
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0
+	}
+	return int(v.Int64())
+}
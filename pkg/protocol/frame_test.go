@@ -0,0 +1,129 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWrapFixedSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		size    int
+		message int
+	}{
+		{"small", Options{Padding: PaddingFixed, PaddingSize: 256}, 256, 40},
+		{"exact", Options{Padding: PaddingFixed, PaddingSize: 256}, 256, 256 - frameHeaderSize},
+		{"fragmented", Options{Padding: PaddingFixed, PaddingSize: 128}, 128, 1000},
+		{"compressed", Options{Padding: PaddingFixed, PaddingSize: 64, Compression: CompressionDeflate}, 64, 3000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]byte, tt.message)
+			for i := range data {
+				data[i] = byte(i * 7)
+			}
+			c := NewCodec(tt.opts)
+			frames := c.Wrap(data)
+
+			var r Reassembler
+			var got []byte
+			for i, frame := range frames {
+				if len(frame) != tt.size {
+					t.Fatalf("frame %d: len = %d, want %d", i, len(frame), tt.size)
+				}
+				out, err := r.Unwrap(frame)
+				if err != nil {
+					t.Fatalf("frame %d: %v", i, err)
+				}
+				if out != nil && i != len(frames)-1 {
+					t.Fatalf("frame %d: message complete before last fragment", i)
+				}
+				got = out
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("round trip mismatch: got %d bytes, want %d", len(got), len(data))
+			}
+		})
+	}
+}
+
+func TestReassemblerOutOfOrder(t *testing.T) {
+	c := NewCodec(Options{Padding: PaddingFixed, PaddingSize: 64})
+	a := bytes.Repeat([]byte{0xAA}, 200)
+	b := bytes.Repeat([]byte{0xBB}, 150)
+	fa, fb := c.Wrap(a), c.Wrap(b)
+
+	// قطعه‌های دو پیام به صورت معکوس و درهم
+	var frames [][]byte
+	for i := len(fa) - 1; i >= 0; i-- {
+		frames = append(frames, fa[i])
+		if i < len(fb) {
+			frames = append(frames, fb[i])
+		}
+	}
+
+	var r Reassembler
+	var got [][]byte
+	for _, frame := range frames {
+		out, err := r.Unwrap(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != nil {
+			got = append(got, out)
+		}
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d messages, want 2", len(got))
+	}
+	for _, m := range got {
+		if !bytes.Equal(m, a) && !bytes.Equal(m, b) {
+			t.Fatalf("unexpected message of %d bytes", len(m))
+		}
+	}
+}
+
+func TestUnwrapFragmentWithoutReassembler(t *testing.T) {
+	c := NewCodec(Options{Padding: PaddingFixed, PaddingSize: 64})
+	frames := c.Wrap(make([]byte, 500))
+	if _, err := Unwrap(frames[0]); err == nil {
+		t.Fatal("expected error for fragment without reassembler")
+	}
+}
+
+func TestWrapBucket(t *testing.T) {
+	c := NewCodec(Options{Padding: PaddingBucket, PaddingSize: 100})
+	frames := c.Wrap(make([]byte, 250))
+	if len(frames) != 1 || len(frames[0]) != 300 {
+		t.Fatalf("got %d frames, len %d; want 1 frame of 300", len(frames), len(frames[0]))
+	}
+	data, err := Unwrap(frames[0])
+	if err != nil || len(data) != 250 {
+		t.Fatalf("Unwrap = %d bytes, %v", len(data), err)
+	}
+}
+
+func TestNegotiateFixedMinimum(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     uint16
+		max      uint16
+		wantMode PaddingMode
+		wantSize uint16
+	}{
+		{"raised", 16, 1024, PaddingFixed, MinFixedPaddingSize},
+		{"kept", 512, 1024, PaddingFixed, 512},
+		{"clamped", 4000, 1024, PaddingFixed, 1024},
+		{"downgraded", 16, 32, PaddingBucket, 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := Options{Padding: PaddingFixed, PaddingSize: tt.size}.Negotiate(Policy{AllowPadding: true, MaxPaddingSize: tt.max})
+			if o.Padding != tt.wantMode || o.PaddingSize != tt.wantSize {
+				t.Fatalf("got %v/%d, want %v/%d", o.Padding, o.PaddingSize, tt.wantMode, tt.wantSize)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"crypto/rand"
 	"encoding/binary"
 	"errors"
 	"time"
@@ -18,6 +19,36 @@ const (
 	TypeHeartbeat MessageType = 0x03
 	// TypeHeartbeatAck تایید زنده بودن
 	TypeHeartbeatAck MessageType = 0x04
+	// TypeHello پیشنهاد گزینه‌های نشست از طرف کلاینت
+	TypeHello MessageType = 0x05
+	// TypeHelloAck گزینه‌های پذیرفته‌شده از طرف سرور
+	TypeHelloAck MessageType = 0x06
+	// TypeCover ترافیک پوششی که گیرنده نادیده می‌گیرد
+	TypeCover MessageType = 0x07
+	// TypeBatch چند پیام در یک فریم
+	TypeBatch MessageType = 0x08
+	// TypeStreamOpen درخواست باز کردن جریان TCP به مقصد
+	TypeStreamOpen MessageType = 0x09
+	// TypeStreamData داده یک جریان
+	TypeStreamData MessageType = 0x0A
+	// TypeStreamWindow اعتبار ارسال برای یک جریان
+	TypeStreamWindow MessageType = 0x0B
+	// TypeStreamClose پایان یا قطع یک جریان
+	TypeStreamClose MessageType = 0x0C
+	// TypeDatagram یک بسته UDP در یک association
+	TypeDatagram MessageType = 0x0D
+	// TypeDatagramClose پایان یک association
+	TypeDatagramClose MessageType = 0x0E
+	// TypeGoAway اعلام خاموش شدن سرور تا کلاینت فوراً به سرور دیگری برود
+	TypeGoAway MessageType = 0x0F
+	// TypeDNSDrop درخواست DNS با قاعده DROP سرور رها شد؛ کلاینت نباید پاسخ دهد
+	TypeDNSDrop MessageType = 0x10
+)
+
+// افزونه‌های اختیاری پس از Payload
+const (
+	// extTrace زمینه trace برای پیوستن span های دو طرف تانل
+	extTrace byte = 0x01
 )
 
 // Message ساختار پیام تانل
@@ -26,12 +57,18 @@ type Message struct {
 	RequestID uint32
 	Timestamp int64
 	Payload   []byte
+	// Trace زمینه trace به شکل باینری؛ خالی یعنی بدون trace
+	Trace []byte
 }
 
 // Encode تبدیل پیام به بایت
 func (m *Message) Encode() []byte {
-	// Format: Type(1) + RequestID(4) + Timestamp(8) + PayloadLen(4) + Payload
-	buf := make([]byte, 17+len(m.Payload))
+	// Format: Type(1) + RequestID(4) + Timestamp(8) + PayloadLen(4) + Payload + [Tag(1) + Len(1) + Value]...
+	size := 17 + len(m.Payload)
+	if len(m.Trace) > 0 {
+		size += 2 + len(m.Trace)
+	}
+	buf := make([]byte, 17+len(m.Payload), size)
 
 	buf[0] = byte(m.Type)
 	binary.BigEndian.PutUint32(buf[1:5], m.RequestID)
@@ -39,6 +76,12 @@ func (m *Message) Encode() []byte {
 	binary.BigEndian.PutUint32(buf[13:17], uint32(len(m.Payload)))
 	copy(buf[17:], m.Payload)
 
+	// افزونه‌ها پس از Payload می‌آیند تا گیرنده‌های قدیمی آنها را نادیده بگیرند
+	if len(m.Trace) > 0 && len(m.Trace) <= 255 {
+		buf = append(buf, extTrace, byte(len(m.Trace)))
+		buf = append(buf, m.Trace...)
+	}
+
 	return buf
 }
 
@@ -62,6 +105,16 @@ func Decode(data []byte) (*Message, error) {
 	msg.Payload = make([]byte, payloadLen)
 	copy(msg.Payload, data[17:17+payloadLen])
 
+	// افزونه‌های ناشناخته رد می‌شوند
+	ext := data[17+payloadLen:]
+	for len(ext) >= 2 && len(ext) >= 2+int(ext[1]) {
+		value := ext[2 : 2+int(ext[1])]
+		if ext[0] == extTrace {
+			msg.Trace = append([]byte(nil), value...)
+		}
+		ext = ext[2+len(value):]
+	}
+
 	return msg, nil
 }
 
@@ -85,6 +138,15 @@ func NewDNSResponse(requestID uint32, dnsPacket []byte) *Message {
 	}
 }
 
+// NewDNSDrop ایجاد پیام رها شدن درخواست DNS
+func NewDNSDrop(requestID uint32) *Message {
+	return &Message{
+		Type:      TypeDNSDrop,
+		RequestID: requestID,
+		Timestamp: time.Now().UnixNano(),
+	}
+}
+
 // NewHeartbeat ایجاد پیام heartbeat
 func NewHeartbeat() *Message {
 	return &Message{
@@ -102,3 +164,46 @@ func NewHeartbeatAck() *Message {
 		Timestamp: time.Now().UnixNano(),
 	}
 }
+
+// NewHello ایجاد پیام پیشنهاد گزینه‌ها
+func NewHello(opts Options) *Message {
+	return &Message{
+		Type:      TypeHello,
+		RequestID: 0,
+		Timestamp: time.Now().UnixNano(),
+		Payload:   opts.Encode(),
+	}
+}
+
+// NewHelloAck ایجاد پیام پذیرش گزینه‌ها
+func NewHelloAck(opts Options) *Message {
+	return &Message{
+		Type:      TypeHelloAck,
+		RequestID: 0,
+		Timestamp: time.Now().UnixNano(),
+		Payload:   opts.Encode(),
+	}
+}
+
+// NewGoAway ایجاد پیام خاموش شدن به همراه دلیل
+func NewGoAway(reason string) *Message {
+	return &Message{
+		Type:      TypeGoAway,
+		RequestID: 0,
+		Timestamp: time.Now().UnixNano(),
+		Payload:   []byte(reason),
+	}
+}
+
+// NewCover ایجاد پیام پوششی با محتوای تصادفی
+func NewCover(size int) *Message {
+	payload := make([]byte, size)
+	rand.Read(payload)
+
+	return &Message{
+		Type:      TypeCover,
+		RequestID: 0,
+		Timestamp: time.Now().UnixNano(),
+		Payload:   payload,
+	}
+}
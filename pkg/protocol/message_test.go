@@ -0,0 +1,111 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{"empty", Message{Type: TypeHeartbeat}},
+		{"payload", Message{Type: TypeDNSQuery, RequestID: 0xDEADBEEF, Timestamp: -1, Payload: []byte("query")}},
+		{"trace", Message{Type: TypeDNSQuery, RequestID: 7, Timestamp: 42, Payload: []byte("query"), Trace: bytes.Repeat([]byte{0x01}, 26)}},
+		{"trace without payload", Message{Type: TypeDNSDrop, RequestID: 7, Trace: []byte{0xAB}}},
+		{"max trace", Message{Type: TypeDNSResponse, Payload: []byte("r"), Trace: bytes.Repeat([]byte{0x02}, 255)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.msg.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Type != tt.msg.Type || got.RequestID != tt.msg.RequestID || got.Timestamp != tt.msg.Timestamp {
+				t.Fatalf("header = %d/%d/%d, want %d/%d/%d", got.Type, got.RequestID, got.Timestamp,
+					tt.msg.Type, tt.msg.RequestID, tt.msg.Timestamp)
+			}
+			if !bytes.Equal(got.Payload, tt.msg.Payload) || !bytes.Equal(got.Trace, tt.msg.Trace) {
+				t.Fatalf("got payload %x trace %x", got.Payload, got.Trace)
+			}
+		})
+	}
+}
+
+func TestEncodeTraceTooLong(t *testing.T) {
+	// زمینه بیش از ۲۵۵ بایت در افزونه جا نمی‌شود و حذف می‌شود
+	m := Message{Type: TypeDNSQuery, Payload: []byte("q"), Trace: make([]byte, 256)}
+	data := m.Encode()
+	if len(data) != 17+1 {
+		t.Fatalf("len = %d, want %d", len(data), 18)
+	}
+	got, err := Decode(data)
+	if err != nil || got.Trace != nil {
+		t.Fatalf("got trace %x, %v", got.Trace, err)
+	}
+}
+
+func TestDecodeExtensions(t *testing.T) {
+	base := (&Message{Type: TypeDNSQuery, RequestID: 1, Payload: []byte("q")}).Encode()
+	ext := func(b ...byte) []byte { return append(append([]byte{}, base...), b...) }
+
+	tests := []struct {
+		name  string
+		data  []byte
+		trace []byte
+	}{
+		{"none", base, nil},
+		{"trace", ext(extTrace, 2, 0xAA, 0xBB), []byte{0xAA, 0xBB}},
+		// افزونه ناشناخته پیش از trace رد می‌شود
+		{"unknown then trace", ext(0x7F, 3, 1, 2, 3, extTrace, 1, 0xCC), []byte{0xCC}},
+		{"unknown only", ext(0x7F, 0), nil},
+		// افزونه ناقص نادیده گرفته می‌شود
+		{"truncated value", ext(extTrace, 4, 0xAA), nil},
+		{"truncated header", ext(extTrace), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Payload, []byte("q")) || !bytes.Equal(got.Trace, tt.trace) {
+				t.Fatalf("got payload %q trace %x, want trace %x", got.Payload, got.Trace, tt.trace)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	data := (&Message{Type: TypeDNSQuery, Payload: []byte("query")}).Encode()
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short header", data[:16]},
+		{"short payload", data[:len(data)-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.data); err == nil {
+				t.Fatal("want error")
+			}
+		})
+	}
+}
+
+func TestDecodeCopiesPayload(t *testing.T) {
+	data := (&Message{Type: TypeDNSQuery, Payload: []byte("query"), Trace: []byte{1}}).Encode()
+	m, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range data {
+		data[i] = 0
+	}
+	if string(m.Payload) != "query" || m.Trace[0] != 1 {
+		t.Fatal("decoded message shares the input buffer")
+	}
+}
@@ -0,0 +1,138 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// کلیدهای گزینه‌های مذاکره (قالب TLV: Key(1) + Len(1) + Value)
+const (
+	optPadding     byte = 0x01
+	optPaddingSize byte = 0x02
+	optCover       byte = 0x03
+	optBatch       byte = 0x04
+	optCompression byte = 0x05
+)
+
+// MaxPaddingSize حداکثر اندازه padding قابل مذاکره
+const MaxPaddingSize = 4096
+
+// Options گزینه‌های قابل مذاکره یک نشست تانل
+type Options struct {
+	Padding     PaddingMode
+	PaddingSize uint16
+	// Cover ارسال ترافیک پوششی در زمان بیکاری
+	Cover bool
+	// Batch پشتیبانی از پیام‌های دسته‌ای
+	Batch bool
+	// Compression فشرده‌سازی قبل از رمزنگاری
+	Compression CompressionMode
+}
+
+// Policy محدودیت‌های طرف پذیرنده در مذاکره
+type Policy struct {
+	AllowPadding     bool
+	AllowBatch       bool
+	AllowCompression bool
+	MaxPaddingSize   uint16
+}
+
+// Empty بررسی اینکه هیچ گزینه‌ای درخواست نشده است
+func (o Options) Empty() bool {
+	return o.Padding == PaddingNone && !o.Cover && !o.Batch && o.Compression == CompressionNone
+}
+
+// framed بررسی نیاز به فریم پوشش‌دار
+func (o Options) framed() bool {
+	return (o.Padding != PaddingNone && o.PaddingSize > 0) || o.Compression != CompressionNone
+}
+
+// Encode تبدیل گزینه‌ها به بایت
+func (o Options) Encode() []byte {
+	buf := make([]byte, 0, 16)
+	buf = append(buf, optPadding, 1, byte(o.Padding))
+	buf = append(buf, optPaddingSize, 2, 0, 0)
+	binary.BigEndian.PutUint16(buf[len(buf)-2:], o.PaddingSize)
+	if o.Cover {
+		buf = append(buf, optCover, 1, 1)
+	}
+	if o.Batch {
+		buf = append(buf, optBatch, 1, 1)
+	}
+	if o.Compression != CompressionNone {
+		buf = append(buf, optCompression, 1, byte(o.Compression))
+	}
+	return buf
+}
+
+// DecodeOptions تبدیل بایت به گزینه‌ها؛ کلیدهای ناشناخته نادیده گرفته می‌شوند
+func DecodeOptions(data []byte) (Options, error) {
+	var o Options
+
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return o, errors.New("option truncated")
+		}
+		key, size := data[0], int(data[1])
+		if len(data) < 2+size {
+			return o, errors.New("option value truncated")
+		}
+		value := data[2 : 2+size]
+		data = data[2+size:]
+
+		switch key {
+		case optPadding:
+			if size == 1 {
+				o.Padding = PaddingMode(value[0])
+			}
+		case optPaddingSize:
+			if size == 2 {
+				o.PaddingSize = binary.BigEndian.Uint16(value)
+			}
+		case optCover:
+			o.Cover = size == 1 && value[0] == 1
+		case optBatch:
+			o.Batch = size == 1 && value[0] == 1
+		case optCompression:
+			if size == 1 {
+				o.Compression = CompressionMode(value[0])
+			}
+		}
+	}
+
+	return o, nil
+}
+
+// Negotiate محدود کردن گزینه‌های درخواستی به آنچه طرف مقابل مجاز می‌داند
+func (o Options) Negotiate(policy Policy) Options {
+	result := o
+	maxPaddingSize := policy.MaxPaddingSize
+
+	if !policy.AllowBatch {
+		result.Batch = false
+	}
+	if !policy.AllowCompression || o.Compression > CompressionDeflate {
+		result.Compression = CompressionNone
+	}
+	if !policy.AllowPadding || o.Padding > PaddingFixed {
+		result.Padding = PaddingNone
+		result.PaddingSize = 0
+		result.Cover = false
+	}
+	if maxPaddingSize > MaxPaddingSize {
+		maxPaddingSize = MaxPaddingSize
+	}
+	if result.PaddingSize > maxPaddingSize {
+		result.PaddingSize = maxPaddingSize
+	}
+	// فریم ثابت باید جای هدر قطعه و مقداری داده را داشته باشد
+	if result.Padding == PaddingFixed && result.PaddingSize < MinFixedPaddingSize {
+		if maxPaddingSize < MinFixedPaddingSize {
+			result.Padding = PaddingBucket
+		} else {
+			result.PaddingSize = MinFixedPaddingSize
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,135 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// MaxStreamChunk حداکثر داده در یک پیام TypeStreamData
+const MaxStreamChunk = 16 * 1024
+
+// DefaultStreamWindow پنجره دریافت پیش‌فرض هر جریان
+const DefaultStreamWindow = 256 * 1024
+
+// CloseFlag نوع بسته شدن جریان
+type CloseFlag byte
+
+const (
+	// CloseFin پایان ارسال از طرف فرستنده (نیمه‌بسته)
+	CloseFin CloseFlag = 0x00
+	// CloseReset قطع کامل جریان به همراه دلیل
+	CloseReset CloseFlag = 0x01
+)
+
+// NewStreamOpen ایجاد پیام باز کردن جریان
+//
+// Payload: Window(4) + مقصد به شکل host:port
+func NewStreamOpen(streamID uint32, window uint32, addr string) *Message {
+	payload := binary.BigEndian.AppendUint32(nil, window)
+	payload = append(payload, addr...)
+
+	return &Message{
+		Type:      TypeStreamOpen,
+		RequestID: streamID,
+		Timestamp: time.Now().UnixNano(),
+		Payload:   payload,
+	}
+}
+
+// DecodeStreamOpen خواندن پنجره و مقصد از پیام باز کردن جریان
+func DecodeStreamOpen(payload []byte) (uint32, string, error) {
+	if len(payload) < 5 {
+		return 0, "", errors.New("stream open too short")
+	}
+	return binary.BigEndian.Uint32(payload[:4]), string(payload[4:]), nil
+}
+
+// NewStreamData ایجاد پیام داده جریان
+//
+// Payload: Seq(4) + داده؛ شماره ترتیب برای انتقال‌هایی مثل QUIC است که
+// ترتیب فریم‌ها را حفظ نمی‌کنند.
+func NewStreamData(streamID uint32, seq uint32, data []byte) *Message {
+	payload := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(payload[:4], seq)
+	copy(payload[4:], data)
+
+	return &Message{
+		Type:      TypeStreamData,
+		RequestID: streamID,
+		Timestamp: time.Now().UnixNano(),
+		Payload:   payload,
+	}
+}
+
+// DecodeStreamData خواندن شماره ترتیب و داده
+func DecodeStreamData(payload []byte) (uint32, []byte, error) {
+	if len(payload) < 4 {
+		return 0, nil, errors.New("stream data too short")
+	}
+	return binary.BigEndian.Uint32(payload[:4]), payload[4:], nil
+}
+
+// NewStreamWindow ایجاد پیام افزایش اعتبار ارسال
+//
+// اولین TypeStreamWindow از طرف سرور به معنای برقراری اتصال به مقصد است.
+func NewStreamWindow(streamID uint32, increment uint32) *Message {
+	return &Message{
+		Type:      TypeStreamWindow,
+		RequestID: streamID,
+		Timestamp: time.Now().UnixNano(),
+		Payload:   binary.BigEndian.AppendUint32(nil, increment),
+	}
+}
+
+// DecodeStreamWindow خواندن مقدار افزایش اعتبار
+func DecodeStreamWindow(payload []byte) (uint32, error) {
+	if len(payload) != 4 {
+		return 0, errors.New("invalid stream window")
+	}
+	return binary.BigEndian.Uint32(payload), nil
+}
+
+// NewStreamFin ایجاد پیام پایان ارسال؛ seq تعداد پیام‌های داده ارسال‌شده است
+//
+// Payload: CloseFin(1) + Seq(4)
+func NewStreamFin(streamID uint32, seq uint32) *Message {
+	payload := binary.BigEndian.AppendUint32([]byte{byte(CloseFin)}, seq)
+
+	return &Message{
+		Type:      TypeStreamClose,
+		RequestID: streamID,
+		Timestamp: time.Now().UnixNano(),
+		Payload:   payload,
+	}
+}
+
+// NewStreamReset ایجاد پیام قطع جریان
+//
+// Payload: CloseReset(1) + دلیل
+func NewStreamReset(streamID uint32, reason string) *Message {
+	payload := append([]byte{byte(CloseReset)}, reason...)
+
+	return &Message{
+		Type:      TypeStreamClose,
+		RequestID: streamID,
+		Timestamp: time.Now().UnixNano(),
+		Payload:   payload,
+	}
+}
+
+// DecodeStreamClose خواندن نوع بسته شدن، شماره ترتیب پایان یا دلیل قطع
+func DecodeStreamClose(payload []byte) (CloseFlag, uint32, string, error) {
+	if len(payload) < 1 {
+		return 0, 0, "", errors.New("stream close too short")
+	}
+
+	flag := CloseFlag(payload[0])
+	if flag == CloseFin {
+		if len(payload) != 5 {
+			return 0, 0, "", errors.New("invalid stream fin")
+		}
+		return flag, binary.BigEndian.Uint32(payload[1:]), "", nil
+	}
+	return flag, 0, string(payload[1:]), nil
+}
@@ -0,0 +1,71 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStreamMessages(t *testing.T) {
+	t.Run("open", func(t *testing.T) {
+		m := NewStreamOpen(5, 65536, "example.com:443")
+		window, addr, err := DecodeStreamOpen(m.Payload)
+		if err != nil || m.RequestID != 5 || window != 65536 || addr != "example.com:443" {
+			t.Fatalf("got %d %q, %v", window, addr, err)
+		}
+		if _, _, err := DecodeStreamOpen(m.Payload[:4]); err == nil {
+			t.Fatal("open without address accepted")
+		}
+	})
+
+	t.Run("data", func(t *testing.T) {
+		m := NewStreamData(5, 9, []byte("payload"))
+		seq, data, err := DecodeStreamData(m.Payload)
+		if err != nil || seq != 9 || !bytes.Equal(data, []byte("payload")) {
+			t.Fatalf("got %d %q, %v", seq, data, err)
+		}
+		if seq, data, err := DecodeStreamData(NewStreamData(5, 1, nil).Payload); err != nil || seq != 1 || len(data) != 0 {
+			t.Fatalf("empty data: %d %q, %v", seq, data, err)
+		}
+		if _, _, err := DecodeStreamData([]byte{0, 0, 1}); err == nil {
+			t.Fatal("short data accepted")
+		}
+	})
+
+	t.Run("window", func(t *testing.T) {
+		increment, err := DecodeStreamWindow(NewStreamWindow(5, 1234).Payload)
+		if err != nil || increment != 1234 {
+			t.Fatalf("got %d, %v", increment, err)
+		}
+		if _, err := DecodeStreamWindow([]byte{0, 0, 0, 1, 0}); err == nil {
+			t.Fatal("long window accepted")
+		}
+	})
+}
+
+func TestDecodeStreamClose(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		flag    CloseFlag
+		seq     uint32
+		reason  string
+		wantErr bool
+	}{
+		{"fin", NewStreamFin(1, 42).Payload, CloseFin, 42, "", false},
+		{"reset", NewStreamReset(1, "not allowed").Payload, CloseReset, 0, "not allowed", false},
+		{"reset without reason", NewStreamReset(1, "").Payload, CloseReset, 0, "", false},
+		{"empty", nil, 0, 0, "", true},
+		{"short fin", []byte{byte(CloseFin), 0, 0}, 0, 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag, seq, reason, err := DecodeStreamClose(tt.payload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (flag != tt.flag || seq != tt.seq || reason != tt.reason) {
+				t.Fatalf("got %d/%d/%q", flag, seq, reason)
+			}
+		})
+	}
+}
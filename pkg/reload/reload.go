@@ -0,0 +1,112 @@
+// Package reload ابزار مشترک بارگذاری مجدد تنظیمات در حین اجرا
+//
+// تنظیمات جدید با تنظیمات قبلی فیلد به فیلد مقایسه می‌شوند و هر تغییر با
+// مسیر yaml آن (مثلاً dns.upstreams) گزارش می‌شود تا معلوم باشد کدام
+// تغییرها اعمال شدند و کدام به راه‌اندازی مجدد نیاز دارند.
+package reload
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Result نتیجه یک بارگذاری مجدد
+type Result struct {
+	// Applied تنظیمات تغییرکرده‌ای که اعمال شدند
+	Applied []string `json:"applied"`
+	// Restart تنظیمات تغییرکرده نسبت به زمان شروع که فقط با راه‌اندازی مجدد اعمال می‌شوند
+	Restart []string `json:"restart_required"`
+}
+
+// Diff مسیرهای yaml فیلدهایی که بین دو مقدار از یک نوع struct متفاوت‌اند
+//
+// struct های تو در تو پیمایش می‌شوند؛ slice ها و map ها یکجا مقایسه می‌شوند.
+func Diff(a, b any) []string {
+	var out []string
+	diff(reflect.ValueOf(a), reflect.ValueOf(b), "", &out)
+	return out
+}
+
+func diff(a, b reflect.Value, path string, out *[]string) {
+	if a.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*out = append(*out, path)
+		}
+		return
+	}
+
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, inline := fieldName(field)
+		if name == "-" {
+			continue
+		}
+		p := path
+		if !inline {
+			p = join(path, name)
+		}
+		diff(a.Field(i), b.Field(i), p, out)
+	}
+}
+
+// fieldName نام yaml فیلد و اینکه inline است یا نه
+func fieldName(field reflect.StructField) (string, bool) {
+	name, opts, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if strings.Contains(opts, "inline") {
+		return "", true
+	}
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name, false
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// Split جدا کردن مسیرهای قابل اعمال در حین اجرا از بقیه
+//
+// هر مسیر در live خودش و همه زیرمسیرهایش را پوشش می‌دهد.
+func Split(paths, live []string) (applied, restart []string) {
+	applied, restart = []string{}, []string{}
+	for _, path := range paths {
+		if covered(path, live) {
+			applied = append(applied, path)
+		} else {
+			restart = append(restart, path)
+		}
+	}
+	return applied, restart
+}
+
+// Exclude حذف مسیرهایی از live که زیر یکی از پیشوندهای disabled هستند
+//
+// برای بخش‌هایی که هنگام شروع غیرفعال بوده‌اند و تغییرشان فقط با راه‌اندازی
+// مجدد اثر دارد.
+func Exclude(live, disabled []string) []string {
+	out := make([]string, 0, len(live))
+	for _, path := range live {
+		if !covered(path, disabled) {
+			out = append(out, path)
+		}
+	}
+	return out
+}
+
+func covered(path string, live []string) bool {
+	for _, prefix := range live {
+		if path == prefix || strings.HasPrefix(path, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
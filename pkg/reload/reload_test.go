@@ -0,0 +1,114 @@
+package reload
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type Inner struct {
+	Action string        `yaml:"action"`
+	TTL    time.Duration `yaml:"ttl"`
+}
+
+type testConfig struct {
+	DNS struct {
+		Upstreams []string      `yaml:"upstreams"`
+		Timeout   time.Duration `yaml:"timeout"`
+	} `yaml:"dns"`
+	Blocklist struct {
+		Enabled bool `yaml:"enabled"`
+		Inner   `yaml:",inline"`
+		Lists   map[string]string `yaml:"lists"`
+	} `yaml:"blocklist"`
+	Log struct {
+		Level string `yaml:"level,omitempty"`
+	} `yaml:"log"`
+	Ignored  string `yaml:"-"`
+	NoTag    int
+	internal int
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *testConfig)
+		want   []string
+	}{
+		{"unchanged", func(c *testConfig) {}, nil},
+		{"slice", func(c *testConfig) { c.DNS.Upstreams = []string{"1.1.1.1:53"} }, []string{"dns.upstreams"}},
+		{"slice order", func(c *testConfig) { c.DNS.Upstreams = []string{"9.9.9.9:53", "8.8.8.8:53"} }, []string{"dns.upstreams"}},
+		{"duration", func(c *testConfig) { c.DNS.Timeout = time.Second }, []string{"dns.timeout"}},
+		// فیلدهای inline زیر مسیر struct والد گزارش می‌شوند
+		{"inline", func(c *testConfig) { c.Blocklist.Action = "refused" }, []string{"blocklist.action"}},
+		{"map", func(c *testConfig) { c.Blocklist.Lists["ads"] = "other.txt" }, []string{"blocklist.lists"}},
+		{"tag options", func(c *testConfig) { c.Log.Level = "debug" }, []string{"log.level"}},
+		{"untagged", func(c *testConfig) { c.NoTag = 1 }, []string{"notag"}},
+		{"ignored", func(c *testConfig) { c.Ignored = "x"; c.internal = 1 }, nil},
+		{
+			"several in field order",
+			func(c *testConfig) { c.Log.Level = "warn"; c.Blocklist.Enabled = true; c.DNS.Timeout = 0 },
+			[]string{"dns.timeout", "blocklist.enabled", "log.level"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := newTestConfig(), newTestConfig()
+			tt.change(&b)
+			if got := Diff(a, b); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Diff = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestConfig() testConfig {
+	var c testConfig
+	c.DNS.Upstreams = []string{"8.8.8.8:53", "9.9.9.9:53"}
+	c.DNS.Timeout = 5 * time.Second
+	c.Blocklist.Action = "nxdomain"
+	c.Blocklist.Lists = map[string]string{"ads": "ads.txt"}
+	c.Log.Level = "info"
+	return c
+}
+
+func TestSplit(t *testing.T) {
+	live := []string{"dns.upstreams", "blocklist", "log.level"}
+	tests := []struct {
+		paths   []string
+		applied []string
+		restart []string
+	}{
+		{nil, []string{}, []string{}},
+		{[]string{"dns.upstreams"}, []string{"dns.upstreams"}, []string{}},
+		// پیشوند کل زیرمسیرها را پوشش می‌دهد ولی نه نام‌های هم‌پیشوند
+		{[]string{"blocklist.action", "blocklists.x"}, []string{"blocklist.action"}, []string{"blocklists.x"}},
+		{[]string{"dns.timeout", "log.level", "log.format"}, []string{"log.level"}, []string{"dns.timeout", "log.format"}},
+		{[]string{"dns"}, []string{}, []string{"dns"}},
+	}
+	for _, tt := range tests {
+		applied, restart := Split(tt.paths, live)
+		if !reflect.DeepEqual(applied, tt.applied) || !reflect.DeepEqual(restart, tt.restart) {
+			t.Errorf("Split(%v) = %v, %v; want %v, %v", tt.paths, applied, restart, tt.applied, tt.restart)
+		}
+	}
+}
+
+func TestExclude(t *testing.T) {
+	live := []string{"cache.ttl", "cache.max_size", "routing.rules", "routing.geoip.cidrs", "log.level"}
+	tests := []struct {
+		disabled []string
+		want     []string
+	}{
+		{nil, live},
+		{[]string{"cache"}, []string{"routing.rules", "routing.geoip.cidrs", "log.level"}},
+		{[]string{"routing.geoip"}, []string{"cache.ttl", "cache.max_size", "routing.rules", "log.level"}},
+		// فقط بخش کامل حذف می‌شود، نه نام‌های هم‌پیشوند
+		{[]string{"cach", "routing"}, []string{"cache.ttl", "cache.max_size", "log.level"}},
+	}
+	for _, tt := range tests {
+		if got := Exclude(live, tt.disabled); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Exclude(%v) = %v, want %v", tt.disabled, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package rpz
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Holder سیاست فعلی با جایگزینی اتمیک و بارگذاری دوره‌ای
+//
+// تا اولین Start یا Store مقدار Load برابر nil است (RPZ غیرفعال).
+type Holder struct {
+	policy atomic.Pointer[Policy]
+	log    *slog.Logger
+	// mu ساخت و ذخیره را یکجا می‌کند تا بارگذاری دوره‌ای سیاست ساخته‌شده از
+	// تنظیمات قبلی را پس از Store تنظیمات جدید ذخیره نکند
+	mu sync.Mutex
+}
+
+// NewHolder ساخت نگهدارنده‌ای که بارگذاری‌ها را در log ثبت می‌کند
+func NewHolder(log *slog.Logger) *Holder {
+	return &Holder{log: log}
+}
+
+// Start بارگذاری zone ها و راه‌اندازی بارگذاری دوره‌ای با ReloadInterval
+func (h *Holder) Start(cfg Config) error {
+	p, err := Load(cfg)
+	if err != nil {
+		return err
+	}
+	h.Store(p)
+	if cfg.ReloadInterval > 0 {
+		go h.reloadLoop(cfg.ReloadInterval)
+	}
+	return nil
+}
+
+// Load سیاست فعلی؛ nil یعنی غیرفعال
+func (h *Holder) Load() *Policy {
+	return h.policy.Load()
+}
+
+// Store جایگزینی zone های ساخته‌شده و ثبت تعداد قواعد
+func (h *Holder) Store(p *Policy) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.store(p)
+}
+
+func (h *Holder) store(p *Policy) {
+	h.policy.Store(p)
+	for _, z := range p.Zones() {
+		h.log.Info("zone RPZ بارگذاری شد", "zone", z.Name(), "serial", z.Serial(), "rules", z.Rules(), "skipped", z.Skipped())
+	}
+}
+
+// reloadLoop خواندن دوره‌ای فایل‌های RPZ با آخرین تنظیمات
+func (h *Holder) reloadLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.mu.Lock()
+		p, err := Load(h.Load().Config())
+		if err == nil {
+			h.store(p)
+		}
+		h.mu.Unlock()
+		if err != nil {
+			h.log.Error("خطا در بارگذاری مجدد zone های RPZ", "error", err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package rpz
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// nsCacheTTL مدت نگهداری name server های یک نام (یا نبودن zone cut در آن)
+	nsCacheTTL = 5 * time.Minute
+	// nsCacheSize حداکثر نام‌های کش؛ با پر شدن کش خالی می‌شود
+	nsCacheSize = 4096
+)
+
+// nsCache کش name server های zone cut ها برای trigger های NSDNAME
+type nsCache struct {
+	mu      sync.Mutex
+	entries map[string]nsEntry
+}
+
+// nsEntry نام‌های NS یک نام؛ خالی یعنی نام zone cut نیست
+type nsEntry struct {
+	servers []string
+	expires time.Time
+}
+
+// zoneCut name server های نزدیک‌ترین zone شامل نام
+//
+// از خود نام به سمت ریشه NS پرسیده می‌شود تا اولین نامی که رکورد NS دارد
+// پیدا شود؛ ریشه پرسیده نمی‌شود. خطای exchange جستجو را متوقف می‌کند.
+func (c *nsCache) zoneCut(name string, exchange Exchange) []string {
+	for ; name != "."; name = parent(name) {
+		servers, ok := c.get(name)
+		if !ok {
+			q := new(dns.Msg)
+			q.SetQuestion(name, dns.TypeNS)
+			q.RecursionDesired = true
+			resp, err := exchange(q)
+			if err != nil || resp == nil {
+				return nil
+			}
+			if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+				// SERVFAIL و مانند آن کش نمی‌شود
+				return nil
+			}
+			for _, rr := range resp.Answer {
+				if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, name) {
+					servers = append(servers, normalize(ns.Ns))
+				}
+			}
+			c.set(name, servers)
+		}
+		if len(servers) > 0 {
+			return servers
+		}
+	}
+	return nil
+}
+
+func (c *nsCache) get(name string) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[name]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.servers, true
+}
+
+func (c *nsCache) set(name string, servers []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil || len(c.entries) >= nsCacheSize {
+		c.entries = make(map[string]nsEntry)
+	}
+	c.entries[name] = nsEntry{servers: servers, expires: time.Now().Add(nsCacheTTL)}
+}
+
+// parent نام والد؛ برای نام یک‌برچسبی ریشه
+func parent(name string) string {
+	i := strings.IndexByte(name, '.')
+	if i < 0 || i == len(name)-1 {
+		return "."
+	}
+	return name[i+1:]
+}
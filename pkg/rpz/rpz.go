@@ -0,0 +1,271 @@
+// Package rpz سیاست‌های پاسخ DNS با فایل‌های Response Policy Zone
+//
+// هر zone فهرستی از trigger ها (QNAME، Response-IP، NSDNAME و Client-IP) و
+// action آن‌هاست که با رکوردهای معمولی zone نوشته می‌شوند:
+//
+//	bad.example        CNAME .              ; NXDOMAIN
+//	*.bad.example      CNAME *.             ; NODATA
+//	ok.bad.example     CNAME rpz-passthru.  ; PASSTHRU
+//	spam.example       CNAME rpz-drop.      ; DROP
+//	portal.example     A     10.0.0.1       ; local data
+//	32.1.2.0.192.rpz-ip          CNAME .    ; Response-IP 192.0.2.1/32
+//	ns.bad.rpz-nsdname           CNAME .    ; NSDNAME
+//	24.0.2.0.192.rpz-client-ip   CNAME .    ; Client-IP 192.0.2.0/24
+//
+// zone ها به ترتیب تنظیمات بررسی می‌شوند و اولین zone منطبق تصمیم می‌گیرد؛
+// در یک zone ترتیب Client-IP، QNAME، Response-IP و NSDNAME است.
+package rpz
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Trigger نوع شرط یک قاعده
+type Trigger string
+
+const (
+	TriggerClientIP   Trigger = "client-ip"
+	TriggerQName      Trigger = "qname"
+	TriggerResponseIP Trigger = "response-ip"
+	TriggerNSDName    Trigger = "nsdname"
+)
+
+// Action کار قاعده پس از تطبیق
+type Action int
+
+const (
+	// ActionNXDomain پاسخ NXDOMAIN
+	ActionNXDomain Action = iota
+	// ActionNoData پاسخ NOERROR بدون رکورد
+	ActionNoData
+	// ActionPassthru پاسخ عادی و توقف بررسی بقیه قواعد
+	ActionPassthru
+	// ActionDrop بدون پاسخ
+	ActionDrop
+	// ActionLocal پاسخ با رکوردهای قاعده
+	ActionLocal
+)
+
+// String نام action برای لاگ و metrics
+func (a Action) String() string {
+	switch a {
+	case ActionNXDomain:
+		return "nxdomain"
+	case ActionNoData:
+		return "nodata"
+	case ActionPassthru:
+		return "passthru"
+	case ActionDrop:
+		return "drop"
+	}
+	return "local"
+}
+
+// Config تنظیمات RPZ
+type Config struct {
+	// ReloadInterval فاصله خواندن دوباره فایل‌ها (صفر = غیرفعال)
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+	Zones          []ZoneConfig  `yaml:"zones"`
+}
+
+// ZoneConfig یک فایل RPZ
+type ZoneConfig struct {
+	// Name نام zone در لاگ؛ خالی یعنی نام SOA
+	Name string `yaml:"name"`
+	File string `yaml:"file"`
+	// Origin نام zone برای فایل‌های بدون SOA یا $ORIGIN
+	Origin string `yaml:"origin"`
+}
+
+// Rule یک قاعده منطبق
+type Rule struct {
+	Zone    string
+	Trigger Trigger
+	// Name نام trigger نسبت به zone (مثلاً *.bad.example یا 24.0.2.0.192)
+	Name    string
+	Action  Action
+	records []dns.RR
+}
+
+// Policy zone های بارگذاری‌شده؛ پس از ساخت فقط خواندنی است (به جز کش NS)
+type Policy struct {
+	cfg   Config
+	zones []*Zone
+	// nsdname وجود قاعده NSDNAME در یکی از zone ها
+	nsdname bool
+	ns      nsCache
+}
+
+// Exchange ارسال درخواست کمکی (یافتن name server های دامنه) از مسیر حل فراخواننده
+type Exchange func(q *dns.Msg) (*dns.Msg, error)
+
+// Load خواندن همه zone ها
+func Load(cfg Config) (*Policy, error) {
+	p := &Policy{cfg: cfg}
+	for _, zc := range cfg.Zones {
+		z, err := LoadZone(zc)
+		if err != nil {
+			return nil, err
+		}
+		p.zones = append(p.zones, z)
+		p.nsdname = p.nsdname || z.nsdname.size() > 0
+	}
+	return p, nil
+}
+
+// Config تنظیماتی که سیاست با آن ساخته شده است (برای بارگذاری دوره‌ای)
+func (p *Policy) Config() Config {
+	return p.cfg
+}
+
+// Zones zone های بارگذاری‌شده به ترتیب اولویت
+func (p *Policy) Zones() []*Zone {
+	if p == nil {
+		return nil
+	}
+	return p.zones
+}
+
+// Query قاعده منطبق پیش از حل درخواست (Client-IP و QNAME)؛ nil اگر قاعده‌ای نباشد
+func (p *Policy) Query(client netip.Addr, qname string) *Rule {
+	if p == nil {
+		return nil
+	}
+	qname = normalize(qname)
+	for _, z := range p.zones {
+		if client.IsValid() {
+			if r := z.clientIP.match(client); r != nil {
+				return r
+			}
+		}
+		if r := z.qname.match(qname); r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// Response قاعده منطبق با پاسخ upstream (Response-IP و NSDNAME)؛ nil اگر قاعده‌ای نباشد
+//
+// NSDNAME با name server های zone cut نام درخواست بررسی می‌شود. upstream های
+// بازگشتی معمولاً NS را در پاسخ نمی‌آورند، پس اگر قاعده NSDNAME وجود داشته
+// باشد NS ها با exchange پرسیده و کش می‌شوند. exchange می‌تواند nil باشد که
+// در آن صورت فقط NS های موجود در پاسخ بررسی می‌شوند.
+func (p *Policy) Response(response *dns.Msg, exchange Exchange) *Rule {
+	if p == nil || response == nil {
+		return nil
+	}
+	var servers []string
+	if p.nsdname && exchange != nil && len(response.Question) > 0 {
+		servers = p.ns.zoneCut(dns.Fqdn(strings.ToLower(response.Question[0].Name)), exchange)
+	}
+	for _, z := range p.zones {
+		for _, rr := range response.Answer {
+			var addr netip.Addr
+			switch rr := rr.(type) {
+			case *dns.A:
+				addr, _ = netip.AddrFromSlice(rr.A.To4())
+			case *dns.AAAA:
+				addr, _ = netip.AddrFromSlice(rr.AAAA)
+			default:
+				continue
+			}
+			if r := z.responseIP.match(addr); r != nil {
+				return r
+			}
+		}
+		for _, section := range [][]dns.RR{response.Answer, response.Ns} {
+			for _, rr := range section {
+				if ns, ok := rr.(*dns.NS); ok {
+					if r := z.nsdname.match(normalize(ns.Ns)); r != nil {
+						return r
+					}
+				}
+			}
+		}
+		for _, ns := range servers {
+			if r := z.nsdname.match(ns); r != nil {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// Apply ساخت پاسخ قاعده برای درخواست
+//
+// برای PASSTHRU و DROP مقدار nil برگردانده می‌شود. پاسخ local data که فقط
+// CNAME دارد باید با CNAMETarget ادامه داده شود.
+func (r *Rule) Apply(req *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.RecursionAvailable = true
+
+	switch r.Action {
+	case ActionPassthru, ActionDrop:
+		return nil
+	case ActionNXDomain:
+		m.Rcode = dns.RcodeNameError
+		return m
+	case ActionNoData:
+		return m
+	}
+
+	if len(req.Question) == 0 {
+		return m
+	}
+	q := req.Question[0]
+	var cname dns.RR
+	for _, rr := range r.records {
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeCNAME && q.Qtype != dns.TypeCNAME {
+			cname = rr
+			continue
+		}
+		if hdr.Rrtype == q.Qtype || q.Qtype == dns.TypeANY {
+			m.Answer = append(m.Answer, withName(rr, q.Name))
+		}
+	}
+	if len(m.Answer) == 0 && cname != nil {
+		rr := withName(cname, q.Name).(*dns.CNAME)
+		// CNAME *.garden. یعنی qname.garden.
+		if strings.HasPrefix(rr.Target, "*.") {
+			rr.Target = q.Name + rr.Target[2:]
+		}
+		m.Answer = append(m.Answer, rr)
+	}
+	return m
+}
+
+// String شرح قاعده برای لاگ
+func (r *Rule) String() string {
+	return fmt.Sprintf("%s/%s:%s", r.Zone, r.Trigger, r.Name)
+}
+
+// CNAMETarget مقصد CNAME پاسخی که باید برای نوع درخواست ادامه داده شود؛ خالی اگر نیازی نباشد
+func CNAMETarget(m *dns.Msg, qtype uint16) string {
+	if m == nil || len(m.Answer) == 0 || qtype == dns.TypeCNAME || qtype == dns.TypeANY {
+		return ""
+	}
+	if cname, ok := m.Answer[len(m.Answer)-1].(*dns.CNAME); ok {
+		return cname.Target
+	}
+	return ""
+}
+
+// withName کپی رکورد با نام درخواست (برای قواعد wildcard)
+func withName(rr dns.RR, name string) dns.RR {
+	rr = dns.Copy(rr)
+	rr.Header().Name = name
+	return rr
+}
+
+// normalize حروف کوچک و حذف نقطه انتهایی
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
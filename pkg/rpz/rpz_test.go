@@ -0,0 +1,285 @@
+package rpz
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func loadTestPolicy(t *testing.T) *Policy {
+	t.Helper()
+	p, err := Load(Config{Zones: []ZoneConfig{{Name: "test", File: "testdata/policy.rpz", Origin: "rpz.local"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestParseIPTrigger(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"32.1.2.0.192", "192.0.2.1/32", false},
+		{"24.0.2.0.192", "192.0.2.0/24", false},
+		{"8.0.0.0.10", "10.0.0.0/8", false},
+		{"48.zz.db8.2001", "2001:db8::/48", false},
+		{"128.1.zz.db8.2001", "2001:db8::1/128", false},
+		{"128.1.zz", "::1/128", false},
+		{"64.zz.1.db8.2001", "2001:db8:1::/64", false},
+		{"128.8.7.6.5.4.3.2.1", "1:2:3:4:5:6:7:8/128", false},
+		{"33.1.2.0.192", "", true},
+		{"x.1.2.0.192", "", true},
+		{"24", "", true},
+		{"24.300.2.0.192", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIPTrigger(tt.name)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.want {
+				t.Fatalf("got %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCNAMEAction(t *testing.T) {
+	tests := []struct {
+		target  string
+		name    string
+		want    Action
+		special bool
+	}{
+		{".", "a.example", ActionNXDomain, true},
+		{"*.", "a.example", ActionNoData, true},
+		{"rpz-passthru.", "a.example", ActionPassthru, true},
+		{"RPZ-DROP.", "a.example", ActionDrop, true},
+		// شکل قدیمی PASSTHRU
+		{"a.example.", "a.example", ActionPassthru, true},
+		{"b.example.", "a.example", ActionLocal, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			got, special := cnameAction(tt.target, tt.name)
+			if got != tt.want || special != tt.special {
+				t.Fatalf("got %v/%v, want %v/%v", got, special, tt.want, tt.special)
+			}
+		})
+	}
+}
+
+func TestLoadZone(t *testing.T) {
+	p := loadTestPolicy(t)
+	z := p.Zones()[0]
+	if z.Name() != "test" || z.Serial() != 7 {
+		t.Fatalf("got name %q serial %d", z.Name(), z.Serial())
+	}
+	if z.Rules() != 14 || z.Skipped() != 2 {
+		t.Fatalf("got %d rules, %d skipped; want 14, 2", z.Rules(), z.Skipped())
+	}
+}
+
+func TestQuery(t *testing.T) {
+	p := loadTestPolicy(t)
+	tests := []struct {
+		client string
+		qname  string
+		name   string
+		action Action
+	}{
+		// نام دقیق بر wildcard اولویت دارد و wildcard خود نام را نمی‌گیرد
+		{"", "bad.example.", "bad.example", ActionNXDomain},
+		{"", "www.bad.example.", "*.bad.example", ActionNoData},
+		{"", "a.b.bad.example.", "*.bad.example", ActionNoData},
+		{"", "ok.bad.example.", "ok.bad.example", ActionPassthru},
+		{"", "LEGACY.bad.example.", "legacy.bad.example", ActionPassthru},
+		{"", "drop.example", "drop.example", ActionDrop},
+		{"", "portal.example.", "portal.example", ActionLocal},
+		{"", "wild.example.", "", 0},
+		{"", "tcp.example.", "", 0},
+		{"", "good.example.", "", 0},
+		// Client-IP پیش از QNAME بررسی می‌شود
+		{"192.168.100.7", "bad.example.", "24.0.100.168.192", ActionPassthru},
+		{"192.168.101.7", "bad.example.", "bad.example", ActionNXDomain},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.client+"/"+tt.qname, func(t *testing.T) {
+			var client netip.Addr
+			if tt.client != "" {
+				client = netip.MustParseAddr(tt.client)
+			}
+			rule := p.Query(client, tt.qname)
+			if tt.name == "" {
+				if rule != nil {
+					t.Fatalf("got rule %s, want none", rule)
+				}
+				return
+			}
+			if rule == nil {
+				t.Fatal("no rule matched")
+			}
+			if rule.Name != tt.name || rule.Action != tt.action {
+				t.Fatalf("got %s/%v, want %s/%v", rule.Name, rule.Action, tt.name, tt.action)
+			}
+		})
+	}
+}
+
+func answer(qname string, rrs ...string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, dns.TypeA)
+	for _, s := range rrs {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			panic(err)
+		}
+		m.Answer = append(m.Answer, rr)
+	}
+	return m
+}
+
+func TestResponseIP(t *testing.T) {
+	p := loadTestPolicy(t)
+	tests := []struct {
+		name   string
+		resp   *dns.Msg
+		rule   string
+		action Action
+	}{
+		// بلندترین prefix برنده است
+		{"host", answer("a.example.", "a.example. 60 A 192.0.2.66"), "32.66.2.0.192", ActionNXDomain},
+		{"prefix", answer("a.example.", "a.example. 60 A 192.0.2.1"), "24.0.2.0.192", ActionNoData},
+		{"ipv6", answer("a.example.", "a.example. 60 AAAA 2001:db8:0:1::5"), "48.zz.db8.2001", ActionDrop},
+		{"none", answer("a.example.", "a.example. 60 A 198.51.100.1"), "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := p.Response(tt.resp, nil)
+			if tt.rule == "" {
+				if rule != nil {
+					t.Fatalf("got rule %s, want none", rule)
+				}
+				return
+			}
+			if rule == nil || rule.Name != tt.rule || rule.Action != tt.action {
+				t.Fatalf("got %v, want %s/%v", rule, tt.rule, tt.action)
+			}
+		})
+	}
+}
+
+func TestResponseNSDName(t *testing.T) {
+	p := loadTestPolicy(t)
+
+	// zone cut ها: victim.example با ns.bad-host و other.example با ns1.evil-dns
+	servers := map[string]string{
+		"victim.example.": "ns.bad-host.",
+		"other.example.":  "ns1.evil-dns.",
+		"clean.example.":  "ns.good.",
+	}
+	var queries []string
+	exchange := func(q *dns.Msg) (*dns.Msg, error) {
+		name := q.Question[0].Name
+		queries = append(queries, name)
+		m := new(dns.Msg)
+		m.SetReply(q)
+		if ns, ok := servers[name]; ok {
+			rr, _ := dns.NewRR(name + " 3600 NS " + ns)
+			m.Answer = append(m.Answer, rr)
+		}
+		return m, nil
+	}
+
+	tests := []struct {
+		qname  string
+		rule   string
+		action Action
+	}{
+		{"www.victim.example.", "ns.bad-host", ActionNXDomain},
+		{"a.b.other.example.", "*.evil-dns", ActionNoData},
+		{"clean.example.", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.qname, func(t *testing.T) {
+			rule := p.Response(answer(tt.qname, tt.qname+" 60 A 198.51.100.1"), exchange)
+			if tt.rule == "" {
+				if rule != nil {
+					t.Fatalf("got rule %s, want none", rule)
+				}
+				return
+			}
+			if rule == nil || rule.Trigger != TriggerNSDName || rule.Name != tt.rule || rule.Action != tt.action {
+				t.Fatalf("got %v, want %s/%v", rule, tt.rule, tt.action)
+			}
+		})
+	}
+
+	// NS ها کش می‌شوند و ریشه پرسیده نمی‌شود
+	n := len(queries)
+	p.Response(answer("mail.victim.example.", "mail.victim.example. 60 A 198.51.100.1"), exchange)
+	if got := queries[n:]; len(got) != 1 || got[0] != "mail.victim.example." {
+		t.Fatalf("cached lookup sent %v", got)
+	}
+	for _, q := range queries {
+		if q == "." {
+			t.Fatal("root NS queried")
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	p := loadTestPolicy(t)
+	req := func(name string, qtype uint16) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetQuestion(name, qtype)
+		return m
+	}
+
+	t.Run("nxdomain", func(t *testing.T) {
+		m := p.Query(netip.Addr{}, "bad.example.").Apply(req("bad.example.", dns.TypeA))
+		if m.Rcode != dns.RcodeNameError || len(m.Answer) != 0 {
+			t.Fatalf("got %s", m)
+		}
+	})
+	t.Run("drop", func(t *testing.T) {
+		if m := p.Query(netip.Addr{}, "drop.example.").Apply(req("drop.example.", dns.TypeA)); m != nil {
+			t.Fatalf("got %s, want nil", m)
+		}
+	})
+	t.Run("local data", func(t *testing.T) {
+		m := p.Query(netip.Addr{}, "portal.example.").Apply(req("Portal.example.", dns.TypeAAAA))
+		if len(m.Answer) != 1 {
+			t.Fatalf("got %d answers", len(m.Answer))
+		}
+		aaaa, ok := m.Answer[0].(*dns.AAAA)
+		if !ok || aaaa.Hdr.Name != "Portal.example." || !aaaa.AAAA.Equal(net.ParseIP("2001:db8::10")) {
+			t.Fatalf("got %s", m.Answer[0])
+		}
+	})
+	t.Run("cname", func(t *testing.T) {
+		m := p.Query(netip.Addr{}, "search.example.").Apply(req("search.example.", dns.TypeA))
+		if got := CNAMETarget(m, dns.TypeA); got != "safe.search.example." {
+			t.Fatalf("CNAMETarget = %q", got)
+		}
+	})
+	t.Run("wildcard cname", func(t *testing.T) {
+		m := p.Query(netip.Addr{}, "x.wild.example.").Apply(req("x.wild.example.", dns.TypeA))
+		if got := CNAMETarget(m, dns.TypeA); got != "x.wild.example.wildcard-target.example." {
+			t.Fatalf("CNAMETarget = %q", got)
+		}
+	})
+}
@@ -0,0 +1,324 @@
+package rpz
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// پسوندهای trigger در نام رکوردها
+const (
+	suffixClientIP = ".rpz-client-ip"
+	suffixIP       = ".rpz-ip"
+	suffixNSDName  = ".rpz-nsdname"
+	suffixNSIP     = ".rpz-nsip"
+)
+
+// مقصدهای CNAME با معنای ویژه
+const (
+	targetNXDomain = "."
+	targetNoData   = "*."
+	targetPassthru = "rpz-passthru."
+	targetDrop     = "rpz-drop."
+	targetTCPOnly  = "rpz-tcp-only."
+)
+
+// Zone یک فایل RPZ بارگذاری‌شده
+type Zone struct {
+	name    string
+	origin  string
+	serial  uint32
+	rules   int
+	skipped int
+
+	qname      *nameTable
+	nsdname    *nameTable
+	clientIP   *ipTable
+	responseIP *ipTable
+}
+
+// LoadZone خواندن و تجزیه یک فایل RPZ
+func LoadZone(cfg ZoneConfig) (*Zone, error) {
+	f, err := os.Open(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	origin := ""
+	if cfg.Origin != "" {
+		origin = dns.Fqdn(strings.ToLower(cfg.Origin))
+	}
+
+	z := &Zone{
+		qname:      newNameTable(),
+		nsdname:    newNameTable(),
+		clientIP:   &ipTable{},
+		responseIP: &ipTable{},
+	}
+	// رکوردهای هم‌نام یک قاعده را می‌سازند
+	rules := make(map[string]*Rule)
+	var order []string
+
+	zp := dns.NewZoneParser(f, origin, cfg.File)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		owner := strings.ToLower(rr.Header().Name)
+		if soa, isSOA := rr.(*dns.SOA); isSOA {
+			if origin == "" {
+				origin = owner
+			}
+			if owner == origin {
+				z.serial = soa.Serial
+				continue
+			}
+		}
+		if origin == "" {
+			return nil, fmt.Errorf("%s: zone origin unknown: set origin or start the file with SOA", cfg.File)
+		}
+		if owner == origin {
+			// NS و بقیه رکوردهای apex قاعده نیستند
+			continue
+		}
+		if !strings.HasSuffix(owner, "."+origin) {
+			return nil, fmt.Errorf("%s: record %s outside zone %s", cfg.File, rr.Header().Name, origin)
+		}
+		name := strings.TrimSuffix(owner, "."+origin)
+
+		trigger := TriggerQName
+		switch {
+		case strings.HasSuffix(name, suffixClientIP):
+			trigger, name = TriggerClientIP, strings.TrimSuffix(name, suffixClientIP)
+		case strings.HasSuffix(name, suffixIP):
+			trigger, name = TriggerResponseIP, strings.TrimSuffix(name, suffixIP)
+		case strings.HasSuffix(name, suffixNSDName):
+			trigger, name = TriggerNSDName, strings.TrimSuffix(name, suffixNSDName)
+		case strings.HasSuffix(name, suffixNSIP):
+			z.skipped++
+			continue
+		}
+
+		key := string(trigger) + "/" + name
+		rule, exists := rules[key]
+		if !exists {
+			rule = &Rule{Trigger: trigger, Name: name, Action: ActionLocal}
+			rules[key] = rule
+			order = append(order, key)
+		}
+		if cname, isCNAME := rr.(*dns.CNAME); isCNAME {
+			if action, special := cnameAction(cname.Target, name); special {
+				rule.Action = action
+				continue
+			}
+			if cname.Target == targetTCPOnly {
+				z.skipped++
+				continue
+			}
+		}
+		rule.records = append(rule.records, rr)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+
+	z.origin = origin
+	z.name = cfg.Name
+	if z.name == "" {
+		z.name = strings.TrimSuffix(origin, ".")
+	}
+
+	for _, key := range order {
+		rule := rules[key]
+		if rule.Action == ActionLocal && len(rule.records) == 0 {
+			// فقط rpz-tcp-only داشت
+			continue
+		}
+		rule.Zone = z.name
+		var err error
+		switch rule.Trigger {
+		case TriggerQName:
+			z.qname.add(rule.Name, rule)
+		case TriggerNSDName:
+			z.nsdname.add(rule.Name, rule)
+		case TriggerClientIP:
+			err = z.clientIP.add(rule.Name, rule)
+		case TriggerResponseIP:
+			err = z.responseIP.add(rule.Name, rule)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", cfg.File, rule.Name, err)
+		}
+		z.rules++
+	}
+	z.clientIP.sort()
+	z.responseIP.sort()
+	return z, nil
+}
+
+// cnameAction تشخیص action از مقصد CNAME؛ special=false یعنی CNAME عادی (local data)
+func cnameAction(target, name string) (Action, bool) {
+	switch strings.ToLower(target) {
+	case targetNXDomain:
+		return ActionNXDomain, true
+	case targetNoData:
+		return ActionNoData, true
+	case targetPassthru:
+		return ActionPassthru, true
+	case targetDrop:
+		return ActionDrop, true
+	}
+	// شکل قدیمی PASSTHRU: CNAME به خود نام
+	if strings.TrimSuffix(strings.ToLower(target), ".") == name {
+		return ActionPassthru, true
+	}
+	return ActionLocal, false
+}
+
+// Name نام zone
+func (z *Zone) Name() string {
+	return z.name
+}
+
+// Serial شماره سریال SOA
+func (z *Zone) Serial() uint32 {
+	return z.serial
+}
+
+// Rules تعداد قواعد
+func (z *Zone) Rules() int {
+	return z.rules
+}
+
+// Skipped تعداد رکوردهای پشتیبانی‌نشده (rpz-nsip و rpz-tcp-only)
+func (z *Zone) Skipped() int {
+	return z.skipped
+}
+
+// nameTable قواعد نامی؛ نام دقیق و wildcard جدا نگه داشته می‌شوند
+type nameTable struct {
+	exact    map[string]*Rule
+	wildcard map[string]*Rule
+}
+
+func newNameTable() *nameTable {
+	return &nameTable{exact: make(map[string]*Rule), wildcard: make(map[string]*Rule)}
+}
+
+func (t *nameTable) add(name string, rule *Rule) {
+	if strings.HasPrefix(name, "*.") {
+		t.wildcard[name[2:]] = rule
+		return
+	}
+	t.exact[name] = rule
+}
+
+// size تعداد قواعد جدول
+func (t *nameTable) size() int {
+	return len(t.exact) + len(t.wildcard)
+}
+
+// match نام دقیق و سپس نزدیک‌ترین wildcard؛ *.example.com خود example.com را نمی‌گیرد
+func (t *nameTable) match(name string) *Rule {
+	if r, ok := t.exact[name]; ok {
+		return r
+	}
+	if len(t.wildcard) == 0 {
+		return nil
+	}
+	for i := strings.IndexByte(name, '.'); i >= 0; i = strings.IndexByte(name, '.') {
+		name = name[i+1:]
+		if r, ok := t.wildcard[name]; ok {
+			return r
+		}
+	}
+	return nil
+}
+
+// ipTable قواعد آدرسی به ترتیب طول prefix (بلندترین اول)
+type ipTable struct {
+	entries []ipEntry
+}
+
+type ipEntry struct {
+	prefix netip.Prefix
+	rule   *Rule
+}
+
+func (t *ipTable) add(name string, rule *Rule) error {
+	prefix, err := parseIPTrigger(name)
+	if err != nil {
+		return err
+	}
+	t.entries = append(t.entries, ipEntry{prefix: prefix, rule: rule})
+	return nil
+}
+
+func (t *ipTable) sort() {
+	sort.SliceStable(t.entries, func(i, j int) bool {
+		return t.entries[i].prefix.Bits() > t.entries[j].prefix.Bits()
+	})
+}
+
+// match قاعده با بلندترین prefix شامل آدرس
+func (t *ipTable) match(addr netip.Addr) *Rule {
+	addr = addr.Unmap()
+	for _, e := range t.entries {
+		if e.prefix.Contains(addr) {
+			return e.rule
+		}
+	}
+	return nil
+}
+
+// parseIPTrigger خواندن نام trigger آدرسی
+//
+// IPv4: طول prefix و سپس octet ها به ترتیب معکوس (24.0.2.0.192 = 192.0.2.0/24).
+// IPv6: طول prefix و سپس گروه‌های ۱۶ بیتی معکوس که zz جای :: است
+// (48.zz.db8.2001 = 2001:db8::/48).
+func parseIPTrigger(name string) (netip.Prefix, error) {
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return netip.Prefix{}, fmt.Errorf("invalid IP trigger")
+	}
+	bits, err := strconv.Atoi(labels[0])
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix length %q", labels[0])
+	}
+
+	parts := labels[1:]
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+
+	var text string
+	if len(parts) == 4 && !strings.Contains(name, "zz") {
+		text = strings.Join(parts, ".")
+	} else {
+		for i, p := range parts {
+			if p == "zz" {
+				parts[i] = ""
+			}
+		}
+		text = strings.Join(parts, ":")
+		if strings.HasPrefix(text, ":") {
+			text = ":" + text
+		}
+		if strings.HasSuffix(text, ":") {
+			text += ":"
+		}
+	}
+
+	addr, err := netip.ParseAddr(text)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix, nil
+}
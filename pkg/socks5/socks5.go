@@ -0,0 +1,278 @@
+// Package socks5 پیاده‌سازی سمت سرور پروتکل SOCKS5 (RFC 1928 و RFC 1929)
+package socks5
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+)
+
+// Version نسخه پروتکل
+const Version = 0x05
+
+// دستورهای SOCKS5
+const (
+	CmdConnect      byte = 0x01
+	CmdBind         byte = 0x02
+	CmdUDPAssociate byte = 0x03
+)
+
+// کدهای پاسخ SOCKS5
+const (
+	ReplySucceeded           byte = 0x00
+	ReplyGeneralFailure      byte = 0x01
+	ReplyNotAllowed          byte = 0x02
+	ReplyNetworkUnreachable  byte = 0x03
+	ReplyHostUnreachable     byte = 0x04
+	ReplyConnectionRefused   byte = 0x05
+	ReplyTTLExpired          byte = 0x06
+	ReplyCommandNotSupported byte = 0x07
+	ReplyAddressNotSupported byte = 0x08
+)
+
+// روش‌های احراز هویت
+const (
+	methodNoAuth       byte = 0x00
+	methodUserPass     byte = 0x02
+	methodNoAcceptable byte = 0xFF
+)
+
+// انواع آدرس
+const (
+	atypIPv4   byte = 0x01
+	atypDomain byte = 0x03
+	atypIPv6   byte = 0x04
+)
+
+var (
+	// ErrVersion نسخه پروتکل پشتیبانی نمی‌شود
+	ErrVersion = errors.New("socks5: unsupported version")
+	// ErrAuth احراز هویت ناموفق
+	ErrAuth = errors.New("socks5: authentication failed")
+	// ErrAddressType نوع آدرس نامعتبر
+	ErrAddressType = errors.New("socks5: unsupported address type")
+	// ErrFragmented بسته UDP قطعه‌قطعه
+	ErrFragmented = errors.New("socks5: fragmented udp packet")
+)
+
+// Request درخواست کلاینت SOCKS5
+type Request struct {
+	Command byte
+	// Addr مقصد به شکل host:port
+	Addr string
+}
+
+// Handshake مذاکره روش احراز هویت و خواندن درخواست
+//
+// اگر username خالی باشد احراز هویت لازم نیست.
+func Handshake(conn io.ReadWriter, username, password string) (*Request, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != Version {
+		return nil, ErrVersion
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return nil, err
+	}
+
+	want := methodNoAuth
+	if username != "" {
+		want = methodUserPass
+	}
+
+	offered := false
+	for _, m := range methods {
+		if m == want {
+			offered = true
+			break
+		}
+	}
+	if !offered {
+		conn.Write([]byte{Version, methodNoAcceptable})
+		return nil, ErrAuth
+	}
+	if _, err := conn.Write([]byte{Version, want}); err != nil {
+		return nil, err
+	}
+
+	if want == methodUserPass {
+		if err := authenticate(conn, username, password); err != nil {
+			return nil, err
+		}
+	}
+
+	return readRequest(conn)
+}
+
+// authenticate احراز هویت نام کاربری و رمز عبور (RFC 1929)
+func authenticate(conn io.ReadWriter, username, password string) error {
+	var version [1]byte
+	if _, err := io.ReadFull(conn, version[:]); err != nil {
+		return err
+	}
+
+	user, err := readString(conn)
+	if err != nil {
+		return err
+	}
+	pass, err := readString(conn)
+	if err != nil {
+		return err
+	}
+
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(username))
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(password))
+	if userOK&passOK != 1 {
+		conn.Write([]byte{0x01, 0x01})
+		return ErrAuth
+	}
+
+	_, err = conn.Write([]byte{0x01, 0x00})
+	return err
+}
+
+// readRequest خواندن درخواست: VER CMD RSV ATYP DST.ADDR DST.PORT
+func readRequest(r io.Reader) (*Request, error) {
+	var header [3]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != Version {
+		return nil, ErrVersion
+	}
+
+	addr, err := ReadAddr(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Request{Command: header[1], Addr: addr}, nil
+}
+
+// ReadAddr خواندن آدرس SOCKS (ATYP + ADDR + PORT) به شکل host:port
+func ReadAddr(r io.Reader) (string, error) {
+	var atyp [1]byte
+	if _, err := io.ReadFull(r, atyp[:]); err != nil {
+		return "", err
+	}
+
+	var host string
+	switch atyp[0] {
+	case atypIPv4:
+		ip := make(net.IP, net.IPv4len)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case atypIPv6:
+		ip := make(net.IP, net.IPv6len)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case atypDomain:
+		name, err := readString(r)
+		if err != nil {
+			return "", err
+		}
+		host = name
+	default:
+		return "", ErrAddressType
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// AppendAddr افزودن آدرس host:port به شکل SOCKS (ATYP + ADDR + PORT)
+func AppendAddr(b []byte, addr string) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			b = append(b, atypIPv4)
+			b = append(b, ip4...)
+		} else {
+			b = append(b, atypIPv6)
+			b = append(b, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return nil, ErrAddressType
+		}
+		b = append(b, atypDomain, byte(len(host)))
+		b = append(b, host...)
+	}
+
+	return binary.BigEndian.AppendUint16(b, uint16(port)), nil
+}
+
+// WriteReply ارسال پاسخ درخواست؛ bind آدرس محلی اعلام‌شده به کلاینت است
+func WriteReply(w io.Writer, code byte, bind string) error {
+	if bind == "" {
+		bind = "0.0.0.0:0"
+	}
+
+	reply, err := AppendAddr([]byte{Version, code, 0x00}, bind)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(reply)
+	return err
+}
+
+// readString خواندن رشته با پیشوند طول یک بایتی
+func readString(r io.Reader) (string, error) {
+	var size [1]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return "", err
+	}
+	buf := make([]byte, size[0])
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// ParseUDPHeader جدا کردن مقصد و داده یک بسته UDP کلاینت
+//
+// قالب: RSV(2) + FRAG(1) + ATYP + DST.ADDR + DST.PORT + DATA؛ بسته‌های قطعه‌قطعه پشتیبانی نمی‌شوند.
+func ParseUDPHeader(packet []byte) (string, []byte, error) {
+	if len(packet) < 4 {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	if packet[2] != 0 {
+		return "", nil, ErrFragmented
+	}
+
+	r := bytes.NewReader(packet[3:])
+	addr, err := ReadAddr(r)
+	if err != nil {
+		return "", nil, err
+	}
+	return addr, packet[len(packet)-r.Len():], nil
+}
+
+// AppendUDPHeader افزودن هدر UDP با آدرس فرستنده قبل از ارسال به کلاینت
+func AppendUDPHeader(b []byte, addr string) ([]byte, error) {
+	return AppendAddr(append(b, 0, 0, 0), addr)
+}
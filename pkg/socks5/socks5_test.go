@@ -0,0 +1,180 @@
+package socks5
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// rw اتصال آزمایشی: خواندن از in و نوشتن در out
+type rw struct {
+	in  *bytes.Reader
+	out bytes.Buffer
+}
+
+func (c *rw) Read(p []byte) (int, error)  { return c.in.Read(p) }
+func (c *rw) Write(p []byte) (int, error) { return c.out.Write(p) }
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestHandshake(t *testing.T) {
+	connect := []byte{Version, CmdConnect, 0x00, atypDomain, 11, 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm', 0x01, 0xBB}
+	auth := func(user, pass string) []byte {
+		return concat([]byte{0x01, byte(len(user))}, []byte(user), []byte{byte(len(pass))}, []byte(pass))
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		input    []byte
+		want     *Request
+		wantErr  error
+		output   []byte
+	}{
+		{
+			name:   "no auth",
+			input:  concat([]byte{Version, 1, methodNoAuth}, connect),
+			want:   &Request{Command: CmdConnect, Addr: "example.com:443"},
+			output: []byte{Version, methodNoAuth},
+		},
+		{
+			name:     "user pass",
+			username: "user",
+			input:    concat([]byte{Version, 2, methodNoAuth, methodUserPass}, auth("user", "secret"), connect),
+			want:     &Request{Command: CmdConnect, Addr: "example.com:443"},
+			output:   []byte{Version, methodUserPass, 0x01, 0x00},
+		},
+		{
+			name:     "wrong password",
+			username: "user",
+			input:    concat([]byte{Version, 1, methodUserPass}, auth("user", "wrong"), connect),
+			wantErr:  ErrAuth,
+			output:   []byte{Version, methodUserPass, 0x01, 0x01},
+		},
+		{
+			name:     "auth not offered",
+			username: "user",
+			input:    []byte{Version, 1, methodNoAuth},
+			wantErr:  ErrAuth,
+			output:   []byte{Version, methodNoAcceptable},
+		},
+		{
+			name:    "socks4",
+			input:   []byte{0x04, 1, methodNoAuth},
+			wantErr: ErrVersion,
+		},
+		{
+			name:    "bad address type",
+			input:   []byte{Version, 1, methodNoAuth, Version, CmdConnect, 0x00, 0x09},
+			wantErr: ErrAddressType,
+			output:  []byte{Version, methodNoAuth},
+		},
+		{
+			name:    "truncated",
+			input:   []byte{Version, 2, methodNoAuth},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &rw{in: bytes.NewReader(tt.input)}
+			req, err := Handshake(conn, tt.username, "secret")
+			if err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want != nil && *req != *tt.want {
+				t.Fatalf("got %+v, want %+v", req, tt.want)
+			}
+			if !bytes.Equal(conn.out.Bytes(), tt.output) {
+				t.Fatalf("wrote %x, want %x", conn.out.Bytes(), tt.output)
+			}
+		})
+	}
+}
+
+func TestAddrRoundTrip(t *testing.T) {
+	tests := []struct {
+		addr string
+		atyp byte
+		size int
+	}{
+		{"192.0.2.1:80", atypIPv4, 1 + 4 + 2},
+		{"[2001:db8::1]:443", atypIPv6, 1 + 16 + 2},
+		{"[::ffff:192.0.2.1]:53", atypIPv4, 1 + 4 + 2},
+		{"example.com:8080", atypDomain, 1 + 1 + 11 + 2},
+		{"0.0.0.0:0", atypIPv4, 1 + 4 + 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			b, err := AppendAddr(nil, tt.addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b[0] != tt.atyp || len(b) != tt.size {
+				t.Fatalf("encoded %x", b)
+			}
+			got, err := ReadAddr(bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// IPv4 داخل IPv6 به شکل IPv4 خوانده می‌شود
+			want := tt.addr
+			if want == "[::ffff:192.0.2.1]:53" {
+				want = "192.0.2.1:53"
+			}
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		})
+	}
+
+	for _, addr := range []string{"example.com", "example.com:70000", string(bytes.Repeat([]byte("a"), 256)) + ":80"} {
+		if _, err := AppendAddr(nil, addr); err == nil {
+			t.Errorf("AppendAddr(%.20q) accepted", addr)
+		}
+	}
+}
+
+func TestWriteReply(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteReply(&buf, ReplyNotAllowed, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{Version, ReplyNotAllowed, 0x00, atypIPv4, 0, 0, 0, 0, 0, 0}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got %x, want %x", buf.Bytes(), want)
+	}
+}
+
+func TestUDPHeader(t *testing.T) {
+	packet, err := AppendUDPHeader(nil, "198.51.100.7:5353")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet = append(packet, "payload"...)
+
+	addr, data, err := ParseUDPHeader(packet)
+	if err != nil || addr != "198.51.100.7:5353" || string(data) != "payload" {
+		t.Fatalf("got %q %q, %v", addr, data, err)
+	}
+
+	tests := []struct {
+		name    string
+		packet  []byte
+		wantErr error
+	}{
+		{"short", []byte{0, 0, 0}, io.ErrUnexpectedEOF},
+		{"fragmented", []byte{0, 0, 1, atypIPv4, 1, 2, 3, 4, 0, 53}, ErrFragmented},
+		{"bad address type", []byte{0, 0, 0, 0x09, 1, 2}, ErrAddressType},
+		{"truncated address", []byte{0, 0, 0, atypIPv4, 1, 2}, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParseUDPHeader(tt.packet); err != tt.wantErr {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Package tracing ردیابی OpenTelemetry و انتقال زمینه trace روی تانل
+//
+// تا وقتی Setup صدا زده نشود tracer سراسری OpenTelemetry بدون اثر است،
+// پس span ساختن در کد همیشه امن است.
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/dns-forwarder/pkg/logging"
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ContextSize اندازه زمینه trace کدشده: Version(1) + TraceID(16) + SpanID(8) + Flags(1)
+const ContextSize = 26
+
+// contextVersion نسخه قالب کدشده (همان نسخه traceparent در W3C)
+const contextVersion = 0x00
+
+var log = logging.Component("tracing")
+
+// Config تنظیمات خروجی OTLP
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint آدرس host:port گیرنده OTLP/HTTP (مثلاً collector محلی)
+	Endpoint string `yaml:"endpoint"`
+	// Insecure ارسال بدون TLS
+	Insecure bool `yaml:"insecure"`
+	// SampleRatio نسبت trace های جدید که ثبت می‌شوند؛ trace های ادامه‌دار از تصمیم والد پیروی می‌کنند
+	SampleRatio float64 `yaml:"sample_ratio"`
+	// ServiceName نام سرویس در trace ها
+	ServiceName string `yaml:"service_name"`
+}
+
+// Setup راه‌اندازی tracer سراسری با خروجی OTLP/HTTP
+//
+// تابع برگردانده‌شده span های باقی‌مانده را ارسال و خروجی را می‌بندد؛ برای
+// تنظیمات غیرفعال nil است.
+func Setup(cfg Config) (func(context.Context) error, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(2*time.Second)),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Warn("خطا در ارسال trace", "error", err)
+	}))
+
+	log.Info("tracing فعال", "endpoint", cfg.Endpoint, "sample_ratio", cfg.SampleRatio)
+	return provider.Shutdown, nil
+}
+
+// Tracer tracer یک بخش برنامه
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// Inject کد کردن زمینه trace فعلی برای ارسال روی تانل؛ nil اگر trace فعالی نباشد
+func Inject(ctx context.Context) []byte {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+
+	traceID, spanID := sc.TraceID(), sc.SpanID()
+	buf := make([]byte, 0, ContextSize)
+	buf = append(buf, contextVersion)
+	buf = append(buf, traceID[:]...)
+	buf = append(buf, spanID[:]...)
+	return append(buf, byte(sc.TraceFlags()))
+}
+
+// Extract افزودن زمینه trace دریافتی از تانل به ctx؛ داده نامعتبر نادیده گرفته می‌شود
+func Extract(ctx context.Context, data []byte) context.Context {
+	if len(data) != ContextSize || data[0] != contextVersion {
+		return ctx
+	}
+
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	copy(traceID[:], data[1:17])
+	copy(spanID[:], data[17:25])
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.TraceFlags(data[25]),
+		Remote:     true,
+	})
+	if !sc.IsValid() {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// End پایان span و ثبت خطا در صورت وجود
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// QueryAttributes ویژگی‌های span یک درخواست DNS
+func QueryAttributes(r *dns.Msg) []attribute.KeyValue {
+	if len(r.Question) == 0 {
+		return nil
+	}
+	return []attribute.KeyValue{
+		attribute.String("dns.qname", r.Question[0].Name),
+		attribute.String("dns.qtype", dns.TypeToString[r.Question[0].Qtype]),
+	}
+}
@@ -0,0 +1,544 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// pollMaxBatch حداکثر حجم فریم‌های یک درخواست یا پاسخ
+	pollMaxBatch = 256 * 1024
+	// pollBatchDelay مکث کوتاه برای جمع کردن فریم‌ها در یک درخواست
+	pollBatchDelay = 2 * time.Millisecond
+	// pollQueueSize ظرفیت صف هر جهت
+	pollQueueSize = 256
+	// pollMaxBody حداکثر حجم بدنه یک درخواست یا پاسخ؛ یک فریم تنها می‌تواند از
+	// pollMaxBatch بزرگ‌تر باشد
+	pollMaxBody = pollMaxBatch + 4 + MaxFrameSize
+	// pollMaxPending حداکثر نشست‌های شناسایی‌نشده هر IP
+	pollMaxPending = 16
+)
+
+// PollServer سرور انتقال HTTP long-polling
+//
+// هر درخواست POST شامل فریم‌های ارسالی کلاینت (با پیشوند طول) است. پارامتر s
+// شناسه نشست، w=1 درخواست انتظار (long-poll) و c=1 بستن نشست است. فریم‌های در
+// صف سرور فقط در پاسخ درخواست انتظار برگردانده می‌شوند تا ترتیب آن‌ها در سمت
+// کلاینت حفظ شود.
+//
+// نشست‌ها AuthConn هستند: نشستی که در authTimeout شناسایی نشود بسته می‌شود و
+// هر IP حداکثر pollMaxPending نشست شناسایی‌نشده دارد.
+type PollServer struct {
+	// NotFound پاسخ به درخواست‌های نامعتبر (پیش‌فرض http.NotFound)
+	NotFound http.Handler
+
+	longPoll    time.Duration
+	idleTimeout time.Duration
+	authTimeout time.Duration
+	onSession   func(Conn)
+
+	mutex    sync.Mutex
+	sessions map[string]*pollSession
+	pending  map[string]int
+}
+
+// NewPollServer ایجاد سرور long-polling؛ onSession برای هر نشست جدید در goroutine جدا اجرا می‌شود
+//
+// authTimeout مهلت شناسایی هر نشست است (صفر = بدون مهلت).
+func NewPollServer(longPoll, authTimeout time.Duration, onSession func(Conn)) *PollServer {
+	s := &PollServer{
+		longPoll:    longPoll,
+		idleTimeout: 2*longPoll + 30*time.Second,
+		authTimeout: authTimeout,
+		onSession:   onSession,
+		sessions:    make(map[string]*pollSession),
+		pending:     make(map[string]int),
+	}
+	go s.reapLoop()
+	return s
+}
+
+func (s *PollServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sid := r.URL.Query().Get("s")
+	if r.Method != http.MethodPost || len(sid) != 32 {
+		s.notFound(w, r)
+		return
+	}
+	if _, err := hex.DecodeString(sid); err != nil {
+		s.notFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if r.URL.Query().Get("c") == "1" {
+		if sess := s.lookup(sid); sess != nil {
+			sess.Close()
+		}
+		return
+	}
+
+	sess := s.session(sid, r.RemoteAddr)
+	if sess == nil {
+		s.notFound(w, r)
+		return
+	}
+	atomic.StoreInt64(&sess.lastSeen, time.Now().UnixNano())
+
+	// تحویل فریم‌های دریافتی؛ فریم ناقص یعنی بدنه بریده یا دستکاری‌شده
+	body := io.LimitReader(r.Body, pollMaxBody)
+	for {
+		frame, err := readFrame(body)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		select {
+		case sess.inbound <- frame:
+		case <-sess.done:
+		}
+	}
+
+	if r.URL.Query().Get("w") != "1" {
+		return
+	}
+
+	timer := time.NewTimer(s.longPoll)
+	defer timer.Stop()
+
+	frames, ok := sess.collect(r.Context(), timer.C)
+	if !ok {
+		http.Error(w, "gone", http.StatusGone)
+		return
+	}
+
+	var buf bytes.Buffer
+	for _, frame := range frames {
+		writeFrame(&buf, frame)
+	}
+
+	w.Write(buf.Bytes())
+}
+
+func (s *PollServer) notFound(w http.ResponseWriter, r *http.Request) {
+	if s.NotFound != nil {
+		s.NotFound.ServeHTTP(w, r)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// lookup یافتن نشست موجود
+func (s *PollServer) lookup(sid string) *pollSession {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sessions[sid]
+}
+
+// session یافتن یا ایجاد نشست؛ nil اگر IP به سقف نشست‌های شناسایی‌نشده رسیده باشد
+func (s *PollServer) session(sid, remoteAddr string) *pollSession {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if sess, ok := s.sessions[sid]; ok {
+		return sess
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	if s.pending[host] >= pollMaxPending {
+		return nil
+	}
+	s.pending[host]++
+
+	sess := &pollSession{
+		server:     s,
+		id:         sid,
+		remoteAddr: remoteAddr,
+		host:       host,
+		inbound:    make(chan []byte, pollQueueSize),
+		outbound:   make(chan []byte, pollQueueSize),
+		done:       make(chan struct{}),
+	}
+	if s.authTimeout > 0 {
+		sess.authTimer = time.AfterFunc(s.authTimeout, func() { sess.Close() })
+	}
+	s.sessions[sid] = sess
+	go s.onSession(sess)
+
+	return sess
+}
+
+// settle خارج کردن نشست از شمار نشست‌های شناسایی‌نشده IP؛ s.mutex باید گرفته شده باشد
+func (s *PollServer) settle(sess *pollSession) {
+	if sess.settled {
+		return
+	}
+	sess.settled = true
+	if s.pending[sess.host]--; s.pending[sess.host] <= 0 {
+		delete(s.pending, sess.host)
+	}
+}
+
+// reapLoop بستن نشست‌هایی که مدتی درخواستی نداشته‌اند
+func (s *PollServer) reapLoop() {
+	ticker := time.NewTicker(s.idleTimeout / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		deadline := time.Now().Add(-s.idleTimeout).UnixNano()
+		var idle []*pollSession
+
+		s.mutex.Lock()
+		for _, sess := range s.sessions {
+			if atomic.LoadInt64(&sess.lastSeen) < deadline {
+				idle = append(idle, sess)
+			}
+		}
+		s.mutex.Unlock()
+
+		for _, sess := range idle {
+			sess.Close()
+		}
+	}
+}
+
+// pollSession سمت سرور یک نشست long-polling
+type pollSession struct {
+	server     *PollServer
+	id         string
+	remoteAddr string
+	host       string
+	lastSeen   int64
+	inbound    chan []byte
+	outbound   chan []byte
+	done       chan struct{}
+	closeOnce  sync.Once
+
+	// authTimer و settled با قفل سرور محافظت می‌شوند
+	authTimer *time.Timer
+	settled   bool
+}
+
+// collect جمع‌آوری فریم‌های در صف پس از رسیدن اولین فریم یا پایان timeout
+func (sess *pollSession) collect(ctx context.Context, timeout <-chan time.Time) ([][]byte, bool) {
+	var frames [][]byte
+	size := 0
+
+	select {
+	case frame := <-sess.outbound:
+		frames = append(frames, frame)
+		size += 4 + len(frame)
+	case <-timeout:
+		return nil, true
+	case <-ctx.Done():
+		return nil, true
+	case <-sess.done:
+		return nil, false
+	}
+
+	for size < pollMaxBatch {
+		select {
+		case frame := <-sess.outbound:
+			frames = append(frames, frame)
+			size += 4 + len(frame)
+		default:
+			return frames, true
+		}
+	}
+
+	return frames, true
+}
+
+func (sess *pollSession) ReadFrame() ([]byte, error) {
+	select {
+	case frame := <-sess.inbound:
+		return frame, nil
+	case <-sess.done:
+		return nil, ErrClosed
+	}
+}
+
+func (sess *pollSession) WriteFrame(frame []byte) error {
+	select {
+	case sess.outbound <- frame:
+		return nil
+	case <-sess.done:
+		return ErrClosed
+	}
+}
+
+// Authenticated برداشتن مهلت شناسایی و خارج کردن نشست از سقف IP
+func (sess *pollSession) Authenticated() {
+	sess.server.mutex.Lock()
+	defer sess.server.mutex.Unlock()
+	if sess.authTimer != nil {
+		sess.authTimer.Stop()
+	}
+	sess.server.settle(sess)
+}
+
+func (sess *pollSession) Close() error {
+	sess.closeOnce.Do(func() {
+		close(sess.done)
+		sess.server.mutex.Lock()
+		delete(sess.server.sessions, sess.id)
+		if sess.authTimer != nil {
+			sess.authTimer.Stop()
+		}
+		sess.server.settle(sess)
+		sess.server.mutex.Unlock()
+	})
+	return nil
+}
+
+func (sess *pollSession) RemoteAddr() string {
+	return sess.remoteAddr
+}
+
+// pollClient سمت کلاینت انتقال long-polling
+type pollClient struct {
+	url        string
+	sid        string
+	httpClient *http.Client
+	header     http.Header
+
+	inbound chan []byte
+	mutex   sync.Mutex
+	queue   [][]byte
+	slots   chan struct{}
+	notify  chan struct{}
+
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// DialPoll ایجاد نشست long-polling با سرور با هدرهای اضافی اختیاری
+func DialPoll(rawURL string, tlsConfig *tls.Config, longPoll time.Duration, header http.Header) (Conn, error) {
+	if _, err := url.Parse(rawURL); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	c := &pollClient{
+		url:    rawURL,
+		sid:    hex.EncodeToString(id),
+		header: header,
+		httpClient: &http.Client{
+			Timeout:   longPoll + 15*time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, MaxIdleConnsPerHost: 4},
+		},
+		inbound: make(chan []byte, pollQueueSize),
+		slots:   make(chan struct{}, pollQueueSize),
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	// درخواست اولیه برای ساخت نشست و بررسی دسترسی
+	if err := c.exchange(context.Background(), nil, ""); err != nil {
+		return nil, err
+	}
+
+	go c.pollLoop()
+	go c.sendLoop()
+
+	return c, nil
+}
+
+// exchange ارسال فریم‌ها و دریافت فریم‌های پاسخ؛ mode پارامتر w یا c درخواست است
+func (c *pollClient) exchange(ctx context.Context, frames [][]byte, mode string) error {
+	var body bytes.Buffer
+	for _, frame := range frames {
+		writeFrame(&body, frame)
+	}
+
+	u, _ := url.Parse(c.url)
+	q := u.Query()
+	q.Set("s", c.sid)
+	if mode != "" {
+		q.Set(mode, "1")
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), &body)
+	if err != nil {
+		return err
+	}
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusGone {
+		return ErrClosed
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("poll: unexpected status %s", resp.Status)
+	}
+
+	reader := io.LimitReader(resp.Body, pollMaxBody)
+	for {
+		frame, err := readFrame(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		select {
+		case c.inbound <- frame:
+		case <-c.done:
+			return ErrClosed
+		}
+	}
+}
+
+func (c *pollClient) pollLoop() {
+	for {
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+
+		if err := c.exchange(context.Background(), nil, "w"); err != nil {
+			c.fail(err)
+			return
+		}
+	}
+}
+
+func (c *pollClient) sendLoop() {
+	for {
+		select {
+		case <-c.notify:
+		case <-c.done:
+			return
+		}
+
+		time.Sleep(pollBatchDelay)
+
+		for {
+			frames := c.take()
+			if len(frames) == 0 {
+				break
+			}
+			if err := c.exchange(context.Background(), frames, ""); err != nil {
+				c.fail(err)
+				return
+			}
+		}
+	}
+}
+
+// take برداشتن فریم‌های صف تا سقف حجم یک درخواست (با هدر طول هر فریم)
+func (c *pollClient) take() [][]byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	size := 0
+	n := 0
+	for n < len(c.queue) && (n == 0 || size+4+len(c.queue[n]) <= pollMaxBatch) {
+		size += 4 + len(c.queue[n])
+		n++
+	}
+
+	frames := c.queue[:n:n]
+	c.queue = c.queue[n:]
+	for range frames {
+		<-c.slots
+	}
+	return frames
+}
+
+func (c *pollClient) fail(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		close(c.done)
+	})
+}
+
+func (c *pollClient) ReadFrame() ([]byte, error) {
+	select {
+	case frame := <-c.inbound:
+		return frame, nil
+	case <-c.done:
+		return nil, c.err
+	}
+}
+
+// WriteFrame افزودن فریم به صف؛ با پر بودن صف تا ارسال فریم‌های قبلی منتظر می‌ماند
+func (c *pollClient) WriteFrame(frame []byte) error {
+	if len(frame) > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+
+	select {
+	case c.slots <- struct{}{}:
+	case <-c.done:
+		return ErrClosed
+	}
+
+	c.mutex.Lock()
+	c.queue = append(c.queue, frame)
+	c.mutex.Unlock()
+
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Close بستن نشست و اطلاع به سرور تا نشست آن جا هم بلافاصله بسته شود
+func (c *pollClient) Close() error {
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+	c.fail(ErrClosed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.exchange(ctx, nil, "c")
+	return nil
+}
+
+func (c *pollClient) RemoteAddr() string {
+	return c.url
+}
@@ -0,0 +1,201 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// startPoll سرور poll که فریم‌ها را برمی‌گرداند؛ اگر auth درست باشد پس از
+// اولین فریم Authenticated فراخوانی می‌شود. نشست‌های بسته‌شده در کانال
+// برگردانده می‌شوند.
+func startPoll(t *testing.T, authTimeout time.Duration, auth bool) (*httptest.Server, <-chan error) {
+	t.Helper()
+	done := make(chan error, 64)
+	server := httptest.NewServer(NewPollServer(time.Second, authTimeout, func(conn Conn) {
+		defer conn.Close()
+		for {
+			frame, err := conn.ReadFrame()
+			if err != nil {
+				done <- err
+				return
+			}
+			if auth {
+				conn.(AuthConn).Authenticated()
+			}
+			if err := conn.WriteFrame(frame); err != nil {
+				done <- err
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, done
+}
+
+func pollSID(i int) string {
+	return fmt.Sprintf("%032x", i+1)
+}
+
+func TestPollEcho(t *testing.T) {
+	server, _ := startPoll(t, time.Second, true)
+
+	conn, err := DialPoll(server.URL, nil, time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// فریم تنهای بزرگ‌تر از pollMaxBatch باید در هر دو جهت پذیرفته شود
+	frames := [][]byte{[]byte("hello"), bytes.Repeat([]byte{7}, pollMaxBatch+100), []byte("bye")}
+	for _, frame := range frames {
+		if err := conn.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range frames {
+		got, err := conn.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("got frame of %d bytes, want %d", len(got), len(want))
+		}
+	}
+
+	if err := conn.WriteFrame(make([]byte, MaxFrameSize+1)); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("oversized frame error = %v", err)
+	}
+}
+
+func TestPollAuthTimeout(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+
+	for _, auth := range []bool{false, true} {
+		t.Run(fmt.Sprint("auth=", auth), func(t *testing.T) {
+			server, done := startPoll(t, timeout, auth)
+
+			conn, err := DialPoll(server.URL, nil, time.Second, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if err := conn.WriteFrame([]byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case err := <-done:
+				if auth {
+					t.Fatalf("authenticated session closed: %v", err)
+				}
+			case <-time.After(5 * timeout):
+				if !auth {
+					t.Fatal("unauthenticated session not closed")
+				}
+			}
+		})
+	}
+}
+
+func TestPollPendingLimit(t *testing.T) {
+	server, _ := startPoll(t, time.Minute, false)
+
+	post := func(query string, body []byte) int {
+		resp, err := http.Post(server.URL+"?"+query, "application/octet-stream", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for i := 0; i < pollMaxPending; i++ {
+		if status := post("s="+pollSID(i), nil); status != http.StatusOK {
+			t.Fatalf("session %d status = %d", i, status)
+		}
+	}
+	if status := post("s="+pollSID(pollMaxPending), nil); status != http.StatusNotFound {
+		t.Fatalf("over limit status = %d, want 404", status)
+	}
+
+	// بستن یک نشست جا را برای نشست جدید آزاد می‌کند
+	if status := post("c=1&s="+pollSID(0), nil); status != http.StatusOK {
+		t.Fatalf("close status = %d", status)
+	}
+	if status := post("s="+pollSID(pollMaxPending), nil); status != http.StatusOK {
+		t.Fatalf("after close status = %d", status)
+	}
+
+	// فریم ناقص
+	if status := post("s="+pollSID(1), []byte{0, 0, 0, 9, 'x'}); status != http.StatusBadRequest {
+		t.Fatalf("short frame status = %d, want 400", status)
+	}
+}
+
+func TestPollClose(t *testing.T) {
+	server, done := startPoll(t, time.Second, true)
+
+	conn, err := DialPoll(server.URL, nil, time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteFrame([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ReadFrame(); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrClosed) {
+			t.Fatalf("server session error = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("server session not closed")
+	}
+}
+
+func TestPollClientQueueBound(t *testing.T) {
+	c := &pollClient{
+		slots:  make(chan struct{}, pollQueueSize),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	for i := 0; i < pollQueueSize; i++ {
+		if err := c.WriteFrame([]byte{1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	written := make(chan error, 1)
+	go func() { written <- c.WriteFrame([]byte{2}) }()
+	select {
+	case err := <-written:
+		t.Fatalf("write to full queue returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// برداشتن فریم‌ها جا باز می‌کند
+	if frames := c.take(); len(frames) != pollQueueSize {
+		t.Fatalf("took %d frames", len(frames))
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < pollQueueSize-1; i++ {
+		c.WriteFrame([]byte{3})
+	}
+	go func() { written <- c.WriteFrame([]byte{4}) }()
+	c.fail(ErrClosed)
+	if err := <-written; !errors.Is(err, ErrClosed) {
+		t.Fatalf("write after close = %v", err)
+	}
+}
@@ -0,0 +1,359 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	// QUICALPN پروتکل ALPN اعلام‌شده
+	//
+	// h3 اعلام نمی‌شود: سرور HTTP/3 صحبت نمی‌کند و پویشگری که درخواست HTTP/3
+	// بفرستد این تناقض را تشخیص می‌دهد.
+	QUICALPN = "dnsf/1"
+	// quicMaxStreams حداکثر stream های یک‌طرفه همزمان
+	quicMaxStreams = 1024
+	// quicRouteCheck فاصله بررسی تغییر آدرس محلی مسیر به سرور
+	quicRouteCheck = 5 * time.Second
+	// quicProbeTimeout مهلت اعتبارسنجی مسیر جدید هنگام مهاجرت
+	quicProbeTimeout = 5 * time.Second
+)
+
+// quicSessionCache کش نشست TLS برای اتصال مجدد 0-RTT بین reconnect ها
+var quicSessionCache = tls.NewLRUClientSessionCache(64)
+
+// quicConn پیاده‌سازی Conn روی QUIC
+//
+// هر فریم روی یک stream یک‌طرفه جدا ارسال می‌شود تا از دست رفتن یک بسته
+// فقط همان درخواست را معطل کند و بقیه درخواست‌ها منتظر نمانند.
+//
+// سرور تغییر آدرس کلاینت (NAT rebinding یا مهاجرت) را با اعتبارسنجی مسیر
+// می‌پذیرد. کلاینت روی سوکت UDP خودش dial می‌کند و با تغییر آدرس محلی مسیر به
+// سرور (مثلاً جابه‌جایی بین Wi-Fi و شبکه موبایل) اتصال را به سوکت جدید منتقل
+// می‌کند؛ اگر مهاجرت ناموفق باشد اتصال با keepalive یا MaxIdleTimeout بسته
+// می‌شود و اتصال مجدد با 0-RTT انجام می‌شود.
+type quicConn struct {
+	conn      *quic.Conn
+	frames    chan []byte
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	err       error
+
+	// transport سوکت فعلی کلاینت؛ در سرور nil است
+	mutex     sync.Mutex
+	transport *quic.Transport
+	retired   []*quic.Transport
+}
+
+// QUICConfig تنظیمات مشترک QUIC برای سرور و کلاینت
+func QUICConfig() *quic.Config {
+	return &quic.Config{
+		Allow0RTT:             true,
+		KeepAlivePeriod:       15 * time.Second,
+		MaxIdleTimeout:        60 * time.Second,
+		MaxIncomingUniStreams: quicMaxStreams,
+	}
+}
+
+func newQUICConn(conn *quic.Conn) *quicConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &quicConn{
+		conn:   conn,
+		frames: make(chan []byte, quicMaxStreams),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go c.acceptLoop()
+	return c
+}
+
+// DialQUIC اتصال به سرور QUIC؛ آدرس به شکل quic://host:port
+func DialQUIC(rawURL string, tlsConfig *tls.Config) (Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{QUICALPN}
+	tlsConfig.ClientSessionCache = quicSessionCache
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	tr, err := newQUICTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := tr.DialEarly(ctx, addr, tlsConfig, QUICConfig())
+	if err != nil {
+		tr.Close()
+		return nil, err
+	}
+
+	c := newQUICConn(conn)
+	c.transport = tr
+	go c.routeLoop(addr)
+	return c, nil
+}
+
+// newQUICTransport سوکت UDP جدید کلاینت روی همه آدرس‌ها
+func newQUICTransport() (*quic.Transport, error) {
+	udpConn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	return &quic.Transport{Conn: udpConn}, nil
+}
+
+// Migrate انتقال اتصال کلاینت به یک سوکت UDP جدید
+//
+// مسیر جدید پیش از جابه‌جایی اعتبارسنجی می‌شود؛ در صورت خطا اتصال روی مسیر
+// قبلی می‌ماند. سوکت قبلی تا بسته شدن اتصال باز می‌ماند تا بسته‌های در راه گم نشوند.
+func (c *quicConn) Migrate() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.transport == nil {
+		return errors.New("quic: only the client can migrate")
+	}
+
+	tr, err := newQUICTransport()
+	if err != nil {
+		return err
+	}
+	path, err := c.conn.AddPath(tr)
+	if err != nil {
+		tr.Close()
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, quicProbeTimeout)
+	defer cancel()
+	if err := path.Probe(ctx); err != nil {
+		path.Close()
+		tr.Close()
+		return err
+	}
+	if err := path.Switch(); err != nil {
+		path.Close()
+		tr.Close()
+		return err
+	}
+
+	c.retired = append(c.retired, c.transport)
+	c.transport = tr
+	return nil
+}
+
+// routeLoop مهاجرت اتصال وقتی آدرس محلی مسیر به سرور تغییر کند
+func (c *quicConn) routeLoop(remote *net.UDPAddr) {
+	ticker := time.NewTicker(quicRouteCheck)
+	defer ticker.Stop()
+
+	last := routeSource(remote)
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.ctx.Done():
+			return
+		}
+
+		source := routeSource(remote)
+		if source == nil || source.Equal(last) {
+			continue
+		}
+		if err := c.Migrate(); err != nil {
+			continue
+		}
+		last = source
+	}
+}
+
+// routeSource آدرس محلی که سیستم‌عامل برای رسیدن به remote انتخاب می‌کند
+//
+// «اتصال» UDP بسته‌ای نمی‌فرستد و فقط جدول مسیریابی را بررسی می‌کند.
+func routeSource(remote *net.UDPAddr) net.IP {
+	conn, err := net.DialUDP("udp", nil, remote)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP
+}
+
+// QUICServer شنونده QUIC سرور
+//
+// شنونده و سوکت UDP جدا نگه داشته می‌شوند تا بتوان پذیرش اتصال جدید را
+// متوقف کرد و اتصال‌های باز تا پایان کارشان روی همان سوکت بمانند.
+type QUICServer struct {
+	transport *quic.Transport
+	listener  *quic.EarlyListener
+}
+
+// ListenQUIC گوش دادن روی آدرس UDP برای اتصال‌های QUIC
+func ListenQUIC(addr string, tlsConfig *tls.Config) (*QUICServer, error) {
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{QUICALPN}
+
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	udpConn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	tr := &quic.Transport{Conn: udpConn}
+	listener, err := tr.ListenEarly(tlsConfig, QUICConfig())
+	if err != nil {
+		tr.Close()
+		return nil, err
+	}
+	return &QUICServer{transport: tr, listener: listener}, nil
+}
+
+// Addr آدرس UDP شنونده
+func (s *QUICServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Serve پذیرش اتصال‌ها و اجرای handler برای هر کدام تا Shutdown یا Close
+func (s *QUICServer) Serve(handler func(Conn)) error {
+	for {
+		conn, err := s.listener.Accept(context.Background())
+		if err != nil {
+			return err
+		}
+		go handler(newQUICConn(conn))
+	}
+}
+
+// Shutdown توقف پذیرش اتصال جدید؛ اتصال‌های باز بسته نمی‌شوند
+func (s *QUICServer) Shutdown() error {
+	return s.listener.Close()
+}
+
+// Close بستن شنونده، سوکت UDP و همه اتصال‌های باقی‌مانده
+func (s *QUICServer) Close() error {
+	s.listener.Close()
+	return s.transport.Close()
+}
+
+// acceptLoop پذیرش stream های ورودی و خواندن هر کدام به صورت مستقل
+func (c *quicConn) acceptLoop() {
+	for {
+		stream, err := c.conn.AcceptUniStream(c.ctx)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		go func() {
+			frame, err := io.ReadAll(io.LimitReader(stream, MaxFrameSize+1))
+			if err != nil {
+				return
+			}
+			if len(frame) > MaxFrameSize {
+				stream.CancelRead(0)
+				return
+			}
+			select {
+			case c.frames <- frame:
+			case <-c.ctx.Done():
+			}
+		}()
+	}
+}
+
+func (c *quicConn) fail(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		c.cancel()
+	})
+}
+
+func (c *quicConn) ReadFrame() ([]byte, error) {
+	select {
+	case frame := <-c.frames:
+		return frame, nil
+	case <-c.ctx.Done():
+		return nil, c.err
+	}
+}
+
+func (c *quicConn) WriteFrame(frame []byte) error {
+	if len(frame) > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+
+	stream, err := c.conn.OpenUniStreamSync(c.ctx)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return ErrClosed
+		}
+		return err
+	}
+
+	if _, err := stream.Write(frame); err != nil {
+		stream.CancelWrite(0)
+		return err
+	}
+	return stream.Close()
+}
+
+func (c *quicConn) Close() error {
+	c.fail(ErrClosed)
+	err := c.conn.CloseWithError(0, "")
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.transport != nil {
+		for _, tr := range c.retired {
+			tr.Close()
+		}
+		c.retired = nil
+		c.transport.Close()
+	}
+	return err
+}
+
+// WaitHandshake انتظار تا تأیید هویت کلاینت با تکمیل handshake
+func (c *quicConn) WaitHandshake() bool {
+	select {
+	case <-c.conn.HandshakeComplete():
+		return true
+	case <-c.conn.Context().Done():
+		select {
+		case <-c.conn.HandshakeComplete():
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+func (c *quicConn) RemoteAddr() string {
+	return c.conn.RemoteAddr().String()
+}
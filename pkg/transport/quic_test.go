@@ -0,0 +1,286 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// selfSignedTLS گواهی خودامضا برای 127.0.0.1
+func selfSignedTLS(t *testing.T) *tls.Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func TestQUICLoopback(t *testing.T) {
+	server, err := ListenQUIC("127.0.0.1:0", selfSignedTLS(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	handshake := make(chan bool, 1)
+	go server.Serve(func(conn Conn) {
+		defer conn.Close()
+		handshake <- conn.(EarlyConn).WaitHandshake()
+		// بازگرداندن هر فریم به فرستنده
+		for {
+			frame, err := conn.ReadFrame()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteFrame(frame); err != nil {
+				return
+			}
+		}
+	})
+
+	conn, err := DialQUIC("quic://"+server.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	const n = 64
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := conn.WriteFrame([]byte(fmt.Sprintf("frame-%03d", i))); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	got := make([]string, 0, n)
+	for len(got) < n {
+		frame, err := conn.ReadFrame()
+		if err != nil {
+			t.Fatalf("after %d frames: %v", len(got), err)
+		}
+		got = append(got, string(frame))
+	}
+	sort.Strings(got)
+	for i, frame := range got {
+		if want := fmt.Sprintf("frame-%03d", i); frame != want {
+			t.Fatalf("frame %d = %q, want %q", i, frame, want)
+		}
+	}
+
+	select {
+	case ok := <-handshake:
+		if !ok {
+			t.Fatal("handshake not confirmed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handshake timeout")
+	}
+}
+
+func TestQUICFrameTooLarge(t *testing.T) {
+	server, err := ListenQUIC("127.0.0.1:0", selfSignedTLS(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	go server.Serve(func(conn Conn) {})
+
+	conn, err := DialQUIC("quic://"+server.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteFrame(make([]byte, MaxFrameSize+1)); err != ErrFrameTooLarge {
+		t.Fatalf("WriteFrame = %v, want ErrFrameTooLarge", err)
+	}
+}
+
+// startAddrEcho سرور QUIC که در پاسخ هر فریم آدرس فعلی کلاینت را برمی‌گرداند
+func startAddrEcho(t *testing.T) *QUICServer {
+	t.Helper()
+	server, err := ListenQUIC("127.0.0.1:0", selfSignedTLS(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	go server.Serve(func(conn Conn) {
+		defer conn.Close()
+		for {
+			if _, err := conn.ReadFrame(); err != nil {
+				return
+			}
+			if err := conn.WriteFrame([]byte(conn.RemoteAddr())); err != nil {
+				return
+			}
+		}
+	})
+	return server
+}
+
+// freshTLS تنظیمات کلاینت با ServerName یکتا تا بلیت نشست سرور آزمون‌های دیگر
+// (و رد شدن 0-RTT) به کار نرود
+func freshTLS(t *testing.T) *tls.Config {
+	return &tls.Config{InsecureSkipVerify: true, ServerName: fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano())}
+}
+
+// seenAddr آدرس کلاینت از دید سرور
+func seenAddr(t *testing.T, conn Conn) string {
+	t.Helper()
+	if err := conn.WriteFrame([]byte("addr")); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := conn.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(frame)
+}
+
+func TestQUICMigrate(t *testing.T) {
+	server := startAddrEcho(t)
+
+	conn, err := DialQUIC("quic://"+server.Addr().String(), freshTLS(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	before := seenAddr(t, conn)
+	for i := 0; i < 2; i++ {
+		if err := conn.(Migrator).Migrate(); err != nil {
+			t.Fatal(err)
+		}
+		after := seenAddr(t, conn)
+		if after == before {
+			t.Fatalf("client address unchanged after migration: %s", after)
+		}
+		before = after
+	}
+}
+
+// udpRelay رله UDP که با rebind پورت خروجی خود را عوض می‌کند (مانند NAT)
+type udpRelay struct {
+	front  *net.UDPConn
+	server *net.UDPAddr
+
+	mutex  sync.Mutex
+	back   *net.UDPConn
+	client *net.UDPAddr
+}
+
+func newUDPRelay(t *testing.T, server net.Addr) *udpRelay {
+	t.Helper()
+	front, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &udpRelay{front: front, server: server.(*net.UDPAddr)}
+	r.rebind(t)
+	t.Cleanup(func() {
+		front.Close()
+		r.mutex.Lock()
+		r.back.Close()
+		r.mutex.Unlock()
+	})
+
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := front.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			r.mutex.Lock()
+			r.client = addr
+			r.back.WriteToUDP(buf[:n], r.server)
+			r.mutex.Unlock()
+		}
+	}()
+	return r
+}
+
+// rebind جایگزینی سوکت خروجی؛ سرور بسته‌ها را از پورت جدید می‌بیند
+func (r *udpRelay) rebind(t *testing.T) {
+	t.Helper()
+	back, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.mutex.Lock()
+	old := r.back
+	r.back = back
+	r.mutex.Unlock()
+	if old != nil {
+		old.Close()
+	}
+
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, err := back.Read(buf)
+			if err != nil {
+				return
+			}
+			r.mutex.Lock()
+			client := r.client
+			r.mutex.Unlock()
+			if client != nil {
+				r.front.WriteToUDP(buf[:n], client)
+			}
+		}
+	}()
+}
+
+func TestQUICNATRebinding(t *testing.T) {
+	server := startAddrEcho(t)
+	relay := newUDPRelay(t, server.Addr())
+
+	conn, err := DialQUIC("quic://"+relay.front.LocalAddr().String(), freshTLS(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	before := seenAddr(t, conn)
+	relay.rebind(t)
+
+	// سرور پس از اعتبارسنجی مسیر جدید به آن منتقل می‌شود
+	deadline := time.Now().Add(5 * time.Second)
+	for seenAddr(t, conn) == before {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not follow the rebinding")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,117 @@
+package transport
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// streamConn پیاده‌سازی Conn روی یک جریان TCP یا TLS با فریم‌های دارای پیشوند طول
+type streamConn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+}
+
+// NewStream پوشاندن یک اتصال جریانی
+func NewStream(conn net.Conn) Conn {
+	return &streamConn{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+// DialStream اتصال به سرور جریانی؛ آدرس به شکل tls://host:port یا tcp://host:port
+func DialStream(rawURL string, tlsConfig *tls.Config) (Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	var conn net.Conn
+	switch u.Scheme {
+	case "tcp":
+		conn, err = dialer.Dial("tcp", u.Host)
+	case "tls":
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = u.Hostname()
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", u.Host, tlsConfig)
+	default:
+		return nil, fmt.Errorf("stream: unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewStream(conn), nil
+}
+
+// ServeStream پذیرش اتصال‌های جریانی و اجرای handler برای هر کدام
+//
+// handshake TLS و خواندن فریم‌ها تا فراخوانی Authenticated باید در authTimeout
+// تمام شوند (صفر = بدون مهلت)؛ شنونده TLS پیش از اولین Read چیزی نمی‌خواند،
+// پس اتصال بی‌کار یا slowloris پس از این مهلت بسته می‌شود.
+func ServeStream(listener net.Listener, authTimeout time.Duration, handler func(Conn)) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			tcpConn.SetKeepAlive(true)
+			tcpConn.SetKeepAlivePeriod(30 * time.Second)
+		}
+		if authTimeout > 0 {
+			conn.SetDeadline(time.Now().Add(authTimeout))
+		}
+		go handler(NewStream(conn))
+	}
+}
+
+// Authenticated برداشتن مهلت ServeStream پس از شناسایی کاربر
+func (c *streamConn) Authenticated() {
+	c.conn.SetDeadline(time.Time{})
+}
+
+func (c *streamConn) ReadFrame() ([]byte, error) {
+	return readFrame(c.reader)
+}
+
+func (c *streamConn) WriteFrame(frame []byte) error {
+	if len(frame) > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+
+	// هدر و فریم در یک نوشتن تا بسته TCP جدا برای هدر ساخته نشود
+	buf := make([]byte, 4+len(frame))
+	binary.BigEndian.PutUint32(buf, uint32(len(frame)))
+	copy(buf[4:], frame)
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+func (c *streamConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *streamConn) RemoteAddr() string {
+	return c.conn.RemoteAddr().String()
+}
@@ -0,0 +1,126 @@
+package transport
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+)
+
+// startStream شنونده جریانی که فریم‌ها را برمی‌گرداند؛ اگر auth درست باشد پس
+// از اولین فریم Authenticated فراخوانی می‌شود
+func startStream(t *testing.T, listener net.Listener, timeout time.Duration, auth bool) <-chan error {
+	t.Helper()
+	done := make(chan error, 1)
+	go ServeStream(listener, timeout, func(conn Conn) {
+		defer conn.Close()
+		for {
+			frame, err := conn.ReadFrame()
+			if err != nil {
+				done <- err
+				return
+			}
+			if auth {
+				conn.(AuthConn).Authenticated()
+			}
+			if err := conn.WriteFrame(frame); err != nil {
+				done <- err
+				return
+			}
+		}
+	})
+	t.Cleanup(func() { listener.Close() })
+	return done
+}
+
+func TestStreamAuthTimeout(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+
+	tests := []struct {
+		name string
+		tls  bool
+		// send اولین فریم پیش از مهلت ارسال شود
+		send bool
+		auth bool
+		// closed سرور اتصال را پس از مهلت ببندد
+		closed bool
+	}{
+		{"idle tcp", false, false, false, true},
+		{"idle tls handshake", true, false, false, true},
+		{"unauthenticated frames", false, true, false, true},
+		{"authenticated", false, true, true, false},
+		{"authenticated tls", true, true, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			url := "tcp://" + listener.Addr().String()
+			if tt.tls {
+				listener = tls.NewListener(listener, selfSignedTLS(t))
+				url = "tls://" + listener.Addr().String()
+			}
+			done := startStream(t, listener, timeout, tt.auth)
+
+			var conn net.Conn
+			if tt.send {
+				c, err := DialStream(url, &tls.Config{InsecureSkipVerify: true})
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer c.Close()
+				if err := c.WriteFrame([]byte("hello")); err != nil {
+					t.Fatal(err)
+				}
+				if frame, err := c.ReadFrame(); err != nil || string(frame) != "hello" {
+					t.Fatalf("got %q, %v", frame, err)
+				}
+			} else {
+				// اتصال خام بدون handshake یا فریم
+				if conn, err = net.Dial("tcp", listener.Addr().String()); err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+			}
+
+			select {
+			case err := <-done:
+				if !tt.closed {
+					t.Fatalf("connection closed after authentication: %v", err)
+				}
+				if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+					t.Fatalf("got %v, want timeout", err)
+				}
+			case <-time.After(5 * timeout):
+				if tt.closed {
+					t.Fatal("idle connection not closed")
+				}
+			}
+		})
+	}
+}
+
+func TestStreamFrameTooLarge(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	startStream(t, listener, 0, false)
+
+	c, err := DialStream("tcp://"+listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.WriteFrame(make([]byte, MaxFrameSize+1)); err != ErrFrameTooLarge {
+		t.Fatalf("got %v, want ErrFrameTooLarge", err)
+	}
+	if err := c.WriteFrame(make([]byte, MaxFrameSize)); err != nil {
+		t.Fatal(err)
+	}
+	if frame, err := c.ReadFrame(); err != nil || len(frame) != MaxFrameSize {
+		t.Fatalf("got %d bytes, %v", len(frame), err)
+	}
+}
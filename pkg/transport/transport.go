@@ -0,0 +1,89 @@
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// MaxFrameSize حداکثر اندازه یک فریم رمزنگاری‌شده
+const MaxFrameSize = 1 << 20
+
+var (
+	// ErrClosed اتصال بسته شده است
+	ErrClosed = errors.New("transport closed")
+	// ErrFrameTooLarge فریم بزرگ‌تر از حد مجاز
+	ErrFrameTooLarge = errors.New("frame too large")
+)
+
+// Conn اتصال تانل که فریم‌های رمزنگاری‌شده protocol.Message را جابه‌جا می‌کند
+//
+// WriteFrame باید برای استفاده همزمان از چند goroutine امن باشد.
+type Conn interface {
+	// ReadFrame خواندن فریم بعدی
+	ReadFrame() ([]byte, error)
+	// WriteFrame ارسال یک فریم
+	WriteFrame(frame []byte) error
+	// Close بستن اتصال
+	Close() error
+	// RemoteAddr آدرس طرف مقابل
+	RemoteAddr() string
+}
+
+// EarlyConn اتصالی که ممکن است پیش از تکمیل handshake فریم تحویل دهد (داده 0-RTT)
+//
+// داده 0-RTT قابل تکرار (replay) است: مهاجم مسیر می‌تواند اولین پرواز ضبط‌شده را
+// دوباره بفرستد. پیام‌هایی که اثر جانبی دارند باید تا بازگشت WaitHandshake
+// پردازش نشوند؛ handshake اتصال تکراری هرگز کامل نمی‌شود.
+type EarlyConn interface {
+	Conn
+	// WaitHandshake انتظار تا تکمیل handshake؛ false اگر اتصال پیش از آن بسته شود
+	WaitHandshake() bool
+}
+
+// AuthConn اتصالی که تا شناسایی کاربر مهلت محدود دارد
+//
+// سرور پس از رمزگشایی اولین فریم معتبر Authenticated را فراخوانی می‌کند تا
+// مهلت برداشته شود؛ اتصال بی‌کار یا کند پیش از آن بسته می‌شود.
+type AuthConn interface {
+	Conn
+	// Authenticated برداشتن مهلت شناسایی
+	Authenticated()
+}
+
+// Migrator اتصالی که کلاینت می‌تواند آن را به مسیر شبکه جدید منتقل کند
+type Migrator interface {
+	Conn
+	// Migrate انتقال اتصال به یک سوکت UDP جدید
+	Migrate() error
+}
+
+// writeFrame نوشتن فریم با پیشوند طول ۴ بایتی
+func writeFrame(w io.Writer, frame []byte) error {
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(frame)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+// readFrame خواندن فریم با پیشوند طول ۴ بایتی
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > MaxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
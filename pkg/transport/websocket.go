@@ -0,0 +1,104 @@
+package transport
+
+import (
+	"crypto/tls"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// closeTimeout حداکثر زمان ارسال فریم بستن WebSocket
+const closeTimeout = time.Second
+
+// wsConn پیاده‌سازی Conn روی WebSocket
+type wsConn struct {
+	conn       *websocket.Conn
+	remoteAddr string
+	writeMutex sync.Mutex
+	closeOnce  sync.Once
+	done       chan struct{}
+}
+
+// NewWebSocket پوشاندن اتصال WebSocket؛ اگر pingInterval صفر نباشد ping دوره‌ای ارسال می‌شود
+func NewWebSocket(conn *websocket.Conn, remoteAddr string, pingInterval time.Duration) Conn {
+	c := &wsConn{
+		conn:       conn,
+		remoteAddr: remoteAddr,
+		done:       make(chan struct{}),
+	}
+
+	if pingInterval > 0 {
+		go c.pingLoop(pingInterval)
+	}
+
+	return c
+}
+
+// DialWebSocket اتصال به سرور WebSocket با هدرهای اضافی اختیاری
+func DialWebSocket(url string, tlsConfig *tls.Config, header http.Header) (Conn, error) {
+	dialer := websocket.Dialer{
+		HandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:  tlsConfig,
+	}
+
+	conn, _, err := dialer.Dial(url, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWebSocket(conn, conn.RemoteAddr().String(), 0), nil
+}
+
+func (c *wsConn) pingLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.writeMutex.Lock()
+			err := c.conn.WriteMessage(websocket.PingMessage, nil)
+			c.writeMutex.Unlock()
+			if err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *wsConn) ReadFrame() ([]byte, error) {
+	for {
+		messageType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if messageType == websocket.BinaryMessage {
+			return data, nil
+		}
+	}
+}
+
+func (c *wsConn) WriteFrame(frame []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.conn.WriteMessage(websocket.BinaryMessage, frame)
+}
+
+// Close ارسال فریم بستن (going away) و بستن اتصال
+//
+// طرف مقابل به جای خطای خواندن، بسته شدن عادی را می‌بیند.
+func (c *wsConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "")
+		c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeTimeout))
+	})
+	return c.conn.Close()
+}
+
+func (c *wsConn) RemoteAddr() string {
+	return c.remoteAddr
+}